@@ -0,0 +1,319 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/client"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// DefaultRawEndpoints are the calls the raw endpoint allows: the read calls the
+// exporter itself makes
+var DefaultRawEndpoints = client.GoCoaxProfile.Endpoints()
+
+// Errors returned by Manager.Reboot
+var (
+	ErrUnknownDevice    = errors.New("unknown device")
+	ErrRebootInProgress = errors.New("reboot already in progress")
+)
+
+// Actor recorded in the audit log for automatic reboots
+const autoRebootActor = "auto-reboot"
+
+// Device is a device that can be managed; GoCoaxCollector implements it
+type Device interface {
+	DeviceName() string
+	Reboot(ctx context.Context) error
+	Query(ctx context.Context, endpoint string, data []int) ([]uint32, error)
+}
+
+// Manager performs management actions on devices and records them in the audit log.
+// With auto-reboot configured it also reboots devices after consecutive failed queries.
+type Manager struct {
+	devices func() []Device // called on every lookup
+	audit   *AuditLog
+	auto    *config.AutoRebootConfig // nil disables auto-reboot
+	timeout time.Duration
+
+	rawEndpoints map[string]bool // calls allowed by the raw endpoint, in lower case
+
+	mu         sync.Mutex
+	failures   map[string]int       // consecutive failed queries
+	lastReboot map[string]time.Time // last reboot attempt
+	rebooting  map[string]bool
+
+	now func() time.Time
+}
+
+// NewManager creates a manager for the devices returned by devices, which is called on
+// every lookup so devices added later can be managed too
+func NewManager(devices func() []Device, audit *AuditLog, auto *config.AutoRebootConfig, timeout time.Duration) *Manager {
+	m := &Manager{
+		devices:    devices,
+		audit:      audit,
+		auto:       auto,
+		timeout:    timeout,
+		failures:   make(map[string]int),
+		lastReboot: make(map[string]time.Time),
+		rebooting:  make(map[string]bool),
+		now:        time.Now,
+
+		rawEndpoints: make(map[string]bool),
+	}
+	m.AllowRawEndpoints(DefaultRawEndpoints...)
+	return m
+}
+
+// device returns the named device
+func (m *Manager) device(name string) (Device, bool) {
+	for _, d := range m.devices() {
+		if d.DeviceName() == name {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// AllowRawEndpoints adds read endpoints, such as those of custom_metrics, to the calls
+// the raw endpoint may make. Endpoints that do not read data are ignored.
+func (m *Manager) AllowRawEndpoints(endpoints ...string) {
+	for _, endpoint := range endpoints {
+		if client.IsReadEndpoint(endpoint) {
+			m.rawEndpoints[strings.ToLower(endpoint)] = true
+		}
+	}
+}
+
+// Reboot reboots a device. The entry carries the actor, remote address and reason for
+// the audit log; the remaining fields are filled in.
+func (m *Manager) Reboot(ctx context.Context, name string, entry AuditEntry) error {
+	device, ok := m.device(name)
+	if !ok {
+		return ErrUnknownDevice
+	}
+
+	m.mu.Lock()
+	err := m.begin(name)
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return m.reboot(ctx, device, entry)
+}
+
+// begin marks a reboot of the device as started. Callers must hold m.mu.
+func (m *Manager) begin(name string) error {
+	if m.rebooting[name] {
+		return ErrRebootInProgress
+	}
+	m.rebooting[name] = true
+	m.lastReboot[name] = m.now()
+	m.failures[name] = 0
+	return nil
+}
+
+// reboot performs a reboot started with begin and records it
+func (m *Manager) reboot(ctx context.Context, device Device, entry AuditEntry) error {
+	name := device.DeviceName()
+	log.Printf("Rebooting device %s (requested by %s)", name, entry.Actor)
+
+	err := device.Reboot(ctx)
+
+	m.mu.Lock()
+	delete(m.rebooting, name)
+	m.mu.Unlock()
+
+	entry.Time = m.now()
+	entry.Action = "reboot"
+	entry.Device = name
+	entry.Result = "ok"
+	if err != nil {
+		entry.Result = "error"
+		entry.Error = err.Error()
+		log.Printf("Error rebooting device %s: %v", name, err)
+	}
+	m.audit.Record(entry)
+
+	return err
+}
+
+// ObserveGather tracks consecutive failed queries of a device, as reported once per
+// query by the collector's OnGather, and starts a reboot once the configured
+// threshold is reached, at most once per minimum interval
+func (m *Manager) ObserveGather(name string, gatherErr error) {
+	if m.auto == nil {
+		return
+	}
+	device, ok := m.device(name)
+	if !ok {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if gatherErr == nil {
+		m.failures[name] = 0
+		return
+	}
+
+	m.failures[name]++
+	failures := m.failures[name]
+	if failures < m.auto.FailureThreshold {
+		return
+	}
+
+	if last, ok := m.lastReboot[name]; ok && m.now().Sub(last) < m.auto.GetMinInterval() {
+		// Log once when the threshold is reached rather than on every query
+		if failures == m.auto.FailureThreshold {
+			log.Printf("Device %s failed %d consecutive queries; not rebooting, last reboot was %s ago",
+				name, failures, m.now().Sub(last).Round(time.Second))
+		}
+		return
+	}
+
+	if err := m.begin(name); err != nil {
+		return
+	}
+
+	entry := AuditEntry{
+		Actor:  autoRebootActor,
+		Reason: fmt.Sprintf("%d consecutive failed queries, last error: %v", failures, gatherErr),
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+		defer cancel()
+		m.reboot(ctx, device, entry)
+	}()
+}
+
+// Register adds the admin API to mux, protected by the configured credentials
+func (m *Manager) Register(mux *http.ServeMux, cfg *config.AdminConfig) {
+	mux.Handle("POST /api/v1/devices/{name}/reboot", m.requireAuth(cfg, "reboot", http.HandlerFunc(m.handleReboot)))
+	mux.Handle("GET /debug/devices/{name}/raw", m.requireAuth(cfg, "raw", http.HandlerFunc(m.handleRaw)))
+}
+
+// requireAuth rejects requests without the admin credentials and audits the attempt
+// as the given action
+func (m *Manager) requireAuth(cfg *config.AdminConfig, action string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		userMatch := subtle.ConstantTimeCompare([]byte(username), []byte(cfg.Username)) == 1
+		passMatch := subtle.ConstantTimeCompare([]byte(password), []byte(cfg.Password)) == 1
+
+		if !ok || !userMatch || !passMatch {
+			m.audit.Record(AuditEntry{
+				Time:       m.now(),
+				Action:     action,
+				Device:     r.PathValue("name"),
+				Actor:      username,
+				RemoteAddr: r.RemoteAddr,
+				Result:     "unauthorized",
+			})
+			w.Header().Set("WWW-Authenticate", `Basic realm="gocoax-exporter admin"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleReboot serves POST /api/v1/devices/{name}/reboot
+func (m *Manager) handleReboot(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	username, _, _ := r.BasicAuth()
+
+	ctx, cancel := context.WithTimeout(r.Context(), m.timeout)
+	defer cancel()
+
+	err := m.Reboot(ctx, name, AuditEntry{
+		Actor:      username,
+		RemoteAddr: r.RemoteAddr,
+		Reason:     r.URL.Query().Get("reason"),
+	})
+
+	switch {
+	case errors.Is(err, ErrUnknownDevice):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrRebootInProgress):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	case err != nil:
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"device": name, "result": "rebooting"})
+	}
+}
+
+// rawResponse is the response of the raw endpoint
+type rawResponse struct {
+	Device   string        `json:"device"`
+	Endpoint string        `json:"endpoint"`
+	Data     []int         `json:"data"`
+	Words    []client.Word `json:"words"`
+}
+
+// handleRaw serves GET /debug/devices/{name}/raw?endpoint=/ms/0/0x16&data=3, the
+// response words of one of the allowed read calls. Calls are recorded in the audit log.
+func (m *Manager) handleRaw(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	username, _, _ := r.BasicAuth()
+	endpoint := r.URL.Query().Get("endpoint")
+
+	device, ok := m.device(name)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": ErrUnknownDevice.Error()})
+		return
+	}
+	if !m.rawEndpoints[strings.ToLower(endpoint)] {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": fmt.Sprintf("endpoint %q is not allowed", endpoint)})
+		return
+	}
+	data, err := client.ParseData(r.URL.Query().Get("data"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), m.timeout)
+	defer cancel()
+	words, err := device.Query(ctx, endpoint, data)
+
+	entry := AuditEntry{
+		Time:       m.now(),
+		Action:     "raw",
+		Device:     name,
+		Actor:      username,
+		RemoteAddr: r.RemoteAddr,
+		Reason:     fmt.Sprintf("%s %v", endpoint, data),
+		Result:     "ok",
+	}
+	if err != nil {
+		entry.Result = "error"
+		entry.Error = err.Error()
+	}
+	m.audit.Record(entry)
+
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, rawResponse{Device: name, Endpoint: endpoint, Data: data, Words: client.DescribeWords(words)})
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
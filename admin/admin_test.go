@@ -0,0 +1,279 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// fakeDevice counts reboots and fails them if err is set
+type fakeDevice struct {
+	name string
+	err  error
+
+	mu      sync.Mutex
+	reboots int
+}
+
+func (d *fakeDevice) DeviceName() string { return d.name }
+
+func (d *fakeDevice) Reboot(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.reboots++
+	return d.err
+}
+
+// Query answers every call with its request data followed by 0x25
+func (d *fakeDevice) Query(ctx context.Context, endpoint string, data []int) ([]uint32, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	words := make([]uint32, 0, len(data)+1)
+	for _, v := range data {
+		words = append(words, uint32(v))
+	}
+	return append(words, 0x25), nil
+}
+
+func (d *fakeDevice) rebootCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.reboots
+}
+
+// newTestManager returns a manager with an in-memory audit log and a fake clock
+func newTestManager(auto *config.AutoRebootConfig, devices ...Device) (*Manager, *bytes.Buffer, *time.Time) {
+	buf := &bytes.Buffer{}
+	m := NewManager(func() []Device { return devices }, NewAuditLog(buf), auto, time.Second)
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	return m, buf, &now
+}
+
+// auditEntries parses the entries written so far
+func auditEntries(t *testing.T, m *Manager, buf *bytes.Buffer) []AuditEntry {
+	t.Helper()
+
+	m.audit.mu.Lock()
+	defer m.audit.mu.Unlock()
+
+	var entries []AuditEntry
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var e AuditEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("Invalid audit line %q: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestRebootEndpoint(t *testing.T) {
+	device := &fakeDevice{name: "bridge-50"}
+	broken := &fakeDevice{name: "bridge-53", err: errors.New("unexpected status code 401")}
+	m, buf, _ := newTestManager(nil, device, broken)
+
+	mux := http.NewServeMux()
+	m.Register(mux, &config.AdminConfig{Username: "admin", Password: "secret"})
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		username       string
+		password       string
+		expectedStatus int
+	}{
+		{"reboots device", "POST", "/api/v1/devices/bridge-50/reboot?reason=stuck", "admin", "secret", http.StatusOK},
+		{"wrong password", "POST", "/api/v1/devices/bridge-50/reboot", "admin", "wrong", http.StatusUnauthorized},
+		{"no credentials", "POST", "/api/v1/devices/bridge-50/reboot", "", "", http.StatusUnauthorized},
+		{"unknown device", "POST", "/api/v1/devices/nope/reboot", "admin", "secret", http.StatusNotFound},
+		{"device error", "POST", "/api/v1/devices/bridge-53/reboot", "admin", "secret", http.StatusBadGateway},
+		{"GET not allowed", "GET", "/api/v1/devices/bridge-50/reboot", "admin", "secret", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.username != "" {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if got := device.rebootCount(); got != 1 {
+		t.Errorf("Expected 1 reboot of bridge-50, got %d", got)
+	}
+
+	entries := auditEntries(t, m, buf)
+	if len(entries) != 4 {
+		t.Fatalf("Expected 4 audit entries, got %d: %+v", len(entries), entries)
+	}
+	first := entries[0]
+	if first.Device != "bridge-50" || first.Actor != "admin" || first.Result != "ok" || first.Reason != "stuck" {
+		t.Errorf("Unexpected audit entry for reboot: %+v", first)
+	}
+	if first.RemoteAddr == "" || first.Time.IsZero() {
+		t.Errorf("Audit entry missing remote address or time: %+v", first)
+	}
+	if entries[1].Result != "unauthorized" || entries[2].Result != "unauthorized" {
+		t.Errorf("Expected unauthorized attempts to be audited, got %+v", entries[1:3])
+	}
+	if entries[3].Result != "error" || entries[3].Error == "" {
+		t.Errorf("Expected failed reboot to be audited with its error, got %+v", entries[3])
+	}
+}
+
+func TestRawEndpoint(t *testing.T) {
+	device := &fakeDevice{name: "bridge-50"}
+	m, buf, _ := newTestManager(nil, device)
+	m.AllowRawEndpoints("/ms/0/0x99", "/ms/1/0xb01")
+
+	mux := http.NewServeMux()
+	m.Register(mux, &config.AdminConfig{Username: "admin", Password: "secret"})
+
+	tests := []struct {
+		name           string
+		path           string
+		username       string
+		expectedStatus int
+	}{
+		{"node info", "/debug/devices/bridge-50/raw?endpoint=/ms/0/0x16&data=3", "admin", http.StatusOK},
+		{"custom endpoint", "/debug/devices/bridge-50/raw?endpoint=/ms/0/0x99", "admin", http.StatusOK},
+		{"endpoint not in allowlist", "/debug/devices/bridge-50/raw?endpoint=/ms/0/0x98", "admin", http.StatusForbidden},
+		{"reboot endpoint", "/debug/devices/bridge-50/raw?endpoint=/ms/1/0xb00", "admin", http.StatusForbidden},
+		{"write endpoint not allowed", "/debug/devices/bridge-50/raw?endpoint=/ms/1/0xb01", "admin", http.StatusForbidden},
+		{"invalid data", "/debug/devices/bridge-50/raw?endpoint=/ms/0/0x16&data=x", "admin", http.StatusBadRequest},
+		{"unknown device", "/debug/devices/nope/raw?endpoint=/ms/0/0x16", "admin", http.StatusNotFound},
+		{"no credentials", "/debug/devices/bridge-50/raw?endpoint=/ms/0/0x16", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.username != "" {
+				req.SetBasicAuth(tt.username, "secret")
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.name != "node info" {
+				return
+			}
+
+			var resp rawResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Invalid response: %v", err)
+			}
+			if resp.Endpoint != "/ms/0/0x16" || len(resp.Data) != 1 || resp.Data[0] != 3 {
+				t.Errorf("Unexpected call in response: %+v", resp)
+			}
+			if len(resp.Words) != 2 || resp.Words[1].Hex != "0x00000025" || resp.Words[1].Decimal != 37 {
+				t.Errorf("Unexpected words: %+v", resp.Words)
+			}
+		})
+	}
+
+	// Calls made and unauthorized attempts are audited
+	entries := auditEntries(t, m, buf)
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 audit entries, got %d: %+v", len(entries), entries)
+	}
+	if e := entries[0]; e.Action != "raw" || e.Actor != "admin" || e.Reason != "/ms/0/0x16 [3]" || e.Result != "ok" {
+		t.Errorf("Unexpected audit entry for raw call: %+v", e)
+	}
+	if e := entries[2]; e.Action != "raw" || e.Result != "unauthorized" {
+		t.Errorf("Expected unauthorized raw call to be audited, got %+v", e)
+	}
+}
+
+func TestAutoReboot(t *testing.T) {
+	device := &fakeDevice{name: "bridge-50"}
+	auto := &config.AutoRebootConfig{FailureThreshold: 3, MinInterval: 3600}
+	m, buf, now := newTestManager(auto, device)
+
+	gatherErr := errors.New("connection refused")
+	waitForReboots := func(expected int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for device.rebootCount() < expected && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		// Let the audit entry of the reboot be written
+		for len(auditEntries(t, m, buf)) < expected && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if got := device.rebootCount(); got != expected {
+			t.Fatalf("Expected %d reboots, got %d", expected, got)
+		}
+	}
+
+	// A success resets the count
+	m.ObserveGather("bridge-50", gatherErr)
+	m.ObserveGather("bridge-50", gatherErr)
+	m.ObserveGather("bridge-50", nil)
+	m.ObserveGather("bridge-50", gatherErr)
+	m.ObserveGather("bridge-50", gatherErr)
+	waitForReboots(0)
+
+	m.ObserveGather("bridge-50", gatherErr)
+	waitForReboots(1)
+
+	// Still failing within the minimum interval: no further reboot
+	*now = now.Add(10 * time.Minute)
+	for i := 0; i < 5; i++ {
+		m.ObserveGather("bridge-50", gatherErr)
+	}
+	waitForReboots(1)
+
+	// Once the interval has passed the next failure reboots again
+	*now = now.Add(time.Hour)
+	m.ObserveGather("bridge-50", gatherErr)
+	waitForReboots(2)
+
+	entries := auditEntries(t, m, buf)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 audit entries, got %d", len(entries))
+	}
+	if entries[0].Actor != autoRebootActor || !strings.Contains(entries[0].Reason, "3 consecutive failed queries") {
+		t.Errorf("Unexpected audit entry for auto-reboot: %+v", entries[0])
+	}
+}
+
+func TestAutoRebootDisabled(t *testing.T) {
+	device := &fakeDevice{name: "bridge-50"}
+	m, _, _ := newTestManager(nil, device)
+
+	for i := 0; i < 20; i++ {
+		m.ObserveGather("bridge-50", errors.New("connection refused"))
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if got := device.rebootCount(); got != 0 {
+		t.Errorf("Expected no reboots without auto_reboot, got %d", got)
+	}
+}
@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEntry records one management action, successful or not
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	Action     string    `json:"action"`
+	Device     string    `json:"device"`
+	Actor      string    `json:"actor"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Result     string    `json:"result"` // "ok", "error" or "unauthorized"
+	Error      string    `json:"error,omitempty"`
+}
+
+// AuditLog writes audit entries as JSON lines
+type AuditLog struct {
+	mu sync.Mutex
+	w  io.Writer // nil writes to the standard log
+	c  io.Closer
+}
+
+// NewAuditLog creates an audit log writing to w, or to the standard log if w is nil
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{w: w}
+}
+
+// OpenAuditLog appends to the file at path, or writes to the standard log if path
+// is empty
+func OpenAuditLog(path string) (*AuditLog, error) {
+	if path == "" {
+		return NewAuditLog(nil), nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &AuditLog{w: f, c: f}, nil
+}
+
+// Record writes an entry. Failures are logged; they do not fail the action.
+func (a *AuditLog) Record(entry AuditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error encoding audit entry: %v", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.w == nil {
+		log.Printf("Audit: %s", line)
+		return
+	}
+	if _, err := a.w.Write(append(line, '\n')); err != nil {
+		log.Printf("Error writing audit entry: %v", err)
+	}
+}
+
+// Close closes the audit log file, if any
+func (a *AuditLog) Close() error {
+	if a.c == nil {
+		return nil
+	}
+	return a.c.Close()
+}
@@ -0,0 +1,240 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/bits"
+	"sort"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// Alert statuses
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Alert is a notification about a rule that fired or resolved for a device
+type Alert struct {
+	Status   string     `json:"status"`
+	Rule     string     `json:"rule"`
+	Type     string     `json:"type"`
+	Device   string     `json:"device"`
+	Link     string     `json:"link,omitempty"` // link_below: the link, such as 0-3
+	Summary  string     `json:"summary"`
+	StartsAt time.Time  `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"` // set when resolved
+}
+
+// active is the state of a firing alert
+type active struct {
+	alert    Alert
+	lastSent time.Time
+}
+
+// Notifier polls the devices, evaluates the rules against every poll and sends
+// alerts to the webhooks. An alert is sent when it starts firing, again every repeat
+// interval while it fires, and once more when it resolves.
+type Notifier struct {
+	cfg       *config.AlertingConfig
+	gatherers func() []collector.SnapshotGatherer // called on every poll
+	timeout   time.Duration
+	webhooks  []*webhook
+
+	active    map[string]*active // firing alerts by key
+	failures  map[string]int     // consecutive failed polls by device
+	baselines map[string]int     // node counts first seen, by rule and device
+
+	now func() time.Time
+}
+
+// NewNotifier creates a notifier for the devices returned by gatherers, which is called
+// on every poll so devices added later are evaluated too
+func NewNotifier(cfg *config.AlertingConfig, gatherers func() []collector.SnapshotGatherer, timeout time.Duration) *Notifier {
+	webhooks := make([]*webhook, 0, len(cfg.Webhooks))
+	for i := range cfg.Webhooks {
+		webhooks = append(webhooks, newWebhook(&cfg.Webhooks[i]))
+	}
+
+	return &Notifier{
+		cfg:       cfg,
+		gatherers: gatherers,
+		timeout:   timeout,
+		webhooks:  webhooks,
+		active:    make(map[string]*active),
+		failures:  make(map[string]int),
+		baselines: make(map[string]int),
+		now:       time.Now,
+	}
+}
+
+// Run evaluates the rules every interval until ctx is cancelled
+func (n *Notifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.cfg.GetInterval())
+	defer ticker.Stop()
+
+	for {
+		n.EvaluateOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// EvaluateOnce polls every device and sends the resulting alerts
+func (n *Notifier) EvaluateOnce(ctx context.Context) {
+	for _, g := range n.gatherers() {
+		gatherCtx, cancel := context.WithTimeout(ctx, n.timeout)
+		snapshot, err := g.Gather(gatherCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		for _, a := range n.Observe(g.DeviceName(), snapshot, err) {
+			n.send(ctx, a)
+		}
+	}
+}
+
+// send delivers an alert to every webhook that accepts it
+func (n *Notifier) send(ctx context.Context, a Alert) {
+	log.Printf("Alert %s %s on device %s: %s", a.Rule, a.Status, a.Device, a.Summary)
+	for _, h := range n.webhooks {
+		if a.Status == StatusResolved && h.cfg.DisableResolved {
+			continue
+		}
+		if err := h.send(ctx, a); err != nil {
+			log.Printf("Error sending alert to %s webhook: %v", h.cfg.Format, err)
+		}
+	}
+}
+
+// Observe evaluates the rules against one poll of a device, a snapshot or the error
+// of a failed poll, and returns the alerts to send. Rules that need a snapshot keep
+// their state while the device cannot be polled.
+func (n *Notifier) Observe(device string, snapshot *collector.DeviceSnapshot, err error) []Alert {
+	now := n.now()
+	if err != nil {
+		n.failures[device]++
+	} else {
+		n.failures[device] = 0
+	}
+
+	firing := make(map[string]Alert) // alerts the rules report now, by key
+	evaluated := make(map[string]bool)
+	for _, rule := range n.cfg.Rules {
+		if !appliesTo(rule, device) {
+			continue
+		}
+
+		switch rule.Type {
+		case config.AlertDeviceDown:
+			evaluated[rule.Name] = true
+			if polls := n.failures[device]; polls >= rule.Polls {
+				firing[key(rule.Name, device, "")] = Alert{Rule: rule.Name, Type: rule.Type, Device: device,
+					Summary: fmt.Sprintf("%s has been unreachable for %d polls: %v", device, polls, err)}
+			}
+
+		case config.AlertLinkBelow:
+			if err != nil || snapshot.PHYRates == nil || snapshot.Partial {
+				continue
+			}
+			evaluated[rule.Name] = true
+			for from, row := range snapshot.PHYRates.NPER {
+				for to, rate := range row {
+					if rate >= rule.ThresholdMbps {
+						continue
+					}
+					link := fmt.Sprintf("%d-%d", from, to)
+					firing[key(rule.Name, device, link)] = Alert{Rule: rule.Name, Type: rule.Type, Device: device, Link: link,
+						Summary: fmt.Sprintf("%s link %d->%d NPER rate %d Mbps is below %d Mbps", device, from, to, rate, rule.ThresholdMbps)}
+				}
+			}
+
+		case config.AlertNodeCountChanged:
+			if err != nil {
+				continue
+			}
+			evaluated[rule.Name] = true
+			count := bits.OnesCount(uint(snapshot.LocalInfo.NodeBitMask))
+			expected := rule.ExpectedNodes
+			if expected == 0 {
+				baselineKey := key(rule.Name, device, "")
+				if _, ok := n.baselines[baselineKey]; !ok {
+					n.baselines[baselineKey] = count
+				}
+				expected = n.baselines[baselineKey]
+			}
+			if count != expected {
+				firing[key(rule.Name, device, "")] = Alert{Rule: rule.Name, Type: rule.Type, Device: device,
+					Summary: fmt.Sprintf("%s has %d nodes, expected %d", device, count, expected)}
+			}
+		}
+	}
+
+	var alerts []Alert
+	for k, a := range firing {
+		state, ok := n.active[k]
+		if !ok {
+			a.Status = StatusFiring
+			a.StartsAt = now
+			n.active[k] = &active{alert: a, lastSent: now}
+			alerts = append(alerts, a)
+			continue
+		}
+
+		// Keep the start time but report the latest summary
+		a.Status = StatusFiring
+		a.StartsAt = state.alert.StartsAt
+		state.alert = a
+		if now.Sub(state.lastSent) >= n.cfg.GetRepeatInterval() {
+			state.lastSent = now
+			alerts = append(alerts, a)
+		}
+	}
+
+	for k, state := range n.active {
+		a := state.alert
+		if a.Device != device || !evaluated[a.Rule] {
+			continue
+		}
+		if _, ok := firing[k]; ok {
+			continue
+		}
+		delete(n.active, k)
+		a.Status = StatusResolved
+		a.EndsAt = &now
+		alerts = append(alerts, a)
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		return key(alerts[i].Rule, alerts[i].Device, alerts[i].Link) < key(alerts[j].Rule, alerts[j].Device, alerts[j].Link)
+	})
+	return alerts
+}
+
+// appliesTo reports whether a rule covers a device
+func appliesTo(rule config.AlertRule, device string) bool {
+	if len(rule.Devices) == 0 {
+		return true
+	}
+	for _, d := range rule.Devices {
+		if d == device {
+			return true
+		}
+	}
+	return false
+}
+
+// key identifies an alert by rule, device and link
+func key(rule, device, link string) string {
+	return rule + "/" + device + "/" + link
+}
@@ -0,0 +1,208 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/client"
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+var baseTime = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// testSnapshot returns a snapshot of nodes 0 to nodes-1 with the given 0->1 rate
+func testSnapshot(nodes, rate int) *collector.DeviceSnapshot {
+	rates := collector.NewPHYRateMatrix()
+	rates.NPER[0] = map[int]int{1: rate}
+	rates.NPER[1] = map[int]int{0: 3000}
+	return &collector.DeviceSnapshot{
+		Device:    "bridge-50",
+		Time:      baseTime,
+		LocalInfo: &client.LocalInfo{NodeBitMask: 1<<nodes - 1},
+		PHYRates:  rates,
+	}
+}
+
+// newTestNotifier creates a notifier with the given rules and a controllable clock
+func newTestNotifier(rules ...config.AlertRule) (*Notifier, *time.Time) {
+	n := NewNotifier(&config.AlertingConfig{Interval: 60, RepeatInterval: 600, Rules: rules}, nil, time.Second)
+	now := baseTime
+	n.now = func() time.Time { return now }
+	return n, &now
+}
+
+// statuses summarizes alerts as "rule/link:status" for comparison
+func statuses(alerts []Alert) []string {
+	s := []string{}
+	for _, a := range alerts {
+		s = append(s, a.Rule+"/"+a.Link+":"+a.Status)
+	}
+	return s
+}
+
+func expectStatuses(t *testing.T, step string, alerts []Alert, expected ...string) {
+	t.Helper()
+	got := statuses(alerts)
+	if len(got) != len(expected) {
+		t.Fatalf("%s: expected %v, got %v", step, expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Fatalf("%s: expected %v, got %v", step, expected, got)
+		}
+	}
+}
+
+func TestDeviceDown(t *testing.T) {
+	n, now := newTestNotifier(config.AlertRule{Name: "down", Type: config.AlertDeviceDown, Polls: 2})
+	down := errors.New("connection refused")
+
+	expectStatuses(t, "first failure", n.Observe("bridge-50", nil, down))
+	expectStatuses(t, "second failure", n.Observe("bridge-50", nil, down), "down/:firing")
+
+	// Deduplicated until the repeat interval has passed
+	*now = now.Add(5 * time.Minute)
+	expectStatuses(t, "still down", n.Observe("bridge-50", nil, down))
+	*now = now.Add(5 * time.Minute)
+	alerts := n.Observe("bridge-50", nil, down)
+	expectStatuses(t, "repeat", alerts, "down/:firing")
+	if !alerts[0].StartsAt.Equal(baseTime) {
+		t.Errorf("Expected repeat to keep the start time, got %v", alerts[0].StartsAt)
+	}
+
+	*now = now.Add(time.Minute)
+	alerts = n.Observe("bridge-50", testSnapshot(2, 3000), nil)
+	expectStatuses(t, "recovered", alerts, "down/:resolved")
+	if alerts[0].EndsAt == nil || !alerts[0].EndsAt.Equal(*now) {
+		t.Errorf("Expected resolved alert to end now, got %v", alerts[0].EndsAt)
+	}
+}
+
+func TestLinkBelow(t *testing.T) {
+	n, _ := newTestNotifier(config.AlertRule{Name: "slow", Type: config.AlertLinkBelow, ThresholdMbps: 500})
+
+	alerts := n.Observe("bridge-50", testSnapshot(2, 180), nil)
+	expectStatuses(t, "slow link", alerts, "slow/0-1:firing")
+	if want := "bridge-50 link 0->1 NPER rate 180 Mbps is below 500 Mbps"; alerts[0].Summary != want {
+		t.Errorf("Expected summary %q, got %q", want, alerts[0].Summary)
+	}
+
+	// A failed poll leaves the link state unknown rather than resolved
+	expectStatuses(t, "failed poll", n.Observe("bridge-50", nil, errors.New("timeout")))
+
+	expectStatuses(t, "recovered", n.Observe("bridge-50", testSnapshot(2, 900), nil), "slow/0-1:resolved")
+}
+
+func TestNodeCountChanged(t *testing.T) {
+	n, _ := newTestNotifier(
+		config.AlertRule{Name: "baseline", Type: config.AlertNodeCountChanged},
+		config.AlertRule{Name: "expected", Type: config.AlertNodeCountChanged, ExpectedNodes: 3},
+	)
+
+	expectStatuses(t, "first poll", n.Observe("bridge-50", testSnapshot(2, 3000), nil), "expected/:firing")
+	expectStatuses(t, "node joined", n.Observe("bridge-50", testSnapshot(3, 3000), nil), "baseline/:firing", "expected/:resolved")
+	expectStatuses(t, "node left", n.Observe("bridge-50", testSnapshot(2, 3000), nil), "baseline/:resolved", "expected/:firing")
+}
+
+func TestRuleDevices(t *testing.T) {
+	n, _ := newTestNotifier(config.AlertRule{Name: "down", Type: config.AlertDeviceDown, Polls: 1, Devices: []string{"bridge-53"}})
+
+	expectStatuses(t, "other device", n.Observe("bridge-50", nil, errors.New("timeout")))
+	expectStatuses(t, "listed device", n.Observe("bridge-53", nil, errors.New("timeout")), "down/:firing")
+}
+
+// request is a webhook request received by the test server
+type request struct {
+	contentType string
+	title       string
+	body        string
+}
+
+// fakeGatherer fails with err if set
+type fakeGatherer struct {
+	err error
+}
+
+func (g *fakeGatherer) DeviceName() string { return "bridge-50" }
+
+func (g *fakeGatherer) Gather(ctx context.Context) (*collector.DeviceSnapshot, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	return testSnapshot(2, 3000), nil
+}
+
+func TestEvaluateOnceWebhooks(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string][]request)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], request{r.Header.Get("Content-Type"), r.Header.Get("Title"), string(body)})
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	cfg := &config.AlertingConfig{
+		Interval:       60,
+		RepeatInterval: 600,
+		Rules:          []config.AlertRule{{Name: "down", Type: config.AlertDeviceDown, Polls: 1}},
+		Webhooks: []config.AlertWebhookConfig{
+			{URL: server.URL + "/generic", Format: "generic"},
+			{URL: server.URL + "/slack", Format: "slack"},
+			{URL: server.URL + "/discord", Format: "discord"},
+			{URL: server.URL + "/ntfy", Format: "ntfy", DisableResolved: true},
+		},
+	}
+	gatherer := &fakeGatherer{err: errors.New("connection refused")}
+	n := NewNotifier(cfg, func() []collector.SnapshotGatherer { return []collector.SnapshotGatherer{gatherer} }, time.Second)
+
+	n.EvaluateOnce(context.Background())
+	gatherer.err = nil
+	n.EvaluateOnce(context.Background())
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(received["/generic"]) != 2 {
+		t.Fatalf("Expected firing and resolved generic requests, got %d", len(received["/generic"]))
+	}
+	var generic Alert
+	if err := json.Unmarshal([]byte(received["/generic"][1].body), &generic); err != nil {
+		t.Fatalf("Invalid generic body: %v", err)
+	}
+	if generic.Status != StatusResolved || generic.Device != "bridge-50" || generic.EndsAt == nil {
+		t.Errorf("Unexpected generic alert: %+v", generic)
+	}
+
+	var slack map[string]string
+	if err := json.Unmarshal([]byte(received["/slack"][0].body), &slack); err != nil {
+		t.Fatalf("Invalid slack body: %v", err)
+	}
+	if want := "[FIRING] down on bridge-50: bridge-50 has been unreachable for 1 polls: connection refused"; slack["text"] != want {
+		t.Errorf("Expected slack text %q, got %q", want, slack["text"])
+	}
+
+	var discord map[string]string
+	if err := json.Unmarshal([]byte(received["/discord"][1].body), &discord); err != nil {
+		t.Fatalf("Invalid discord body: %v", err)
+	}
+	if discord["content"] == "" {
+		t.Errorf("Expected discord content, got %q", received["/discord"][1].body)
+	}
+
+	if len(received["/ntfy"]) != 1 {
+		t.Fatalf("Expected only the firing ntfy request, got %d", len(received["/ntfy"]))
+	}
+	if ntfy := received["/ntfy"][0]; ntfy.title != "[FIRING] down on bridge-50" || ntfy.contentType != "text/plain; charset=utf-8" {
+		t.Errorf("Unexpected ntfy request: %+v", ntfy)
+	}
+}
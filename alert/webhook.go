@@ -0,0 +1,100 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// Time allowed for one webhook request
+const webhookTimeout = 10 * time.Second
+
+// webhook sends alerts to one receiver in its format
+type webhook struct {
+	cfg    *config.AlertWebhookConfig
+	client *http.Client
+}
+
+// newWebhook creates a sender for the configured receiver
+func newWebhook(cfg *config.AlertWebhookConfig) *webhook {
+	return &webhook{cfg: cfg, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// send POSTs one alert
+func (h *webhook) send(ctx context.Context, a Alert) error {
+	req, err := newRequest(ctx, h.cfg.Format, h.cfg.URL, a)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// newRequest renders an alert for a webhook format:
+//
+//	generic  the alert as JSON
+//	slack    {"text": "..."} for Slack incoming webhooks
+//	discord  {"content": "..."} for Discord webhooks
+//	ntfy     the message as the body with Title and Tags headers, for a topic URL
+func newRequest(ctx context.Context, format, url string, a Alert) (*http.Request, error) {
+	var body interface{}
+	switch format {
+	case "slack":
+		body = map[string]string{"text": message(a)}
+	case "discord":
+		body = map[string]string{"content": message(a)}
+	case "ntfy":
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(a.Summary))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		req.Header.Set("Title", title(a))
+		if a.Status == StatusFiring {
+			req.Header.Set("Tags", "warning")
+		} else {
+			req.Header.Set("Tags", "white_check_mark")
+		}
+		return req, nil
+	default:
+		body = a
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// title returns a short heading for an alert, e.g. "[FIRING] slow-link on bridge-50"
+func title(a Alert) string {
+	return fmt.Sprintf("[%s] %s on %s", strings.ToUpper(a.Status), a.Rule, a.Device)
+}
+
+// message returns the text of an alert for chat receivers
+func message(a Alert) string {
+	return title(a) + ": " + a.Summary
+}
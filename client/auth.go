@@ -0,0 +1,344 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// DefaultSessionPath is the page a client fetches to open a session, which sets the
+// CSRF cookie on goCoax adapters
+const DefaultSessionPath = "/phyRates.html"
+
+// Defaults of FormAuth and ChallengeAuth
+const (
+	DefaultLoginPath     = "/login.cgi"
+	DefaultChallengePath = "/challenge.cgi"
+	DefaultUsernameField = "username"
+	DefaultPasswordField = "password"
+)
+
+// Session is the connection to an adapter that an Authenticator logs into. Cookies the
+// adapter sets are kept in the jar of HTTPClient and sent with every request.
+type Session struct {
+	BaseURL    string // e.g. http://192.168.98.50:80
+	HTTPClient *http.Client
+	Username   string
+	Password   string
+	Path       string      // Page that opens a session, DefaultSessionPath by default
+	Logger     *log.Logger // Debug output, DebugOutput if nil
+}
+
+// debugf writes a line of debug output; see WithLogger
+func (s *Session) debugf(format string, args ...any) {
+	debugf(s.Logger, format, args...)
+}
+
+// url returns the URL of a path on the adapter
+func (s *Session) url(path string) string {
+	return s.BaseURL + path
+}
+
+// get fetches a page of the adapter, with authorize applied if it is not nil, and
+// returns the response with its body read
+func (s *Session) get(ctx context.Context, path string, authorize Authorizer) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.url(path), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if authorize != nil {
+		authorize(req)
+	}
+	return s.do(req)
+}
+
+// postForm posts a login form to the adapter and returns the response with its body
+// read
+func (s *Session) postForm(ctx context.Context, path string, form url.Values) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url(path), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return s.do(req)
+}
+
+// do sends a request and reads the response body
+func (s *Session) do(req *http.Request) (*http.Response, []byte, error) {
+	s.debugf("%s %s", req.Method, req.URL)
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return resp, body, nil
+}
+
+// open fetches the session page with authorize applied, which sets the CSRF cookie,
+// and checks that the adapter accepted the login. Adapters with a login form redirect
+// requests without a session away from the page, which they are checked for when
+// formLogin is set.
+func (s *Session) open(ctx context.Context, authorize Authorizer, formLogin bool) error {
+	resp, _, err := s.get(ctx, s.Path, authorize)
+	if err != nil {
+		return fmt.Errorf("session page request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("session init failed with status %d", resp.StatusCode)
+	}
+	if formLogin && resp.Request.URL.Path != pathOf(s.Path) {
+		return fmt.Errorf("login rejected: redirected to %s", resp.Request.URL.Path)
+	}
+
+	// Only the names of the cookies are logged, as they may carry the session
+	cookies := s.HTTPClient.Jar.Cookies(resp.Request.URL)
+	names := make([]string, len(cookies))
+	for i, cookie := range cookies {
+		names[i] = cookie.Name
+	}
+	s.debugf("Got %d cookies after init: %s", len(cookies), strings.Join(names, ", "))
+	return nil
+}
+
+// Authorizer adds the credentials of a session to a request to the adapter
+type Authorizer func(req *http.Request)
+
+// Authenticator logs into the web interface of an adapter. BasicAuth, FormAuth,
+// ChallengeAuth and AutoAuth cover the login flows of known firmware.
+type Authenticator interface {
+	// Login opens a session with the adapter and returns what must be added to each
+	// request of the session. It is called again when the adapter rejects a request,
+	// as it does once a session expires.
+	Login(ctx context.Context, s *Session) (Authorizer, error)
+}
+
+// BasicAuth sends the credentials with every request as HTTP basic authentication,
+// as goCoax firmware expects. It is the default.
+type BasicAuth struct{}
+
+// Login implements Authenticator
+func (BasicAuth) Login(ctx context.Context, s *Session) (Authorizer, error) {
+	authorize := func(req *http.Request) {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+	if err := s.open(ctx, authorize, false); err != nil {
+		return nil, err
+	}
+	return authorize, nil
+}
+
+// FormAuth posts the credentials to a login form once; the adapter answers with a
+// session cookie that is sent with the requests that follow
+type FormAuth struct {
+	Path          string // Path the form is posted to, DefaultLoginPath if empty
+	UsernameField string // DefaultUsernameField if empty
+	PasswordField string // DefaultPasswordField if empty
+}
+
+// Login implements Authenticator
+func (a FormAuth) Login(ctx context.Context, s *Session) (Authorizer, error) {
+	path := orDefault(a.Path, DefaultLoginPath)
+	form := url.Values{
+		orDefault(a.UsernameField, DefaultUsernameField): {s.Username},
+		orDefault(a.PasswordField, DefaultPasswordField): {s.Password},
+	}
+	if err := login(ctx, s, path, form); err != nil {
+		return nil, err
+	}
+	return noAuthorization, nil
+}
+
+// ChallengeAuth logs in without sending the password: it fetches a challenge from the
+// adapter and posts the SHA-256 of the challenge followed by the hex SHA-256 of the
+// password. The password is hashed the way the web UI's main.js hashes the admin
+// password it stores (see checkOldPwd). The challenge is the body of the response, or
+// the first value of its JSON data.
+type ChallengeAuth struct {
+	ChallengePath string // Path the challenge is fetched from, DefaultChallengePath if empty
+	Path          string // Path the login is posted to, DefaultLoginPath if empty
+	UsernameField string // DefaultUsernameField if empty
+	PasswordField string // DefaultPasswordField if empty
+}
+
+// Login implements Authenticator
+func (a ChallengeAuth) Login(ctx context.Context, s *Session) (Authorizer, error) {
+	challengePath := orDefault(a.ChallengePath, DefaultChallengePath)
+	resp, body, err := s.get(ctx, challengePath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login challenge: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("login challenge failed with status %d", resp.StatusCode)
+	}
+	challenge := parseChallenge(body)
+	if challenge == "" {
+		return nil, fmt.Errorf("empty login challenge from %s", challengePath)
+	}
+
+	path := orDefault(a.Path, DefaultLoginPath)
+	form := url.Values{
+		orDefault(a.UsernameField, DefaultUsernameField): {s.Username},
+		orDefault(a.PasswordField, DefaultPasswordField): {ChallengeResponse(challenge, s.Password)},
+	}
+	if err := login(ctx, s, path, form); err != nil {
+		return nil, err
+	}
+	return noAuthorization, nil
+}
+
+// ChallengeResponse returns the hex SHA-256 of challenge followed by the hex SHA-256 of
+// password, which ChallengeAuth posts in place of the password
+func ChallengeResponse(challenge, password string) string {
+	hashed := sha256.Sum256([]byte(password))
+	response := sha256.Sum256([]byte(challenge + hex.EncodeToString(hashed[:])))
+	return hex.EncodeToString(response[:])
+}
+
+// parseChallenge reads a login challenge: {"data":["<challenge>"]} like the device
+// API, or the plain response body
+func parseChallenge(body []byte) string {
+	var resp struct {
+		Data []string `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err == nil && len(resp.Data) > 0 {
+		return resp.Data[0]
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// login posts a login form and opens the session with the cookie it sets
+func login(ctx context.Context, s *Session, path string, form url.Values) error {
+	resp, _, err := s.postForm(ctx, path, form)
+	if err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("login failed with status %d", resp.StatusCode)
+	}
+	return s.open(ctx, nil, true)
+}
+
+// noAuthorization is the Authorizer of sessions carried by cookies alone
+func noAuthorization(*http.Request) {}
+
+// AutoAuth detects the login flow of an adapter from its session page each time it
+// logs in; see DetectAuthenticator
+type AutoAuth struct{}
+
+// Login implements Authenticator
+func (AutoAuth) Login(ctx context.Context, s *Session) (Authorizer, error) {
+	auth, err := DetectAuthenticator(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	return auth.Login(ctx, s)
+}
+
+var (
+	formTagRE  = regexp.MustCompile(`(?is)<form\b[^>]*>`)
+	inputTagRE = regexp.MustCompile(`(?is)<input\b[^>]*>`)
+	attrRE     = regexp.MustCompile(`(?is)\b([a-z-]+)\s*=\s*["']([^"']*)["']`)
+	hashHintRE = regexp.MustCompile(`(?i)sha-?256|challenge`)
+)
+
+// DetectAuthenticator fetches the session page without credentials and picks the
+// login flow from the answer: an adapter that asks for credentials (401) uses basic
+// authentication, and one that shows a login form uses FormAuth, or ChallengeAuth when
+// the page hashes the password with SHA-256. The form's action and field names are
+// taken from the page. A page shown without a login is taken as basic authentication.
+func DetectAuthenticator(ctx context.Context, s *Session) (Authenticator, error) {
+	resp, body, err := s.get(ctx, s.Path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect login: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		s.debugf("Detected basic authentication")
+		return BasicAuth{}, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("failed to detect login: status %d", resp.StatusCode)
+	}
+
+	form, ok := parseLoginForm(body, resp.Request.URL)
+	if !ok {
+		s.debugf("No login form, using basic authentication")
+		return BasicAuth{}, nil
+	}
+	if hashHintRE.Match(body) {
+		s.debugf("Detected challenge login posted to %s", form.Path)
+		return ChallengeAuth{Path: form.Path, UsernameField: form.UsernameField, PasswordField: form.PasswordField}, nil
+	}
+	s.debugf("Detected form login posted to %s", form.Path)
+	return form, nil
+}
+
+// parseLoginForm finds a form with a password field in a page at pageURL
+func parseLoginForm(page []byte, pageURL *url.URL) (FormAuth, bool) {
+	var form FormAuth
+	for _, tag := range inputTagRE.FindAll(page, -1) {
+		attrs := parseAttrs(tag)
+		switch strings.ToLower(attrs["type"]) {
+		case "password":
+			if form.PasswordField == "" {
+				form.PasswordField = attrs["name"]
+			}
+		case "", "text", "email":
+			if form.UsernameField == "" {
+				form.UsernameField = attrs["name"]
+			}
+		}
+	}
+	if form.PasswordField == "" {
+		return FormAuth{}, false
+	}
+
+	// A form without an action posts to its own page
+	form.Path = pageURL.RequestURI()
+	if tag := formTagRE.Find(page); tag != nil {
+		if action, ok := parseAttrs(tag)["action"]; ok && action != "" {
+			if u, err := pageURL.Parse(action); err == nil {
+				form.Path = u.RequestURI()
+			}
+		}
+	}
+	return form, true
+}
+
+// parseAttrs returns the attributes of an HTML tag, with lower case names
+func parseAttrs(tag []byte) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range attrRE.FindAllSubmatch(tag, -1) {
+		attrs[strings.ToLower(string(m[1]))] = string(m[2])
+	}
+	return attrs
+}
+
+// pathOf returns a path without its query
+func pathOf(path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	return path
+}
+
+// orDefault returns s, or def if s is empty
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
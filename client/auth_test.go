@@ -0,0 +1,294 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// authDevice stands in for adapters with each login flow: basic authentication, a
+// login form, or a login form that hashes the password with a challenge. The form
+// posts to /cgi-bin/login with fields user and pass.
+type authDevice struct {
+	flow string // basic, form or challenge
+
+	mu        sync.Mutex
+	sessions  map[string]bool
+	logins    int
+	passwords []string // password fields posted to the login form
+}
+
+const (
+	authUser      = "admin"
+	authPassword  = "secret"
+	authChallenge = "4f2a9c"
+)
+
+func newAuthDevice(t *testing.T, flow string) (*authDevice, string) {
+	t.Helper()
+
+	d := &authDevice{flow: flow, sessions: make(map[string]bool)}
+	server := httptest.NewServer(d)
+	t.Cleanup(server.Close)
+	return d, strings.TrimPrefix(server.URL, "http://")
+}
+
+func (d *authDevice) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/phyRates.html":
+		if !d.authorized(r) {
+			d.reject(w, r)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "XSRF-TOKEN", Value: "token"})
+		fmt.Fprint(w, "<html>PHY rates</html>")
+	case "/login.html":
+		script := ""
+		if d.flow == "challenge" {
+			script = `<script src="sha256.js"></script>`
+		}
+		fmt.Fprintf(w, `<html>%s<form method="post" action="/cgi-bin/login">
+<input type="text" name="user"><input type="password" name="pass"></form></html>`, script)
+	case "/cgi-bin/challenge":
+		fmt.Fprintf(w, `{"data":["%s"]}`, authChallenge)
+	case "/cgi-bin/login":
+		d.login(w, r)
+	case "/ms/0/0x15":
+		if !d.authorized(r) {
+			d.reject(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"data":["0x00000002","0x00000000"]}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authorized checks the credentials of a request
+func (d *authDevice) authorized(r *http.Request) bool {
+	if d.flow == "basic" {
+		user, password, ok := r.BasicAuth()
+		return ok && user == authUser && password == authPassword
+	}
+
+	cookie, err := r.Cookie("session")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return err == nil && d.sessions[cookie.Value]
+}
+
+// reject answers a request without valid credentials
+func (d *authDevice) reject(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case d.flow == "basic":
+		w.Header().Set("WWW-Authenticate", `Basic realm="goCoax"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	case strings.HasPrefix(r.URL.Path, "/ms/"):
+		w.WriteHeader(http.StatusForbidden)
+	default:
+		http.Redirect(w, r, "/login.html", http.StatusFound)
+	}
+}
+
+// login checks a posted login form and starts a session
+func (d *authDevice) login(w http.ResponseWriter, r *http.Request) {
+	user, password := r.PostFormValue("user"), r.PostFormValue("pass")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.passwords = append(d.passwords, password)
+
+	want := authPassword
+	if d.flow == "challenge" {
+		want = ChallengeResponse(authChallenge, authPassword)
+	}
+	if user != authUser || password != want {
+		http.Redirect(w, r, "/login.html", http.StatusFound)
+		return
+	}
+
+	d.logins++
+	session := fmt.Sprintf("s%d", d.logins)
+	d.sessions[session] = true
+	http.SetCookie(w, &http.Cookie{Name: "session", Value: session, Path: "/"})
+	http.Redirect(w, r, "/phyRates.html", http.StatusFound)
+}
+
+// expire ends all sessions
+func (d *authDevice) expire() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sessions = make(map[string]bool)
+}
+
+func TestAuthenticators(t *testing.T) {
+	form := FormAuth{Path: "/cgi-bin/login", UsernameField: "user", PasswordField: "pass"}
+	challenge := ChallengeAuth{ChallengePath: "/cgi-bin/challenge", Path: "/cgi-bin/login", UsernameField: "user", PasswordField: "pass"}
+
+	tests := []struct {
+		flow string
+		auth Authenticator
+	}{
+		{flow: "basic", auth: BasicAuth{}},
+		{flow: "form", auth: form},
+		{flow: "challenge", auth: challenge},
+		{flow: "basic", auth: AutoAuth{}},
+		{flow: "form", auth: AutoAuth{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%T", tt.flow, tt.auth), func(t *testing.T) {
+			_, address := newAuthDevice(t, tt.flow)
+
+			c, err := New(context.Background(), address, WithCredentials(authUser, authPassword), WithAuthenticator(tt.auth), WithTimeout(5*time.Second))
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			defer c.Close()
+
+			words, err := c.GetWords(context.Background(), "/ms/0/0x15", nil)
+			if err != nil {
+				t.Fatalf("GetWords failed: %v", err)
+			}
+			if len(words) != 2 || words[0] != 2 {
+				t.Errorf("Expected words [2 0], got %v", words)
+			}
+
+			// A wrong password is rejected when the session is opened
+			if _, err := New(context.Background(), address, WithCredentials(authUser, "wrong"), WithAuthenticator(tt.auth)); err == nil {
+				t.Error("Expected login with a wrong password to fail")
+			}
+		})
+	}
+}
+
+func TestChallengeAuthHidesPassword(t *testing.T) {
+	d, address := newAuthDevice(t, "challenge")
+
+	auth := ChallengeAuth{ChallengePath: "/cgi-bin/challenge", Path: "/cgi-bin/login", UsernameField: "user", PasswordField: "pass"}
+	c, err := New(context.Background(), address, WithCredentials(authUser, authPassword), WithAuthenticator(auth))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer c.Close()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, password := range d.passwords {
+		if password == authPassword {
+			t.Error("Expected the password to be hashed, got it in plain text")
+		}
+	}
+}
+
+func TestDetectAuthenticator(t *testing.T) {
+	tests := []struct {
+		flow string
+		want Authenticator
+	}{
+		{flow: "basic", want: BasicAuth{}},
+		{flow: "form", want: FormAuth{Path: "/cgi-bin/login", UsernameField: "user", PasswordField: "pass"}},
+		{flow: "challenge", want: ChallengeAuth{Path: "/cgi-bin/login", UsernameField: "user", PasswordField: "pass"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flow, func(t *testing.T) {
+			_, address := newAuthDevice(t, tt.flow)
+			jar, _ := cookiejar.New(nil)
+			s := &Session{BaseURL: "http://" + address, HTTPClient: &http.Client{Jar: jar}, Path: DefaultSessionPath}
+
+			got, err := DetectAuthenticator(context.Background(), s)
+			if err != nil {
+				t.Fatalf("DetectAuthenticator failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	d, address := newAuthDevice(t, "form")
+
+	c, err := New(context.Background(), address, WithCredentials(authUser, authPassword), WithAuthenticator(AutoAuth{}))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer c.Close()
+
+	// The adapter forgets the session; the client logs in again and resends
+	d.expire()
+	if _, err := c.GetWords(context.Background(), "/ms/0/0x15", nil); err != nil {
+		t.Fatalf("GetWords after the session expired failed: %v", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.logins != 2 {
+		t.Errorf("Expected 2 logins, got %d", d.logins)
+	}
+}
+
+func TestLoggerHidesCookieValues(t *testing.T) {
+	_, address := newAuthDevice(t, "form")
+
+	var out bytes.Buffer
+	auth := FormAuth{Path: "/cgi-bin/login", UsernameField: "user", PasswordField: "pass"}
+	c, err := New(context.Background(), address, WithCredentials(authUser, authPassword), WithAuthenticator(auth),
+		WithLogger(log.New(&out, "", 0)))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer c.Close()
+
+	if !strings.Contains(out.String(), "[DEBUG] Got 2 cookies after init: session, XSRF-TOKEN\n") {
+		t.Errorf("Expected the session cookie's name in the debug output, got:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "=s1") || strings.Contains(out.String(), "=token") || strings.Contains(out.String(), authPassword) {
+		t.Errorf("Expected no cookie values or passwords in the debug output, got:\n%s", out.String())
+	}
+}
+
+func TestParseLoginForm(t *testing.T) {
+	page, _ := url.Parse("http://adapter/admin/index.html")
+
+	tests := []struct {
+		name string
+		html string
+		want FormAuth
+		ok   bool
+	}{
+		{
+			name: "relative action",
+			html: `<FORM Action='login.cgi'><input name="usr" type="text"><INPUT TYPE="PASSWORD" NAME="pwd"></FORM>`,
+			want: FormAuth{Path: "/admin/login.cgi", UsernameField: "usr", PasswordField: "pwd"},
+			ok:   true,
+		},
+		{
+			name: "no action",
+			html: `<form><input name="u"><input type="password" name="p"></form>`,
+			want: FormAuth{Path: "/admin/index.html", UsernameField: "u", PasswordField: "p"},
+			ok:   true,
+		},
+		{name: "no password field", html: `<form action="/search"><input name="q"></form>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseLoginForm([]byte(tt.html), page)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("Expected %#v, %v, got %#v, %v", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
@@ -4,23 +4,62 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/http/cookiejar"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
+// DebugOutput receives the debug output of requests and responses of clients without
+// their own logger; see WithLogger. It is discarded by default.
+var DebugOutput io.Writer = io.Discard
+
+// debugf writes a line of debug output to logger, or to DebugOutput if it is nil
+func debugf(logger *log.Logger, format string, args ...any) {
+	if logger != nil {
+		logger.Printf("[DEBUG] "+format, args...)
+		return
+	}
+	fmt.Fprintf(DebugOutput, "[DEBUG] "+format+"\n", args...)
+}
+
 // Client represents a goCoax device HTTP client
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
 	username   string
 	password   string
+
+	// profile locates the adapter's endpoints and fields; auth logs into it, and
+	// authorize adds the credentials of the session to each request
+	profile   Profile
+	auth      Authenticator
+	authorize Authorizer
+	logger    *log.Logger // debug output, DebugOutput if nil
+
+	// Requests to the device are serialised through queue, at least
+	// minRequestInterval apart
+	queue              chan struct{}
+	minRequestInterval time.Duration
+	lastRequest        time.Time // guarded by queue
 }
 
-// NewClient creates a new goCoax device client
+// NewClient creates a new goCoax device client. It is New with credentials and a
+// timeout.
 func NewClient(address, username, password string, timeout time.Duration) (*Client, error) {
+	return New(context.Background(), address, WithCredentials(username, password), WithTimeout(timeout))
+}
+
+// New creates a client for the adapter at address, host:port, and opens a session with
+// it. ctx bounds opening the session, as does the client's timeout.
+func New(ctx context.Context, address string, opts ...Option) (*Client, error) {
 	// Create cookie jar for session management (CSRF tokens, etc.)
 	jar, err := cookiejar.New(nil)
 	if err != nil {
@@ -32,54 +71,51 @@ func NewClient(address, username, password string, timeout time.Duration) (*Clie
 	client := &Client{
 		baseURL: baseURL,
 		httpClient: &http.Client{
-			Timeout: timeout,
+			Timeout: DefaultTimeout,
 			Jar:     jar,
 		},
-		username: username,
-		password: password,
+		username: DefaultUsername,
+		password: DefaultPassword,
+		profile:  GoCoaxProfile,
+		queue:    make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	if client.auth == nil {
+		client.auth = client.profile.Auth
+	}
+	if client.auth == nil {
+		client.auth = BasicAuth{}
 	}
 
-	// Initialize session by fetching the main page to get CSRF token
-	if err := client.initSession(); err != nil {
+	// Log in, which opens a session and gets the CSRF token
+	if timeout := client.httpClient.Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err := client.initSession(ctx); err != nil {
 		return nil, fmt.Errorf("failed to initialize session: %w", err)
 	}
 
 	return client, nil
 }
 
-// initSession initializes the session by fetching a page to get CSRF token
-func (c *Client) initSession() error {
-	ctx, cancel := context.WithTimeout(context.Background(), c.httpClient.Timeout)
-	defer cancel()
-
-	// GET the phyRates page to get CSRF token cookie
-	url := fmt.Sprintf("%s/phyRates.html", c.baseURL)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create init request: %w", err)
-	}
-
-	req.SetBasicAuth(c.username, c.password)
-
-	fmt.Printf("[DEBUG] Initializing session with GET %s\n", url)
-
-	resp, err := c.httpClient.Do(req)
+// initSession logs into the adapter, which opens a session and sets the CSRF cookie
+func (c *Client) initSession(ctx context.Context) error {
+	authorize, err := c.auth.Login(ctx, &Session{
+		BaseURL:    c.baseURL,
+		HTTPClient: c.httpClient,
+		Username:   c.username,
+		Password:   c.password,
+		Path:       c.profile.SessionPath,
+		Logger:     c.logger,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to initialize session: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("session init failed with status %d", resp.StatusCode)
-	}
-
-	// Check if we got a CSRF token cookie
-	cookies := c.httpClient.Jar.Cookies(req.URL)
-	fmt.Printf("[DEBUG] Got %d cookies after init\n", len(cookies))
-	for _, cookie := range cookies {
-		fmt.Printf("[DEBUG] Cookie: %s=%s\n", cookie.Name, cookie.Value)
-	}
-
+	c.authorize = authorize
 	return nil
 }
 
@@ -107,6 +143,7 @@ type LocalInfo struct {
 type NetworkNodeInfo struct {
 	NodeID      int
 	MocaVersion int
+	MACAddress  string // e.g. "00:12:ab:00:cd:00"
 	RawData     []int
 }
 
@@ -177,23 +214,90 @@ func (c *Client) doRequestWithRetry(ctx context.Context, endpoint string, payloa
 	return nil, fmt.Errorf("request failed after %d attempts: %w", maxRetries, lastErr)
 }
 
-// doRequest performs an HTTP POST request to the device API
+// SetMinRequestInterval sets the minimum time between the end of one request to the
+// device and the start of the next, for adapters whose web server fails under back-to-back requests.
+// It must be set before the client is used.
+func (c *Client) SetMinRequestInterval(d time.Duration) {
+	c.minRequestInterval = d
+}
+
+// acquire waits until no other request to the device is in progress and the minimum
+// interval since the previous one has passed. release must be called when done.
+func (c *Client) acquire(ctx context.Context) error {
+	select {
+	case c.queue <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if wait := c.minRequestInterval - time.Since(c.lastRequest); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			<-c.queue
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// release lets the next request to the device proceed
+func (c *Client) release() {
+	c.lastRequest = time.Now()
+	<-c.queue
+}
+
+// doRequest performs an HTTP POST request to the device API. Requests from concurrent
+// callers are sent one at a time.
 func (c *Client) doRequest(ctx context.Context, endpoint string, payload interface{}) ([]byte, error) {
+	if err := c.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.release()
+
+	body, status, err := c.send(ctx, endpoint, payload)
+	if err == nil && (status == http.StatusUnauthorized || status == http.StatusForbidden) {
+		// Adapters with session logins reject requests once the session expires; log
+		// in again and resend
+		debugf(c.logger, "Request rejected with status %d, logging in again", status)
+		if err := c.initSession(ctx); err != nil {
+			return nil, fmt.Errorf("failed to log in again: %w", err)
+		}
+		body, status, err = c.send(ctx, endpoint, payload)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Check status code
+	if status != http.StatusOK {
+		debugf(c.logger, "Error response: status=%d, body=%s", status, string(body))
+		return nil, fmt.Errorf("unexpected status code %d: %s", status, string(body))
+	}
+
+	// Debug logging
+	debugf(c.logger, "Response (first 200 chars): %s", string(body[:min(200, len(body))]))
+
+	return body, nil
+}
+
+// send posts one request to the device API and returns the response body and status
+func (c *Client) send(ctx context.Context, endpoint string, payload interface{}) ([]byte, int, error) {
 	url := fmt.Sprintf("%s%s", c.baseURL, endpoint)
 
 	// Marshal payload to JSON
 	reqBody, err := json.Marshal(payload)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, 0, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// Debug logging
-	fmt.Printf("[DEBUG] Request to %s: %s\n", url, string(reqBody))
+	debugf(c.logger, "Request to %s: %s", url, string(reqBody))
 
 	// Create request
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers - device expects form-encoded, not JSON
@@ -201,15 +305,14 @@ func (c *Client) doRequest(ctx context.Context, endpoint string, payload interfa
 	req.Header.Set("Accept", "text/html, */*")
 
 	// Debug: Log headers
-	fmt.Printf("[DEBUG] Content-Type: %s\n", req.Header.Get("Content-Type"))
+	debugf(c.logger, "Content-Type: %s", req.Header.Get("Content-Type"))
 
-	// Set basic auth
-	req.SetBasicAuth(c.username, c.password)
-	fmt.Printf("[DEBUG] Using Basic Auth with username: %s\n", c.username)
+	// Add the session's credentials
+	c.authorize(req)
 
 	// Extract CSRF token from cookies if present
 	for _, cookie := range c.httpClient.Jar.Cookies(req.URL) {
-		if cookie.Name == "XSRF-TOKEN" || cookie.Name == "csrf_token" {
+		if slices.Contains(c.profile.CSRFCookies, cookie.Name) {
 			req.Header.Set("X-CSRF-TOKEN", cookie.Value)
 			break
 		}
@@ -218,26 +321,75 @@ func (c *Client) doRequest(ctx context.Context, endpoint string, payload interfa
 	// Perform request
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, 0, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Read response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, 0, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("[DEBUG] Error response: status=%d, body=%s\n", resp.StatusCode, string(body))
-		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+	return body, resp.StatusCode, nil
+}
+
+// decodeHexWords parses a device response of the form {"data":["0x00000001", ...]}
+// into 32-bit words. Values that do not fit in 32 bits are rejected.
+func decodeHexWords(body []byte) ([]uint32, error) {
+	values, err := decodeHexValues(body, 32)
+	if err != nil {
+		return nil, err
 	}
 
-	// Debug logging
-	fmt.Printf("[DEBUG] Response (first 200 chars): %s\n", string(body[:min(200, len(body))]))
+	data := make([]uint32, len(values))
+	for i, v := range values {
+		data[i] = uint32(v)
+	}
+	return data, nil
+}
 
-	return body, nil
+// decodeHexCounters parses a device response whose values may be 64-bit, such as
+// "0x1000000A4" (split64Hex in main.js splits these into high and low words)
+func decodeHexCounters(body []byte) ([]uint64, error) {
+	return decodeHexValues(body, 64)
+}
+
+// decodeHexValues parses the hex strings of a device response into values of at most
+// bitSize bits
+func decodeHexValues(body []byte, bitSize int) ([]uint64, error) {
+	var apiResp apiResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	var dataStrings []string
+	if err := json.Unmarshal(apiResp.Data, &dataStrings); err != nil {
+		return nil, fmt.Errorf("failed to parse data array: %w", err)
+	}
+
+	data := make([]uint64, len(dataStrings))
+	for i, str := range dataStrings {
+		if !strings.HasPrefix(str, "0x") && !strings.HasPrefix(str, "0X") {
+			return nil, fmt.Errorf("failed to parse hex value %s: missing 0x prefix", str)
+		}
+		val, err := strconv.ParseUint(str[2:], 16, bitSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse hex value %s: %w", str, err)
+		}
+		data[i] = val
+	}
+
+	return data, nil
+}
+
+// wordsToInts converts decoded words to ints for the info structures
+func wordsToInts(words []uint32) []int {
+	data := make([]int, len(words))
+	for i, w := range words {
+		data[i] = int(w)
+	}
+	return data
 }
 
 func min(a, b int) int {
@@ -247,52 +399,38 @@ func min(a, b int) int {
 	return b
 }
 
-// GetLocalInfo retrieves local device information (endpoint 0x15)
+// GetLocalInfo retrieves local device information (endpoint 0x15 on goCoax)
 func (c *Client) GetLocalInfo(ctx context.Context) (*LocalInfo, error) {
 	// The endpoint expects {"data":[]} format
 	payload := map[string]interface{}{
 		"data": []interface{}{},
 	}
 
-	body, err := c.doRequestWithRetry(ctx, "/ms/0/0x15", payload)
+	layout := c.profile.LocalInfo
+	body, err := c.doRequestWithRetry(ctx, layout.Endpoint, payload)
 	if err != nil {
 		return nil, fmt.Errorf("GetLocalInfo request failed: %w", err)
 	}
 
-	// Parse response
-	var apiResp apiResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
-	}
-
 	// Parse data array - device returns hex strings like "0x00000001"
-	var dataStrings []string
-	if err := json.Unmarshal(apiResp.Data, &dataStrings); err != nil {
-		return nil, fmt.Errorf("failed to parse data array: %w", err)
-	}
-
-	// Convert hex strings to integers
-	data := make([]int, len(dataStrings))
-	for i, str := range dataStrings {
-		var val int64
-		_, err := fmt.Sscanf(str, "0x%x", &val)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse hex value %s: %w", str, err)
-		}
-		data[i] = int(val)
+	words, err := decodeHexWords(body)
+	if err != nil {
+		return nil, err
 	}
+	data := wordsToInts(words)
 
-	// Validate data length (should have at least 13 elements based on JavaScript)
-	if len(data) < 13 {
-		return nil, fmt.Errorf("insufficient data elements: got %d, expected at least 13", len(data))
+	// Validate data length (goCoax answers with at least 13 elements based on JavaScript)
+	if len(data) < layout.minWords() {
+		return nil, fmt.Errorf("insufficient data elements: got %d, expected at least %d", len(data), layout.minWords())
 	}
 
 	// Parse according to JavaScript: LocalInfo[0]=myNodeID, [1]=NCNodeID, [11]=mocaNetVer, [12]=nodeBitMask
+	// on goCoax, at the offsets of the profile
 	localInfo := &LocalInfo{
-		MyNodeID:       data[0],
-		NCNodeID:       data[1] & 0xFF, // NC node ID is in lower byte
-		MocaNetVersion: data[11],
-		NodeBitMask:    data[12],
+		MyNodeID:       data[layout.MyNodeID],
+		NCNodeID:       data[layout.NCNodeID] & 0xFF, // NC node ID is in lower byte
+		MocaNetVersion: data[layout.MocaNetVersion],
+		NodeBitMask:    data[layout.NodeBitMask],
 		RawData:        data,
 	}
 
@@ -302,96 +440,159 @@ func (c *Client) GetLocalInfo(ctx context.Context) (*LocalInfo, error) {
 	return localInfo, nil
 }
 
-// GetNetworkNodeInfo retrieves information about a specific network node (endpoint 0x16)
+// GetNetworkNodeInfo retrieves information about a specific network node (endpoint
+// 0x16 on goCoax)
 func (c *Client) GetNetworkNodeInfo(ctx context.Context, nodeID int) (*NetworkNodeInfo, error) {
 	// The endpoint expects the node ID as data array: {"data":[nodeID]}
 	payload := map[string]interface{}{
 		"data": []interface{}{nodeID},
 	}
 
-	body, err := c.doRequestWithRetry(ctx, "/ms/0/0x16", payload)
+	layout := c.profile.NodeInfo
+	body, err := c.doRequestWithRetry(ctx, layout.Endpoint, payload)
 	if err != nil {
 		return nil, fmt.Errorf("GetNetworkNodeInfo request failed: %w", err)
 	}
 
-	// Parse response
-	var apiResp apiResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
-	}
-
 	// Parse data array - device returns hex strings
-	var dataStrings []string
-	if err := json.Unmarshal(apiResp.Data, &dataStrings); err != nil {
-		return nil, fmt.Errorf("failed to parse data array: %w", err)
-	}
-
-	// Convert hex strings to integers
-	data := make([]int, len(dataStrings))
-	for i, str := range dataStrings {
-		var val int64
-		_, err := fmt.Sscanf(str, "0x%x", &val)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse hex value %s: %w", str, err)
-		}
-		data[i] = int(val)
+	words, err := decodeHexWords(body)
+	if err != nil {
+		return nil, err
 	}
+	data := wordsToInts(words)
 
-	// Validate data length (should have at least 5 elements based on JavaScript usage)
-	if len(data) < 5 {
-		return nil, fmt.Errorf("insufficient data elements: got %d, expected at least 5", len(data))
+	// Validate data length (goCoax answers with at least 5 elements based on JavaScript usage)
+	if len(data) < layout.minWords() {
+		return nil, fmt.Errorf("insufficient data elements: got %d, expected at least %d", len(data), layout.minWords())
 	}
 
-	// Parse according to JavaScript: netInfo[nodeId][4] contains MoCA version
+	// Parse according to JavaScript: netInfo[nodeId][4] contains MoCA version on goCoax
 	nodeInfo := &NetworkNodeInfo{
 		NodeID:      nodeID,
-		MocaVersion: data[4] & 0xFF, // MoCA version is in lower byte
+		MocaVersion: data[layout.MocaVersion] & 0xFF, // MoCA version is in lower byte
+		MACAddress:  formatMAC(words[layout.MACHigh], words[layout.MACLow]),
 		RawData:     data,
 	}
 
 	return nodeInfo, nil
 }
 
-// GetFMRInfo retrieves Frame Management Request information (endpoint 0x1D)
+// formatMAC formats the node's MAC address, held in the first four bytes of hi and the
+// upper two bytes of lo
+func formatMAC(hi, lo uint32) string {
+	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x",
+		byte(hi>>24), byte(hi>>16), byte(hi>>8), byte(hi), byte(lo>>24), byte(lo>>16))
+}
+
+// GetFMRInfo retrieves Frame Management Request information (endpoint 0x1D on goCoax)
 func (c *Client) GetFMRInfo(ctx context.Context, nodeMask, version int) (*FMRInfo, error) {
 	// The endpoint expects both values in data array: {"data":[nodeMask, version]}
 	payload := map[string]interface{}{
 		"data": []interface{}{nodeMask, version},
 	}
 
-	body, err := c.doRequestWithRetry(ctx, "/ms/0/0x1D", payload)
+	body, err := c.doRequestWithRetry(ctx, c.profile.FMREndpoint, payload)
 	if err != nil {
 		return nil, fmt.Errorf("GetFMRInfo request failed: %w", err)
 	}
 
-	// Parse response
-	var apiResp apiResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	// Parse data array - device returns hex strings
+	data, err := decodeHexWords(body)
+	if err != nil {
+		return nil, err
 	}
 
-	// Parse data array - device returns hex strings
-	var dataStrings []string
-	if err := json.Unmarshal(apiResp.Data, &dataStrings); err != nil {
-		return nil, fmt.Errorf("failed to parse data array: %w", err)
+	fmrInfo := &FMRInfo{
+		Data: data,
 	}
 
-	// Convert hex strings to uint32
-	data := make([]uint32, len(dataStrings))
-	for i, str := range dataStrings {
-		var val uint64
-		_, err := fmt.Sscanf(str, "0x%x", &val)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse hex value %s: %w", str, err)
+	return fmrInfo, nil
+}
+
+// FMRBlockWords is the length of one node's FMR response as phyRates.html reads it: a
+// 10-word header, the entries for all 16 destination nodes and the mixed-mode GCD word.
+// That a multi-node response is one such block per node is an assumption; no adapter
+// has been recorded answering one.
+const FMRBlockWords = 40
+
+// ErrFMRLayout is returned when a multi-node FMR response is not one block per node
+var ErrFMRLayout = errors.New("unexpected FMR response layout")
+
+// GetFMRInfoNodes retrieves FMR information for several nodes in one request, with all
+// of them set in the node mask, and splits the response into one FMRInfo per node.
+// The device is assumed to answer with one FMRBlockWords block per node in ascending
+// node order; other responses fail with ErrFMRLayout. The web UI only ever requests
+// one node, so GetFMRInfo is the verified way to read FMR.
+func (c *Client) GetFMRInfoNodes(ctx context.Context, nodeIDs []int, version int) (map[int]*FMRInfo, error) {
+	nodeMask := 0
+	for _, nodeID := range nodeIDs {
+		nodeMask |= 1 << nodeID
+	}
+
+	info, err := c.GetFMRInfo(ctx, nodeMask, version)
+	if err != nil {
+		return nil, err
+	}
+	return SplitFMRInfo(info, nodeMask)
+}
+
+// SplitFMRInfo splits a multi-node FMR response into the payload of each node in the
+// mask. A response for a single node is returned as is.
+func SplitFMRInfo(info *FMRInfo, nodeMask int) (map[int]*FMRInfo, error) {
+	var nodeIDs []int
+	for nodeID := 0; nodeID < 16; nodeID++ {
+		if nodeMask&(1<<nodeID) != 0 {
+			nodeIDs = append(nodeIDs, nodeID)
 		}
-		data[i] = uint32(val)
 	}
 
-	fmrInfo := &FMRInfo{
-		Data: data,
+	if len(nodeIDs) == 1 {
+		return map[int]*FMRInfo{nodeIDs[0]: info}, nil
+	}
+	if len(info.Data) != len(nodeIDs)*FMRBlockWords {
+		return nil, fmt.Errorf("%w: %d words for %d nodes", ErrFMRLayout, len(info.Data), len(nodeIDs))
 	}
 
-	return fmrInfo, nil
+	split := make(map[int]*FMRInfo, len(nodeIDs))
+	for i, nodeID := range nodeIDs {
+		split[nodeID] = &FMRInfo{Data: info.Data[i*FMRBlockWords : (i+1)*FMRBlockWords]}
+	}
+	return split, nil
+}
+
+// GetWords calls an endpoint of the device API, such as /ms/0/0x14, with the given
+// request data and returns the 32-bit words of the response
+func (c *Client) GetWords(ctx context.Context, endpoint string, data []int) ([]uint32, error) {
+	if data == nil {
+		data = []int{}
+	}
+	payload := map[string]interface{}{
+		"data": data,
+	}
+
+	body, err := c.doRequestWithRetry(ctx, endpoint, payload)
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %w", endpoint, err)
+	}
+
+	return decodeHexWords(body)
+}
+
+// Reboot restarts the device (endpoint 0xb00 on goCoax, doReboot in the web UI). The request is
+// not retried. The device may drop the connection while it goes down, which is
+// treated as success.
+func (c *Client) Reboot(ctx context.Context) error {
+	// The web UI posts the first field of its action form; the device ignores it
+	payload := map[string]interface{}{
+		"data": []interface{}{},
+	}
+
+	_, err := c.doRequest(ctx, c.profile.RebootEndpoint, payload)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, syscall.ECONNRESET) {
+		return fmt.Errorf("Reboot request failed: %w", err)
+	}
+
+	return nil
 }
 
 // Close closes the HTTP client and releases resources
@@ -0,0 +1,535 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDecodeHexWords(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		expected    []uint32
+		expectError bool
+	}{
+		{
+			name:     "valid words",
+			body:     `{"data":["0x00000001","0xFFFFFFFF","0x0000abcd"]}`,
+			expected: []uint32{1, 0xFFFFFFFF, 0xabcd},
+		},
+		{
+			name:     "empty array",
+			body:     `{"data":[]}`,
+			expected: []uint32{},
+		},
+		{
+			name:        "value wider than 32 bits",
+			body:        `{"data":["0x100000000"]}`,
+			expectError: true,
+		},
+		{
+			name:        "missing prefix",
+			body:        `{"data":["12"]}`,
+			expectError: true,
+		},
+		{
+			name:        "not hex",
+			body:        `{"data":["0xzz"]}`,
+			expectError: true,
+		},
+		{
+			name:        "data is not an array of strings",
+			body:        `{"data":[1,2]}`,
+			expectError: true,
+		},
+		{
+			name:        "invalid JSON",
+			body:        `<html>`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			words, err := decodeHexWords([]byte(tt.body))
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("Expected error, got %v", words)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(words) != len(tt.expected) {
+				t.Fatalf("Expected %d words, got %d", len(tt.expected), len(words))
+			}
+			for i := range words {
+				if words[i] != tt.expected[i] {
+					t.Errorf("Word %d: expected %#x, got %#x", i, tt.expected[i], words[i])
+				}
+			}
+		})
+	}
+}
+
+// FuzzDecodeHexWords checks that arbitrary device output never panics the decoder and
+// that accepted words round-trip through the device's hex encoding
+func FuzzDecodeHexWords(f *testing.F) {
+	f.Add([]byte(`{"data":["0x00000001","0x00000003"]}`))
+	f.Add([]byte(`{"data":["0xFFFFFFFF"]}`))
+	f.Add([]byte(`{"data":["0x"]}`))
+	f.Add([]byte(`{"data":null}`))
+	f.Add([]byte(`{}`))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		words, err := decodeHexWords(body)
+		if err != nil {
+			return
+		}
+
+		encoded := make([]string, len(words))
+		for i, w := range words {
+			encoded[i] = fmt.Sprintf(`"0x%08x"`, w)
+		}
+		again, err := decodeHexWords([]byte(`{"data":[` + strings.Join(encoded, ",") + `]}`))
+		if err != nil {
+			t.Fatalf("re-encoded words failed to decode: %v", err)
+		}
+		for i := range words {
+			if again[i] != words[i] {
+				t.Fatalf("word %d: %#x != %#x", i, again[i], words[i])
+			}
+		}
+	})
+}
+
+// newTestClient creates a client against an httptest server standing in for a device
+func newTestClient(t testing.TB, handler http.Handler) *Client {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/phyRates.html", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.Handle("/ms/", handler)
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	c, err := NewClient(strings.TrimPrefix(server.URL, "http://"), "admin", "secret", 5*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+// FuzzGetFMRInfo serves arbitrary bodies from a stand-in device and checks that
+// GetFMRInfo either fails cleanly or returns the decoded words
+func FuzzGetFMRInfo(f *testing.F) {
+	f.Add(`{"data":["0x00000001","0x14102000"]}`)
+	f.Add(`{"data":["0x1","0x"]}`)
+	f.Add(`{"data":"0x1"}`)
+
+	var body string
+	c := newTestClient(f, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+
+	f.Fuzz(func(t *testing.T, b string) {
+		body = b
+		info, err := c.GetFMRInfo(context.Background(), 0x01, 2)
+		if err != nil {
+			return
+		}
+		words, err := decodeHexWords([]byte(b))
+		if err != nil {
+			t.Fatalf("GetFMRInfo accepted a body the decoder rejects: %v", err)
+		}
+		if len(info.Data) != len(words) {
+			t.Fatalf("expected %d words, got %d", len(words), len(info.Data))
+		}
+	})
+}
+
+func TestReboot(t *testing.T) {
+	var gotMethod, gotPath, gotBody string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotMethod, gotPath, gotBody = r.Method, r.URL.Path, string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	if err := c.Reboot(context.Background()); err != nil {
+		t.Fatalf("Reboot failed: %v", err)
+	}
+	if gotMethod != http.MethodPost || gotPath != "/ms/1/0xb00" {
+		t.Errorf("Expected POST /ms/1/0xb00, got %s %s", gotMethod, gotPath)
+	}
+	if gotBody != `{"data":[]}` {
+		t.Errorf("Unexpected body %s", gotBody)
+	}
+}
+
+func TestRebootConnectionDropped(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The device goes down without answering
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack failed: %v", err)
+			return
+		}
+		conn.Close()
+	}))
+
+	if err := c.Reboot(context.Background()); err != nil {
+		t.Errorf("Expected dropped connection to count as success, got %v", err)
+	}
+}
+
+func TestRebootRejected(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+
+	if err := c.Reboot(context.Background()); err == nil {
+		t.Error("Expected error for rejected reboot")
+	}
+}
+
+func TestDecodeASCIIWords(t *testing.T) {
+	tests := []struct {
+		name     string
+		words    []uint32
+		expected string
+	}{
+		{"NUL terminated", []uint32{0x312E302E, 0x39000000, 0x41414141}, "1.0.9"},
+		{"fills all words", []uint32{0x4D413235, 0x30304400}, "MA2500D"},
+		{"stops at non-ASCII", []uint32{0x4142FF43}, "AB"},
+		{"empty", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeASCIIWords(tt.words); got != tt.expected {
+				t.Errorf("decodeASCIIWords() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetDeviceStatus(t *testing.T) {
+	words := make([]string, 18)
+	for i := range words {
+		words[i] = "0x00000000"
+	}
+	// "1.0.9" firmware, "A1" hardware
+	words[0], words[1] = "0x312E302E", "0x39000000"
+	words[8] = "0x41310000"
+	words[12] = "0x00015180" // 1 day
+	words[13] = "0x000003E8" // 1000 Mbps
+	words[14] = "0x00000001"
+	words[15] = "0x00000488" // 1160 MHz
+	words[16] = "0x0000047E" // 1150 MHz
+	words[17] = "0x00000001"
+
+	var gotPath string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		fmt.Fprintf(w, `{"data":["%s"]}`, strings.Join(words, `","`))
+	}))
+
+	// The default profile does not read the status
+	if _, err := c.GetDeviceStatus(context.Background()); !errors.Is(err, ErrNoEndpoint) || gotPath != "" {
+		t.Fatalf("Expected ErrNoEndpoint without a request, got %v and a request to %q", err, gotPath)
+	}
+
+	c.profile.Status = DefaultStatusLayout
+	status, err := c.GetDeviceStatus(context.Background())
+	if err != nil {
+		t.Fatalf("GetDeviceStatus failed: %v", err)
+	}
+
+	if gotPath != DefaultStatusLayout.Endpoint {
+		t.Errorf("Expected request to %s, got %s", DefaultStatusLayout.Endpoint, gotPath)
+	}
+	if status.FirmwareVersion != "1.0.9" || status.HardwareRevision != "A1" {
+		t.Errorf("Unexpected firmware %q / hardware %q", status.FirmwareVersion, status.HardwareRevision)
+	}
+	if status.Uptime != 24*time.Hour {
+		t.Errorf("Expected uptime 24h, got %s", status.Uptime)
+	}
+	if status.EthernetSpeedMbps != 1000 || !status.LinkUp || !status.PrivacyEnabled {
+		t.Errorf("Unexpected link fields: %+v", status)
+	}
+	if status.LOFMHz != 1160 || status.FrequencyMHz != 1150 {
+		t.Errorf("Unexpected LOF %d / frequency %d", status.LOFMHz, status.FrequencyMHz)
+	}
+}
+
+func TestParseDeviceStatusRejectsOutOfBandFrequency(t *testing.T) {
+	data := make([]uint32, 18)
+	data[16] = 0xFFFFFFFF
+
+	status, err := parseDeviceStatus(data, DefaultStatusLayout)
+	if err != nil {
+		t.Fatalf("parseDeviceStatus failed: %v", err)
+	}
+	if status.FrequencyMHz != 0 {
+		t.Errorf("Expected out-of-band frequency to be unknown, got %d", status.FrequencyMHz)
+	}
+
+	if _, err := parseDeviceStatus(data[:10], DefaultStatusLayout); err == nil {
+		t.Error("Expected error for short response")
+	}
+}
+
+func TestGetDeviceStats(t *testing.T) {
+	words := make([]string, 14)
+	for i := range words {
+		words[i] = fmt.Sprintf("0x%X", i+1)
+	}
+	// 64-bit byte counter, split by split64Hex in the web UI
+	words[3] = "0x1000000A4"
+
+	requests := 0
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != DefaultStatsLayout.Endpoint {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"data":["%s"]}`, strings.Join(words, `","`))
+	}))
+
+	// The default profile does not read the counters
+	if _, err := c.GetDeviceStats(context.Background()); !errors.Is(err, ErrNoEndpoint) || requests != 0 {
+		t.Fatalf("Expected ErrNoEndpoint without a request, got %v after %d requests", err, requests)
+	}
+
+	c.profile.Stats = DefaultStatsLayout
+	stats, err := c.GetDeviceStats(context.Background())
+	if err != nil {
+		t.Fatalf("GetDeviceStats failed: %v", err)
+	}
+
+	if stats.Ethernet.TxPackets != 1 || stats.Ethernet.RxDropped != 7 {
+		t.Errorf("Unexpected Ethernet counters: %+v", stats.Ethernet)
+	}
+	if stats.Ethernet.RxBytes != 0x1000000A4 {
+		t.Errorf("Expected 64-bit byte counter, got %#x", stats.Ethernet.RxBytes)
+	}
+	if stats.MoCA.TxPackets != 8 || stats.MoCA.RxDropped != 14 {
+		t.Errorf("Unexpected MoCA counters: %+v", stats.MoCA)
+	}
+
+	if _, err := parseDeviceStats(make([]uint64, 10), DefaultStatsLayout); err == nil {
+		t.Error("Expected error for short response")
+	}
+}
+
+func TestGetNetworkNodeInfo(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":["0x0012AB01","0xCD010000","0x00000000","0x00000000","0x00000025"]}`)
+	}))
+
+	info, err := c.GetNetworkNodeInfo(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("GetNetworkNodeInfo failed: %v", err)
+	}
+	if info.MocaVersion != 0x25 {
+		t.Errorf("Expected MoCA version 0x25, got %#x", info.MocaVersion)
+	}
+	if info.MACAddress != "00:12:ab:01:cd:01" {
+		t.Errorf("Expected MAC 00:12:ab:01:cd:01, got %s", info.MACAddress)
+	}
+}
+
+func TestGetFMRInfoNodes(t *testing.T) {
+	var request string
+	blocks := 2
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		request = string(body)
+
+		// Each block starts with the index of the block
+		words := make([]string, blocks*FMRBlockWords)
+		for i := range words {
+			words[i] = fmt.Sprintf("0x%X", i/FMRBlockWords)
+		}
+		fmt.Fprintf(w, `{"data":["%s"]}`, strings.Join(words, `","`))
+	}))
+
+	info, err := c.GetFMRInfoNodes(context.Background(), []int{5, 1}, 2)
+	if err != nil {
+		t.Fatalf("GetFMRInfoNodes failed: %v", err)
+	}
+	if request != `{"data":[34,2]}` {
+		t.Errorf("Expected node mask 34 in request, got %s", request)
+	}
+	if len(info) != 2 || info[1].Data[0] != 0 || info[5].Data[0] != 1 || len(info[5].Data) != FMRBlockWords {
+		t.Errorf("Unexpected split: %+v", info)
+	}
+
+	// One block for two nodes is not the expected layout
+	blocks = 1
+	if _, err := c.GetFMRInfoNodes(context.Background(), []int{1, 5}, 2); !errors.Is(err, ErrFMRLayout) {
+		t.Errorf("Expected ErrFMRLayout, got %v", err)
+	}
+
+	// A single node's response is returned whatever its length
+	if info, err := c.GetFMRInfoNodes(context.Background(), []int{3}, 2); err != nil || len(info[3].Data) != FMRBlockWords {
+		t.Errorf("Unexpected single-node result: %+v, %v", info, err)
+	}
+}
+
+func TestRequestQueue(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	var starts, ends []time.Time
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		starts = append(starts, time.Now())
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+		fmt.Fprint(w, `{"data":["0x00000001"]}`)
+
+		mu.Lock()
+		inFlight--
+		ends = append(ends, time.Now())
+		mu.Unlock()
+	}))
+	c.SetMinRequestInterval(20 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetFMRInfo(context.Background(), 1, 2); err != nil {
+				t.Errorf("GetFMRInfo failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight != 1 {
+		t.Errorf("Expected requests one at a time, got %d at once", maxInFlight)
+	}
+	for i := 1; i < len(starts); i++ {
+		if gap := starts[i].Sub(ends[i-1]); gap < 15*time.Millisecond {
+			t.Errorf("Request %d started %s after the previous one ended", i, gap)
+		}
+	}
+
+	// A caller waiting for the queue gives up with its context
+	c.queue <- struct{}{}
+	defer func() { <-c.queue }()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetFMRInfo(ctx, 1, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded while queued, got %v", err)
+	}
+}
+
+func TestNewOptions(t *testing.T) {
+	var mu sync.Mutex
+	var gotUser, gotPassword string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		gotUser, gotPassword, _ = r.BasicAuth()
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		user     string
+		password string
+		timeout  time.Duration
+		interval time.Duration
+	}{
+		{name: "defaults", user: DefaultUsername, password: DefaultPassword, timeout: DefaultTimeout},
+		{
+			name:     "options",
+			opts:     []Option{WithCredentials("user", "secret"), WithTimeout(3 * time.Second), WithMinRequestInterval(50 * time.Millisecond)},
+			user:     "user",
+			password: "secret",
+			timeout:  3 * time.Second,
+			interval: 50 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(context.Background(), address, tt.opts...)
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			defer c.Close()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if gotUser != tt.user || gotPassword != tt.password {
+				t.Errorf("Expected session opened as %s/%s, got %s/%s", tt.user, tt.password, gotUser, gotPassword)
+			}
+			if c.httpClient.Timeout != tt.timeout {
+				t.Errorf("Expected timeout %s, got %s", tt.timeout, c.httpClient.Timeout)
+			}
+			if c.minRequestInterval != tt.interval {
+				t.Errorf("Expected request interval %s, got %s", tt.interval, c.minRequestInterval)
+			}
+		})
+	}
+
+	// The context bounds opening the session
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := New(ctx, address); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestDescribeWords(t *testing.T) {
+	words := DescribeWords([]uint32{0x25, 0x80000001})
+	want := []Word{
+		{Index: 0, Hex: "0x00000025", Decimal: 37, Binary: "00000000 00000000 00000000 00100101"},
+		{Index: 1, Hex: "0x80000001", Decimal: 2147483649, Binary: "10000000 00000000 00000000 00000001"},
+	}
+	if len(words) != len(want) {
+		t.Fatalf("Expected %d words, got %d", len(want), len(words))
+	}
+	for i := range want {
+		if words[i] != want[i] {
+			t.Errorf("Word %d: expected %+v, got %+v", i, want[i], words[i])
+		}
+	}
+
+	for endpoint, read := range map[string]bool{
+		"/ms/0/0x16":  true,
+		"/ms/0/0x1D":  true,
+		"/ms/1/0xb00": false,
+		"/ms/0/22":    false,
+		"/ms/0/0x16/": false,
+	} {
+		if got := IsReadEndpoint(endpoint); got != read {
+			t.Errorf("IsReadEndpoint(%q) = %v, expected %v", endpoint, got, read)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+// Package client talks to the web API of goCoax MoCA adapters.
+//
+// New opens a session with an adapter. Each request method reads one page of data,
+// such as the local node's info, another node's info or the FMR data that PHY rates
+// are calculated from, and decodes the hex words the adapter answers with. Requests
+// from concurrent callers are sent to the adapter one at a time.
+//
+// goCoax adapters take HTTP basic authentication with every request. An Authenticator
+// set with WithAuthenticator logs into firmware with other login flows: FormAuth,
+// ChallengeAuth, or AutoAuth to detect the flow from the adapter's login page.
+//
+// Adapters of other vendors built on the same chipsets answer the same API with other
+// endpoints and fields; a Profile set with WithProfile describes them. GoCoaxProfile is
+// the default.
+//
+// The requests and responses of a client are logged to a logger set with WithLogger;
+// without one they go to DebugOutput, which discards them by default.
+package client
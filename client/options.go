@@ -0,0 +1,64 @@
+package client
+
+import (
+	"log"
+	"time"
+)
+
+// Defaults of a client created with New
+const (
+	DefaultUsername = "admin"
+	DefaultPassword = "gocoax"
+	DefaultTimeout  = 10 * time.Second
+)
+
+// Option configures a client created with New
+type Option func(*Client)
+
+// WithCredentials sets the username and password of the adapter's web interface,
+// admin and gocoax by default
+func WithCredentials(username, password string) Option {
+	return func(c *Client) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// WithAuthenticator sets how the client logs into the adapter, the profile's
+// authenticator or BasicAuth by default
+func WithAuthenticator(auth Authenticator) Option {
+	return func(c *Client) {
+		c.auth = auth
+	}
+}
+
+// WithProfile sets the interface of the adapter, GoCoaxProfile by default
+func WithProfile(profile Profile) Option {
+	return func(c *Client) {
+		c.profile = profile
+	}
+}
+
+// WithTimeout sets the timeout of each HTTP request to the adapter, 10 seconds by
+// default
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// WithMinRequestInterval sets the minimum time between requests to the adapter; see
+// SetMinRequestInterval
+func WithMinRequestInterval(d time.Duration) Option {
+	return func(c *Client) {
+		c.minRequestInterval = d
+	}
+}
+
+// WithLogger sends the client's debug output of requests and responses to logger
+// instead of DebugOutput
+func WithLogger(logger *log.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
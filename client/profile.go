@@ -0,0 +1,82 @@
+package client
+
+// Profile describes the management interface of a family of adapters. goCoax and other
+// MoCA adapters built on the same MaxLinear/Entropic chipsets answer the same /ms/
+// API, but may open a session on another page, name their CSRF cookie differently and
+// move endpoints and fields.
+type Profile struct {
+	Name           string
+	SessionPath    string        // Page that opens a session
+	CSRFCookies    []string      // Cookies whose value is sent as the X-CSRF-TOKEN header
+	Auth           Authenticator // Login flow; BasicAuth if nil
+	LocalInfo      LocalInfoLayout
+	NodeInfo       NodeInfoLayout
+	FMREndpoint    string // Takes {"data":[nodeMask, version]}
+	RebootEndpoint string
+	Status         StatusLayout // Not read without an endpoint
+	Stats          StatsLayout  // Not read without an endpoint
+}
+
+// LocalInfoLayout locates the local node's fields in the response of the local info
+// endpoint
+type LocalInfoLayout struct {
+	Endpoint       string
+	MyNodeID       int
+	NCNodeID       int // in the lower byte
+	MocaNetVersion int
+	NodeBitMask    int
+}
+
+// NodeInfoLayout locates a node's fields in the response of the node info endpoint,
+// which takes {"data":[nodeID]}
+type NodeInfoLayout struct {
+	Endpoint    string
+	MACHigh     int // first four bytes of the MAC address
+	MACLow      int // last two bytes of the MAC address, in the upper half
+	MocaVersion int // in the lower byte
+}
+
+// GoCoaxProfile is the interface of goCoax adapters, as read by the PHY Rates page of
+// their web UI (main.js). It is the default. It does not read the device status or
+// interface counters, whose layouts are unverified; see DefaultStatusLayout.
+var GoCoaxProfile = Profile{
+	Name:        "gocoax",
+	SessionPath: DefaultSessionPath,
+	CSRFCookies: []string{"XSRF-TOKEN", "csrf_token"},
+	LocalInfo: LocalInfoLayout{
+		Endpoint:       "/ms/0/0x15",
+		MyNodeID:       0,
+		NCNodeID:       1,
+		MocaNetVersion: 11,
+		NodeBitMask:    12,
+	},
+	NodeInfo: NodeInfoLayout{
+		Endpoint:    "/ms/0/0x16",
+		MACHigh:     0,
+		MACLow:      1,
+		MocaVersion: 4,
+	},
+	FMREndpoint:    "/ms/0/0x1D",
+	RebootEndpoint: "/ms/1/0xb00",
+}
+
+// minWords returns the number of words a local info response needs
+func (l LocalInfoLayout) minWords() int {
+	return max(l.MyNodeID, l.NCNodeID, l.MocaNetVersion, l.NodeBitMask) + 1
+}
+
+// minWords returns the number of words a node info response needs
+func (l NodeInfoLayout) minWords() int {
+	return max(l.MACHigh, l.MACLow, l.MocaVersion) + 1
+}
+
+// Endpoints returns the read endpoints of the profile, for allowlists of raw calls
+func (p Profile) Endpoints() []string {
+	var endpoints []string
+	for _, endpoint := range []string{p.LocalInfo.Endpoint, p.NodeInfo.Endpoint, p.FMREndpoint, p.Status.Endpoint, p.Stats.Endpoint} {
+		if endpoint != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
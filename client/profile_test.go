@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testProfile is the interface of a stand-in adapter that differs from goCoax in every
+// setting of a profile
+var testProfile = Profile{
+	Name:        "test",
+	SessionPath: "/main.html",
+	CSRFCookies: []string{"sb_csrf"},
+	LocalInfo: LocalInfoLayout{
+		Endpoint:       "/ms/0/0x25",
+		MyNodeID:       1,
+		NCNodeID:       0,
+		MocaNetVersion: 2,
+		NodeBitMask:    3,
+	},
+	NodeInfo: NodeInfoLayout{
+		Endpoint:    "/ms/0/0x26",
+		MACHigh:     1,
+		MACLow:      2,
+		MocaVersion: 0,
+	},
+	FMREndpoint:    "/ms/0/0x2D",
+	RebootEndpoint: "/ms/1/0xc00",
+	Status:         DefaultStatusLayout,
+	Stats:          DefaultStatsLayout,
+}
+
+func TestProfile(t *testing.T) {
+	var csrfMissing []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/main.html", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "sb_csrf", Value: "token"})
+	})
+	mux.HandleFunc("/ms/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-CSRF-TOKEN") != "token" {
+			csrfMissing = append(csrfMissing, r.URL.Path)
+		}
+		switch r.URL.Path {
+		case "/ms/0/0x25":
+			fmt.Fprint(w, `{"data":["0x00000100","0x00000002","0x00000025","0x00000007"]}`)
+		case "/ms/0/0x26":
+			fmt.Fprint(w, `{"data":["0x00000025","0x0012ab00","0xcd000000"]}`)
+		case "/ms/0/0x2D":
+			fmt.Fprint(w, `{"data":["0x00000001"]}`)
+		case "/ms/1/0xc00":
+			fmt.Fprint(w, `{"data":[]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c, err := New(context.Background(), strings.TrimPrefix(server.URL, "http://"), WithProfile(testProfile), WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	local, err := c.GetLocalInfo(ctx)
+	if err != nil {
+		t.Fatalf("GetLocalInfo failed: %v", err)
+	}
+	if local.MyNodeID != 2 || local.NCNodeID != 0 || local.MocaNetVersion != 0x25 || local.NodeBitMask != 7 {
+		t.Errorf("Unexpected local info %+v", local)
+	}
+
+	node, err := c.GetNetworkNodeInfo(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetNetworkNodeInfo failed: %v", err)
+	}
+	if node.MocaVersion != 0x25 || node.MACAddress != "00:12:ab:00:cd:00" {
+		t.Errorf("Unexpected node info %+v", node)
+	}
+
+	if _, err := c.GetFMRInfo(ctx, 1, 2); err != nil {
+		t.Errorf("GetFMRInfo failed: %v", err)
+	}
+	if err := c.Reboot(ctx); err != nil {
+		t.Errorf("Reboot failed: %v", err)
+	}
+	if len(csrfMissing) > 0 {
+		t.Errorf("Expected the profile's CSRF cookie to be sent, missing from %v", csrfMissing)
+	}
+}
+
+func TestProfileShortResponse(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":["0x00000000","0x00000000","0x00000000"]}`)
+	}))
+	c.profile = testProfile
+
+	// The test profile needs 4 words of local info
+	if _, err := c.GetLocalInfo(context.Background()); err == nil || !strings.Contains(err.Error(), "expected at least 4") {
+		t.Errorf("Expected an error for 3 words, got %v", err)
+	}
+}
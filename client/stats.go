@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"fmt"
+)
+
+// CounterLayout locates one interface's counters in the statistics response. Word
+// indexes of -1 mark a counter the device does not report.
+type CounterLayout struct {
+	TxPackets   int
+	RxPackets   int
+	TxBytes     int
+	RxBytes     int
+	RxCRCErrors int
+	TxDropped   int
+	RxDropped   int
+}
+
+// StatsLayout locates the Ethernet and coax interface counters in the response of the
+// statistics endpoint
+type StatsLayout struct {
+	Endpoint string
+	Ethernet CounterLayout
+	MoCA     CounterLayout
+}
+
+// DefaultStatsLayout is the statistics layout assumed for goCoax adapters. Like
+// DefaultStatusLayout it is not part of GoCoaxProfile, and is read only by profiles
+// that set a stats endpoint.
+//
+// It has not been checked against a capture from a real adapter; the captured web UI
+// in examples/ does not read interface statistics.
+var DefaultStatsLayout = StatsLayout{
+	Endpoint: "/ms/0/0x17",
+	Ethernet: CounterLayout{TxPackets: 0, RxPackets: 1, TxBytes: 2, RxBytes: 3, RxCRCErrors: 4, TxDropped: 5, RxDropped: 6},
+	MoCA:     CounterLayout{TxPackets: 7, RxPackets: 8, TxBytes: 9, RxBytes: 10, RxCRCErrors: 11, TxDropped: 12, RxDropped: 13},
+}
+
+// InterfaceStats holds the raw counters of one interface as reported by the device.
+// They restart from zero when the device reboots and may wrap.
+type InterfaceStats struct {
+	TxPackets   uint64
+	RxPackets   uint64
+	TxBytes     uint64
+	RxBytes     uint64
+	RxCRCErrors uint64
+	TxDropped   uint64
+	RxDropped   uint64
+}
+
+// DeviceStats holds the counters of the Ethernet and coax interfaces
+type DeviceStats struct {
+	Ethernet InterfaceStats
+	MoCA     InterfaceStats
+	RawData  []uint64
+}
+
+// GetDeviceStats retrieves interface counters using the statistics layout of the
+// client's profile, or returns ErrNoEndpoint if the profile does not read them
+func (c *Client) GetDeviceStats(ctx context.Context) (*DeviceStats, error) {
+	return c.GetDeviceStatsWithLayout(ctx, c.profile.Stats)
+}
+
+// GetDeviceStatsWithLayout retrieves interface counters using the given layout
+func (c *Client) GetDeviceStatsWithLayout(ctx context.Context, layout StatsLayout) (*DeviceStats, error) {
+	if layout.Endpoint == "" {
+		return nil, fmt.Errorf("GetDeviceStats: %w", ErrNoEndpoint)
+	}
+	payload := map[string]interface{}{
+		"data": []interface{}{},
+	}
+
+	body, err := c.doRequestWithRetry(ctx, layout.Endpoint, payload)
+	if err != nil {
+		return nil, fmt.Errorf("GetDeviceStats request failed: %w", err)
+	}
+
+	data, err := decodeHexCounters(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDeviceStats(data, layout)
+}
+
+// parseDeviceStats decodes counters according to the layout
+func parseDeviceStats(data []uint64, layout StatsLayout) (*DeviceStats, error) {
+	required := max(layout.Ethernet.maxIndex(), layout.MoCA.maxIndex()) + 1
+	if len(data) < required {
+		return nil, fmt.Errorf("insufficient data elements: got %d, expected at least %d", len(data), required)
+	}
+
+	return &DeviceStats{
+		Ethernet: layout.Ethernet.parse(data),
+		MoCA:     layout.MoCA.parse(data),
+		RawData:  data,
+	}, nil
+}
+
+// maxIndex returns the highest word index used by the layout
+func (l CounterLayout) maxIndex() int {
+	return max(l.TxPackets, l.RxPackets, l.TxBytes, l.RxBytes, l.RxCRCErrors, l.TxDropped, l.RxDropped)
+}
+
+// parse reads the interface counters from the response words
+func (l CounterLayout) parse(data []uint64) InterfaceStats {
+	word := func(index int) uint64 {
+		if index < 0 {
+			return 0
+		}
+		return data[index]
+	}
+
+	return InterfaceStats{
+		TxPackets:   word(l.TxPackets),
+		RxPackets:   word(l.RxPackets),
+		TxBytes:     word(l.TxBytes),
+		RxBytes:     word(l.RxBytes),
+		RxCRCErrors: word(l.RxCRCErrors),
+		TxDropped:   word(l.TxDropped),
+		RxDropped:   word(l.RxDropped),
+	}
+}
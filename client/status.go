@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoEndpoint is returned for a call the client's profile has no endpoint for
+var ErrNoEndpoint = errors.New("no endpoint in the profile")
+
+// MoCA operates between 400 MHz and 1675 MHz; frequencies outside this range are
+// treated as unknown
+const (
+	minMocaFrequencyMHz = 400
+	maxMocaFrequencyMHz = 1675
+)
+
+// WordRange is a half-open range [Start, End) of response words
+type WordRange struct {
+	Start int
+	End   int
+}
+
+// StatusLayout locates the device status page (devStatus.html) fields in the
+// response of the status endpoint. Word indexes of -1 and empty ranges mark a field
+// the device does not report.
+type StatusLayout struct {
+	Endpoint      string
+	Firmware      WordRange // ASCII, decoded like hex2ascii in main.js
+	Hardware      WordRange // ASCII, decoded like hex2ascii in main.js
+	Uptime        int       // seconds
+	EthernetSpeed int       // Mbps, 0 when the link is down
+	LinkStatus    int       // 1 when the MoCA link is up
+	LOF           int       // last operational frequency in MHz
+	Frequency     int       // current beacon frequency in MHz
+	Privacy       int       // bit 0 set when link privacy is enabled
+}
+
+// DefaultStatusLayout is the status layout assumed for goCoax adapters. It is not part
+// of GoCoaxProfile; it is read for devices configured with read_status, and by
+// profiles that set a status endpoint.
+//
+// The captured web UI in examples/ does not include devStatus.html, so this layout
+// has not been checked against the page's own decoding. Decoded values are range
+// checked, and values that do not fit are reported as unknown rather than exported.
+var DefaultStatusLayout = StatusLayout{
+	Endpoint:      "/ms/0/0x14",
+	Firmware:      WordRange{0, 8},
+	Hardware:      WordRange{8, 12},
+	Uptime:        12,
+	EthernetSpeed: 13,
+	LinkStatus:    14,
+	LOF:           15,
+	Frequency:     16,
+	Privacy:       17,
+}
+
+// DeviceStatus represents the data shown on the device status page. Zero values
+// mean the device did not report the field.
+type DeviceStatus struct {
+	FirmwareVersion   string
+	HardwareRevision  string
+	Uptime            time.Duration
+	EthernetSpeedMbps int
+	LinkUp            bool
+	LOFMHz            int
+	FrequencyMHz      int
+	PrivacyEnabled    bool
+	RawData           []uint32
+}
+
+// GetDeviceStatus retrieves the device status using the status layout of the client's
+// profile, or returns ErrNoEndpoint if the profile does not read the status
+func (c *Client) GetDeviceStatus(ctx context.Context) (*DeviceStatus, error) {
+	return c.GetDeviceStatusWithLayout(ctx, c.profile.Status)
+}
+
+// GetDeviceStatusWithLayout retrieves the device status using the given layout
+func (c *Client) GetDeviceStatusWithLayout(ctx context.Context, layout StatusLayout) (*DeviceStatus, error) {
+	if layout.Endpoint == "" {
+		return nil, fmt.Errorf("GetDeviceStatus: %w", ErrNoEndpoint)
+	}
+	payload := map[string]interface{}{
+		"data": []interface{}{},
+	}
+
+	body, err := c.doRequestWithRetry(ctx, layout.Endpoint, payload)
+	if err != nil {
+		return nil, fmt.Errorf("GetDeviceStatus request failed: %w", err)
+	}
+
+	data, err := decodeHexWords(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDeviceStatus(data, layout)
+}
+
+// parseDeviceStatus decodes status words according to the layout
+func parseDeviceStatus(data []uint32, layout StatusLayout) (*DeviceStatus, error) {
+	required := max(layout.Firmware.End, layout.Hardware.End, layout.Uptime+1, layout.EthernetSpeed+1,
+		layout.LinkStatus+1, layout.LOF+1, layout.Frequency+1, layout.Privacy+1)
+	if len(data) < required {
+		return nil, fmt.Errorf("insufficient data elements: got %d, expected at least %d", len(data), required)
+	}
+
+	word := func(index int) uint32 {
+		if index < 0 {
+			return 0
+		}
+		return data[index]
+	}
+
+	status := &DeviceStatus{
+		FirmwareVersion:   decodeASCIIWords(data[layout.Firmware.Start:layout.Firmware.End]),
+		HardwareRevision:  decodeASCIIWords(data[layout.Hardware.Start:layout.Hardware.End]),
+		Uptime:            time.Duration(word(layout.Uptime)) * time.Second,
+		EthernetSpeedMbps: int(word(layout.EthernetSpeed)),
+		LinkUp:            word(layout.LinkStatus) == 1,
+		LOFMHz:            validFrequency(word(layout.LOF)),
+		FrequencyMHz:      validFrequency(word(layout.Frequency)),
+		PrivacyEnabled:    word(layout.Privacy)&0x01 == 1,
+		RawData:           data,
+	}
+
+	return status, nil
+}
+
+// validFrequency returns the frequency if it lies in the MoCA band, or 0
+func validFrequency(mhz uint32) int {
+	if mhz < minMocaFrequencyMHz || mhz > maxMocaFrequencyMHz {
+		return 0
+	}
+	return int(mhz)
+}
+
+// decodeASCIIWords decodes a string packed four bytes per word, most significant byte
+// first. Like hex2ascii in main.js it stops at the NUL terminator or the first
+// non-ASCII byte; control characters also end the string here.
+func decodeASCIIWords(words []uint32) string {
+	b := make([]byte, 0, len(words)*4)
+	for _, w := range words {
+		for shift := 24; shift >= 0; shift -= 8 {
+			c := byte(w >> shift)
+			if c < 0x20 || c >= 0x7F {
+				return string(b)
+			}
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// readEndpointRE matches calls in space 0 of the device API, which read data; space 1
+// holds actions such as reboot
+var readEndpointRE = regexp.MustCompile(`^/ms/0/0x[0-9a-fA-F]+$`)
+
+// IsReadEndpoint reports whether endpoint is a call that reads data, /ms/0/0x<id>
+func IsReadEndpoint(endpoint string) bool {
+	return readEndpointRE.MatchString(endpoint)
+}
+
+// Word is a response word in the forms useful when working out what it holds
+type Word struct {
+	Index   int    `json:"index"`
+	Hex     string `json:"hex"`     // e.g. 0x00000025
+	Decimal uint32 `json:"decimal"` // e.g. 37
+	Binary  string `json:"binary"`  // e.g. 00000000 00000000 00000000 00100101
+}
+
+// DescribeWords returns the words of a response in hex, decimal and binary
+func DescribeWords(words []uint32) []Word {
+	described := make([]Word, len(words))
+	for i, w := range words {
+		described[i] = Word{
+			Index:   i,
+			Hex:     fmt.Sprintf("0x%08x", w),
+			Decimal: w,
+			Binary:  formatBinary(w),
+		}
+	}
+	return described
+}
+
+// formatBinary returns the 32 bits of a word in bytes separated by spaces
+func formatBinary(w uint32) string {
+	bits := fmt.Sprintf("%032b", w)
+	groups := make([]string, 0, 4)
+	for i := 0; i < len(bits); i += 8 {
+		groups = append(groups, bits[i:i+8])
+	}
+	return strings.Join(groups, " ")
+}
+
+// ParseData parses the request data of a device API call, comma-separated decimal or
+// 0x-prefixed hex numbers such as "3" or "0x7,2". An empty string is no data.
+func ParseData(s string) ([]int, error) {
+	data := []int{}
+	if strings.TrimSpace(s) == "" {
+		return data, nil
+	}
+	for _, field := range strings.Split(s, ",") {
+		v, err := strconv.ParseInt(strings.TrimSpace(field), 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data %q", field)
+		}
+		data = append(data, int(v))
+	}
+	return data, nil
+}
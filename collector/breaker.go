@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by Gather while a device's circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitState is the state of a device's circuit breaker, as reported by
+// gocoax_device_circuit_state
+type CircuitState int
+
+// Circuit breaker states
+const (
+	CircuitClosed   CircuitState = 0 // the device is queried normally
+	CircuitOpen     CircuitState = 1 // the device is not queried until the backoff has passed
+	CircuitHalfOpen CircuitState = 2 // one probe of the device is in progress
+)
+
+// String returns the name of the state
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker stops queries of a device after consecutive failures. Once the
+// backoff has passed one probe is let through; a failed probe doubles the backoff, up
+// to the maximum, and a successful one closes the circuit.
+type circuitBreaker struct {
+	threshold      int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int           // consecutive failures while closed
+	backoff  time.Duration // current wait between probes
+	retryAt  time.Time     // when the next probe may go out
+
+	now func() time.Time
+}
+
+// newCircuitBreaker creates a closed breaker
+func newCircuitBreaker(threshold int, initialBackoff, maxBackoff time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold:      threshold,
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+		now:            time.Now,
+	}
+}
+
+// allow reports whether the device may be queried, moving an open breaker whose
+// backoff has passed to half-open. It returns an error wrapping ErrCircuitOpen if not.
+// A nil breaker allows every query.
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if wait := b.retryAt.Sub(b.now()); wait > 0 {
+			return fmt.Errorf("%w after %d failures, next probe in %s", ErrCircuitOpen, b.failures, wait.Round(time.Second))
+		}
+		b.state = CircuitHalfOpen
+	case CircuitHalfOpen:
+		return fmt.Errorf("%w, probe in progress", ErrCircuitOpen)
+	}
+	return nil
+}
+
+// record updates the breaker with the result of an allowed query. A cancelled query
+// says nothing about the device and is not counted; a cancelled probe is sent again
+// on the next query.
+func (b *circuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if errors.Is(err, context.Canceled) {
+		if b.state == CircuitHalfOpen {
+			b.state = CircuitOpen
+		}
+		return
+	}
+	if err == nil {
+		b.state = CircuitClosed
+		b.failures = 0
+		b.backoff = 0
+		return
+	}
+
+	b.failures++
+	switch {
+	case b.state == CircuitHalfOpen:
+		b.backoff *= 2
+		if b.backoff > b.maxBackoff {
+			b.backoff = b.maxBackoff
+		}
+	case b.failures >= b.threshold:
+		b.backoff = b.initialBackoff
+	default:
+		return
+	}
+	b.state = CircuitOpen
+	b.retryAt = b.now().Add(b.backoff)
+}
+
+// current returns the state of the breaker
+func (b *circuitBreaker) current() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker(2, 30*time.Second, 100*time.Second)
+	b.now = func() time.Time { return now }
+	failure := errors.New("connection refused")
+
+	expectAllowed := func(step string, allowed bool) {
+		t.Helper()
+		err := b.allow()
+		if allowed && err != nil {
+			t.Fatalf("%s: expected query to be allowed, got %v", step, err)
+		}
+		if !allowed && !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("%s: expected ErrCircuitOpen, got %v", step, err)
+		}
+	}
+	expectState := func(step string, state CircuitState) {
+		t.Helper()
+		if got := b.current(); got != state {
+			t.Fatalf("%s: expected %s, got %s", step, state, got)
+		}
+	}
+
+	expectAllowed("first failure", true)
+	b.record(failure)
+	expectState("first failure", CircuitClosed)
+	expectAllowed("second failure", true)
+	b.record(failure)
+	expectState("second failure", CircuitOpen)
+
+	now = now.Add(29 * time.Second)
+	expectAllowed("during backoff", false)
+
+	// Failed probes double the backoff up to the maximum
+	for _, backoff := range []time.Duration{60 * time.Second, 100 * time.Second, 100 * time.Second} {
+		now = now.Add(time.Second)
+		expectAllowed("probe", true)
+		expectState("probe", CircuitHalfOpen)
+		expectAllowed("probe in progress", false)
+		b.record(failure)
+		expectState("failed probe", CircuitOpen)
+
+		now = now.Add(backoff - time.Second)
+		expectAllowed("after failed probe", false)
+	}
+
+	now = now.Add(time.Second)
+	expectAllowed("last probe", true)
+	b.record(nil)
+	expectState("successful probe", CircuitClosed)
+
+	// A success resets the count of failures
+	b.record(failure)
+	expectState("new failure", CircuitClosed)
+
+	// Cancelled queries are not failures, while device timeouts are
+	canceled := fmt.Errorf("failed to get local info: %w", context.Canceled)
+	expectAllowed("cancelled query", true)
+	b.record(canceled)
+	expectState("cancelled query", CircuitClosed)
+	expectAllowed("timeout", true)
+	b.record(fmt.Errorf("failed to get local info: %w", context.DeadlineExceeded))
+	expectState("timeout", CircuitOpen)
+
+	// A cancelled probe leaves the circuit open, to be probed again at once
+	now = now.Add(30 * time.Second)
+	expectAllowed("probe", true)
+	b.record(canceled)
+	expectState("cancelled probe", CircuitOpen)
+	expectAllowed("probe again", true)
+	expectState("probe again", CircuitHalfOpen)
+}
+
+func TestGatherCircuitOpen(t *testing.T) {
+	c := loadFixture(t, "single-node")
+	down := false
+	device := &countRequests{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			http.Error(w, "unavailable", http.StatusForbidden)
+			return
+		}
+		newFixtureHandler(c).ServeHTTP(w, r)
+	})}
+	server := httptest.NewServer(device)
+	defer server.Close()
+
+	collector, err := NewGoCoaxCollector("single-node", strings.TrimPrefix(server.URL, "http://"), "admin", "secret", 5*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	defer collector.Close()
+	collector.SetCircuitBreaker(1, time.Hour, time.Hour)
+
+	down = true
+	if _, err := collector.Gather(context.Background()); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected the device's error, got %v", err)
+	}
+	device.reset()
+
+	// The open circuit fails the scrape without querying the device
+	metrics := `
+# HELP gocoax_device_circuit_state State of the device's circuit breaker (0=closed, 1=open, 2=half-open)
+# TYPE gocoax_device_circuit_state gauge
+gocoax_device_circuit_state{device="single-node"} 1
+# HELP gocoax_up Device is reachable and responding (1=up, 0=down)
+# TYPE gocoax_up gauge
+gocoax_up{device="single-node"} 0
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(metrics), "gocoax_up", "gocoax_device_circuit_state"); err != nil {
+		t.Error(err)
+	}
+	if requests := device.reset(); len(requests) != 0 {
+		t.Errorf("Expected no requests while the circuit is open, got %v", requests)
+	}
+}
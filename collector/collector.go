@@ -2,9 +2,12 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/louispool/gocoax-exporter/client"
@@ -15,8 +18,18 @@ import (
 type GoCoaxCollector struct {
 	client     *client.Client
 	deviceName string
+	address    string
 	timeout    time.Duration
 
+	// onScrape is called with the result of every Collect, if set
+	onScrape func(err error)
+
+	// onGather is called with the result of every query of the device, if set
+	onGather func(err error)
+
+	// onEvent is called with every event detected between snapshots, if set
+	onEvent func(Event)
+
 	// Metric descriptors
 	phyRateNPER      *prometheus.Desc
 	phyRateVLPER     *prometheus.Desc
@@ -25,19 +38,82 @@ type GoCoaxCollector struct {
 	up               *prometheus.Desc
 	scrapeDuration   *prometheus.Desc
 	scrapeErrors     *prometheus.Desc
+	deviceInfo       *prometheus.Desc
+	deviceUptime     *prometheus.Desc
+	mocaFrequency    *prometheus.Desc
+	ifaceCounters    []*prometheus.Desc // in interfaceCounters order
+	counterResets    *prometheus.Desc
+	eventsTotal      *prometheus.Desc
+	circuitState     *prometheus.Desc
+
+	counters *counterTracker
+	events   *eventTracker
+
+	// fmrBatch requests FMR for several nodes at once; see WithFMRBatch. fmrPerNode
+	// is set once the device has answered such a request with an unexpected layout.
+	fmrBatch   bool
+	fmrPerNode atomic.Bool
+
+	// gathering is the query of the device that concurrent Gather calls share, nil
+	// when none is in progress
+	gatherMu  sync.Mutex
+	gathering *sharedGather
+
+	// breaker stops queries of a device that keeps failing; nil when not configured
+	breaker *circuitBreaker
+
+	// custom are the further device API calls exported as metrics
+	custom []customEndpoint
+
+	// fmrDuration is how long the FMR stage of the last full gather took, in
+	// nanoseconds; gathers with less time left before their deadline skip it
+	fmrDuration atomic.Int64
+
+	// ctx is cancelled by Close, ending the queries in progress
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-// NewGoCoaxCollector creates a new collector for a goCoax device
+// NewGoCoaxCollector creates a new collector for a goCoax device. It is New with
+// credentials and a timeout.
 func NewGoCoaxCollector(deviceName, address, username, password string, timeout time.Duration) (*GoCoaxCollector, error) {
-	c, err := client.NewClient(address, username, password, timeout)
+	return New(context.Background(), deviceName, address, WithCredentials(username, password), WithTimeout(timeout))
+}
+
+// New creates a collector for the adapter at address, host:port, reporting it as
+// deviceName. ctx bounds opening the session with the adapter.
+func New(ctx context.Context, deviceName, address string, opts ...Option) (*GoCoaxCollector, error) {
+	o := options{timeout: client.DefaultTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	c, err := client.New(ctx, address, append(o.client, client.WithTimeout(o.timeout))...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create client: %w", err)
 	}
 
-	return &GoCoaxCollector{
+	ifaceCounters := make([]*prometheus.Desc, len(interfaceCounters))
+	for i, counter := range interfaceCounters {
+		ifaceCounters[i] = prometheus.NewDesc(
+			"gocoax_interface_"+counter.name+"_total",
+			counter.help,
+			[]string{"device", "interface"},
+			nil,
+		)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	collector := &GoCoaxCollector{
 		client:     c,
 		deviceName: deviceName,
-		timeout:    timeout,
+		address:    address,
+		timeout:    o.timeout,
+		counters:   newCounterTracker(),
+		events:     newEventTracker(),
+		ctx:        ctx,
+		cancel:     cancel,
 
 		phyRateNPER: prometheus.NewDesc(
 			"gocoax_phy_rate_nper_mbps",
@@ -81,7 +157,48 @@ func NewGoCoaxCollector(deviceName, address, username, password string, timeout
 			[]string{"device"},
 			nil,
 		),
-	}, nil
+		deviceInfo: prometheus.NewDesc(
+			"gocoax_device_info",
+			"Device firmware version and hardware revision",
+			[]string{"device", "firmware", "hardware"},
+			nil,
+		),
+		deviceUptime: prometheus.NewDesc(
+			"gocoax_device_uptime_seconds",
+			"Time since the device last booted",
+			[]string{"device"},
+			nil,
+		),
+		mocaFrequency: prometheus.NewDesc(
+			"gocoax_moca_frequency_mhz",
+			"Current MoCA beacon frequency in MHz",
+			[]string{"device"},
+			nil,
+		),
+		ifaceCounters: ifaceCounters,
+		counterResets: prometheus.NewDesc(
+			"gocoax_interface_counter_resets_total",
+			"Detected resets of the device's interface counters, e.g. after a reboot",
+			[]string{"device", "interface"},
+			nil,
+		),
+		eventsTotal: prometheus.NewDesc(
+			"gocoax_events_total",
+			"Changes detected between successive snapshots of the MoCA network, by type",
+			[]string{"device", "type"},
+			nil,
+		),
+		circuitState: prometheus.NewDesc(
+			"gocoax_device_circuit_state",
+			"State of the device's circuit breaker (0=closed, 1=open, 2=half-open)",
+			[]string{"device"},
+			nil,
+		),
+	}
+	for _, fn := range o.setup {
+		fn(collector)
+	}
+	return collector, nil
 }
 
 // Describe implements prometheus.Collector
@@ -93,15 +210,33 @@ func (c *GoCoaxCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.up
 	ch <- c.scrapeDuration
 	ch <- c.scrapeErrors
+	ch <- c.deviceInfo
+	ch <- c.deviceUptime
+	ch <- c.mocaFrequency
+	for _, desc := range c.ifaceCounters {
+		ch <- desc
+	}
+	ch <- c.counterResets
+	ch <- c.eventsTotal
+	c.describeCustom(ch)
+	ch <- c.circuitState
 }
 
 // Collect implements prometheus.Collector
 func (c *GoCoaxCollector) Collect(ch chan<- prometheus.Metric) {
+	c.CollectWithContext(context.Background(), ch)
+}
+
+// CollectWithContext collects like Collect, for a scrape with its own context. The
+// collection stops when ctx is cancelled or its deadline passes, if that comes before
+// the collector's timeout.
+func (c *GoCoaxCollector) CollectWithContext(ctx context.Context, ch chan<- prometheus.Metric) {
 	startTime := time.Now()
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 
-	if err := c.collectMetrics(ctx, ch); err != nil {
+	snapshot, err := c.collectMetrics(ctx, ch)
+	if err != nil {
 		log.Printf("Error collecting metrics for device %s: %v", c.deviceName, err)
 		// Report device as down
 		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0, c.deviceName)
@@ -114,24 +249,224 @@ func (c *GoCoaxCollector) Collect(ch chan<- prometheus.Metric) {
 
 	duration := time.Since(startTime).Seconds()
 	ch <- prometheus.MustNewConstMetric(c.scrapeDuration, prometheus.GaugeValue, duration, c.deviceName)
+
+	if c.breaker != nil {
+		ch <- prometheus.MustNewConstMetric(c.circuitState, prometheus.GaugeValue, float64(c.breaker.current()), c.deviceName)
+	}
+
+	if c.onScrape != nil {
+		if err == nil && snapshot.Partial {
+			err = ErrPartialSnapshot
+		}
+		c.onScrape(err)
+	}
 }
 
-// collectMetrics performs the actual metric collection
-func (c *GoCoaxCollector) collectMetrics(ctx context.Context, ch chan<- prometheus.Metric) error {
+// OnScrape registers a function called with the result of every Collect, nil on
+// success and ErrPartialSnapshot when the PHY rates were skipped. It must be set
+// before the collector is registered.
+func (c *GoCoaxCollector) OnScrape(fn func(err error)) {
+	c.onScrape = fn
+}
+
+// OnGather registers a function called with the result of every query of the device,
+// nil on success. Concurrent Gather calls that share a query report it once. It must
+// be set before the collector is registered.
+func (c *GoCoaxCollector) OnGather(fn func(err error)) {
+	c.onGather = fn
+}
+
+// OnEvent registers a function called with every event detected between successive
+// snapshots. It must be set before the collector is registered.
+func (c *GoCoaxCollector) OnEvent(fn func(Event)) {
+	c.onEvent = fn
+}
+
+// SetStepChangePercent sets the PHY rate change, in percent, reported as a
+// phy_rate_step_change event. It must be set before the collector is registered.
+func (c *GoCoaxCollector) SetStepChangePercent(percent float64) {
+	c.events.stepPercent = percent
+}
+
+// SetCircuitBreaker stops queries of the device after threshold consecutive failures.
+// Gather then fails with ErrCircuitOpen until a probe, sent after initialBackoff and
+// then at doubling intervals up to maxBackoff, succeeds. It must be set before the
+// collector is registered.
+func (c *GoCoaxCollector) SetCircuitBreaker(threshold int, initialBackoff, maxBackoff time.Duration) {
+	c.breaker = newCircuitBreaker(threshold, initialBackoff, maxBackoff)
+}
+
+// SetMinRequestInterval sets the minimum time between requests to the device. It must
+// be set before the collector is registered.
+func (c *GoCoaxCollector) SetMinRequestInterval(d time.Duration) {
+	c.client.SetMinRequestInterval(d)
+}
+
+// Reboot restarts the device
+func (c *GoCoaxCollector) Reboot(ctx context.Context) error {
+	return c.client.Reboot(ctx)
+}
+
+// Query calls an endpoint of the device API with the given request data and returns
+// the words of the response
+func (c *GoCoaxCollector) Query(ctx context.Context, endpoint string, data []int) ([]uint32, error) {
+	return c.client.GetWords(ctx, endpoint, data)
+}
+
+// ErrPartialSnapshot is passed to the OnScrape function when a collection skipped the
+// PHY rates for lack of time
+var ErrPartialSnapshot = errors.New("PHY rates skipped for lack of time")
+
+// DeviceSnapshot holds everything fetched from a device during one collection
+type DeviceSnapshot struct {
+	Device       string
+	Time         time.Time
+	LocalInfo    *client.LocalInfo
+	NodeVersions map[int]int // [nodeID] = mocaVersion
+	ActiveNodes  []int
+	PHYRates     *PHYRateMatrix
+	Status       *client.DeviceStatus // nil if the status could not be read
+	Stats        *client.DeviceStats  // nil if the counters could not be read
+	Partial      bool                 // the PHY rates were skipped for lack of time; PHYRates is empty
+	CustomWords  [][]uint32           // responses of the custom metrics endpoints, nil where a call failed
+}
+
+// SnapshotGatherer fetches a snapshot from a device; GoCoaxCollector implements it
+type SnapshotGatherer interface {
+	DeviceName() string
+	Gather(ctx context.Context) (*DeviceSnapshot, error)
+}
+
+// IsNC reports whether a node is the network coordinator
+func (s *DeviceSnapshot) IsNC(nodeID int) bool {
+	return nodeID == s.LocalInfo.NCNodeID
+}
+
+// sharedGather is a query of the device shared by the Gather calls made while it is in
+// progress
+type sharedGather struct {
+	done     chan struct{} // closed once snapshot and err are set
+	snapshot *DeviceSnapshot
+	err      error
+
+	waiters int // Gather calls waiting for the result, guarded by gatherMu
+	cancel  context.CancelFunc
+}
+
+// Gather queries the device and calculates the PHY rate matrix for all active nodes.
+// Calls made while a query is in progress share its result, so concurrent scrapes do
+// not query the device twice; the shared snapshot must not be modified. Gather returns
+// early when ctx is done, and the query is cancelled once every call sharing it has
+// returned; it is bounded by the collector's timeout. If the time left before the
+// deadline of the call starting the query is shorter than reading the PHY rates took
+// last time, they are skipped and a partial snapshot is returned.
+func (c *GoCoaxCollector) Gather(ctx context.Context) (*DeviceSnapshot, error) {
+	c.gatherMu.Lock()
+	g := c.gathering
+	if g == nil {
+		if err := c.breaker.allow(); err != nil {
+			c.gatherMu.Unlock()
+			return nil, err
+		}
+		gatherCtx, cancel := context.WithTimeout(c.ctx, c.timeout)
+		g = &sharedGather{done: make(chan struct{}), cancel: cancel}
+		c.gathering = g
+		deadline, _ := ctx.Deadline()
+		go c.runGather(gatherCtx, g, deadline)
+	}
+	g.waiters++
+	c.gatherMu.Unlock()
+
+	select {
+	case <-g.done:
+		if g.err != nil {
+			return nil, g.err
+		}
+		return g.snapshot, nil
+	case <-ctx.Done():
+		// The last caller to leave stops the query; later calls start a new one
+		c.gatherMu.Lock()
+		g.waiters--
+		if g.waiters == 0 {
+			g.cancel()
+			if c.gathering == g {
+				c.gathering = nil
+			}
+		}
+		c.gatherMu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// Ping reads the device's local info, to check that it still answers. The request
+// waits its turn behind other queries of the device.
+func (c *GoCoaxCollector) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	_, err := c.client.GetLocalInfo(ctx)
+	return err
+}
+
+// runGather performs a shared query and hands its result to the waiting Gather calls
+func (c *GoCoaxCollector) runGather(ctx context.Context, g *sharedGather, deadline time.Time) {
+	defer g.cancel()
+
+	// A deadline error comes from the collector's timeout and so is the device's;
+	// cancellation, by Close or by every caller leaving, is not counted
+	snapshot, err := c.gather(ctx, deadline)
+	c.breaker.record(err)
+	if c.onGather != nil {
+		c.onGather(err)
+	}
+
+	c.gatherMu.Lock()
+	if c.gathering == g {
+		c.gathering = nil
+	}
+	c.gatherMu.Unlock()
+
+	g.snapshot, g.err = snapshot, err
+	close(g.done)
+}
+
+// gather performs one query of the device for Gather. The PHY rates are skipped when
+// too little time is left before the deadline of ctx or the given one, if not zero.
+func (c *GoCoaxCollector) gather(ctx context.Context, deadline time.Time) (*DeviceSnapshot, error) {
 	// Step 1: Get local device information
 	localInfo, err := c.client.GetLocalInfo(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get local info: %w", err)
+		return nil, fmt.Errorf("failed to get local info: %w", err)
 	}
 
 	nodeBitMask := localInfo.NodeBitMask
 	mocaNetVer := localInfo.MocaNetVersion
 	ncNodeID := localInfo.NCNodeID
 
-	// Step 2: Get information for each active node
-	nodeVersions := make(map[int]int)
-	activeNodes := []int{}
+	snapshot := &DeviceSnapshot{
+		Device:       c.deviceName,
+		Time:         time.Now(),
+		LocalInfo:    localInfo,
+		NodeVersions: make(map[int]int),
+		PHYRates:     NewPHYRateMatrix(),
+	}
+
+	// The status page data and counters are optional, and read only when the profile
+	// has their endpoints; PHY rates are still collected without them
+	switch status, err := c.client.GetDeviceStatus(ctx); {
+	case err == nil:
+		snapshot.Status = status
+	case !errors.Is(err, client.ErrNoEndpoint):
+		log.Printf("Warning: failed to get device status: %v", err)
+	}
+	switch stats, err := c.client.GetDeviceStats(ctx); {
+	case err == nil:
+		snapshot.Stats = stats
+	case !errors.Is(err, client.ErrNoEndpoint):
+		log.Printf("Warning: failed to get interface counters: %v", err)
+	}
+	snapshot.CustomWords = c.gatherCustom(ctx)
 
+	// Step 2: Get information for each active node
 	for nodeID := 0; nodeID < MAX_NUM_NODES; nodeID++ {
 		if (nodeBitMask & (1 << nodeID)) == 0 {
 			continue
@@ -143,70 +478,162 @@ func (c *GoCoaxCollector) collectMetrics(ctx context.Context, ch chan<- promethe
 			continue
 		}
 
-		nodeVersions[nodeID] = nodeInfo.MocaVersion
-		activeNodes = append(activeNodes, nodeID)
+		snapshot.NodeVersions[nodeID] = nodeInfo.MocaVersion
+		snapshot.ActiveNodes = append(snapshot.ActiveNodes, nodeID)
+	}
 
-		// Emit node info metric
-		mocaVerStr := formatMocaVersion(nodeInfo.MocaVersion)
-		isNC := "false"
-		if nodeID == ncNodeID {
-			isNC = "true"
+	// Step 3: Get FMR info for the active nodes and calculate their PHY rates, unless
+	// there is not enough time left
+	if shared, ok := ctx.Deadline(); ok && (deadline.IsZero() || shared.Before(deadline)) {
+		deadline = shared
+	}
+	if !deadline.IsZero() {
+		left, needed := time.Until(deadline), time.Duration(c.fmrDuration.Load())
+		if left < needed {
+			log.Printf("Warning: skipping PHY rates of device %s, %s left but they took %s last time",
+				c.deviceName, left.Round(time.Millisecond), needed.Round(time.Millisecond))
+			snapshot.Partial = true
 		}
-		ch <- prometheus.MustNewConstMetric(
-			c.nodeInfo,
-			prometheus.GaugeValue,
-			1,
-			c.deviceName,
-			strconv.Itoa(nodeID),
-			mocaVerStr,
-			isNC,
-		)
+	}
+	if !snapshot.Partial {
+		fmrStart := time.Now()
+		c.readPHYRates(ctx, snapshot, ncNodeID, mocaNetVer, nodeBitMask)
+		c.fmrDuration.Store(int64(time.Since(fmrStart)))
 	}
 
+	c.counters.observe(snapshot)
+	for _, e := range c.events.observe(snapshot) {
+		if c.onEvent != nil {
+			c.onEvent(e)
+		}
+	}
+
+	return snapshot, nil
+}
+
+// readPHYRates gets FMR info for the active nodes of a snapshot, one request per FMR
+// version parameter, and merges the PHY rates calculated for each node into it
+func (c *GoCoaxCollector) readPHYRates(ctx context.Context, snapshot *DeviceSnapshot, ncNodeID, mocaNetVer, nodeBitMask int) {
 	// Get NC MoCA version
-	ncMocaVer := nodeVersions[ncNodeID]
+	ncMocaVer := snapshot.NodeVersions[ncNodeID]
 
-	// Step 3: Get FMR info and calculate PHY rates for each active node
-	for _, nodeID := range activeNodes {
-		nodeMocaVer := nodeVersions[nodeID]
+	groups := make(map[int][]int) // [versionParam] = nodeIDs
+	for _, nodeID := range snapshot.ActiveNodes {
+		versionParam := fmrVersionParam(min(ncMocaVer, snapshot.NodeVersions[nodeID]))
+		groups[versionParam] = append(groups[versionParam], nodeID)
+	}
 
-		// Determine version parameter for FMR request
-		mocaVer := min(ncMocaVer, nodeMocaVer)
-		var versionParam int
-		if mocaVer < 0x20 {
-			versionParam = 1 // MoCA 1.x
-		} else {
-			versionParam = 2 // MoCA 2.x
+	fmrInfo := make(map[int]*client.FMRInfo, len(snapshot.ActiveNodes))
+	for _, versionParam := range []int{1, 2} {
+		for nodeID, info := range c.getFMRInfo(ctx, groups[versionParam], versionParam) {
+			fmrInfo[nodeID] = info
 		}
+	}
 
-		// Request FMR info for this node
-		nodeMask := 1 << nodeID
-		fmrInfo, err := c.client.GetFMRInfo(ctx, nodeMask, versionParam)
-		if err != nil {
-			log.Printf("Warning: failed to get FMR info for node %d: %v", nodeID, err)
+	for _, nodeID := range snapshot.ActiveNodes {
+		info, ok := fmrInfo[nodeID]
+		if !ok {
 			continue
 		}
 
 		// Calculate PHY rates
 		matrix, err := CalculatePHYRates(
 			nodeID,
-			fmrInfo.Data,
-			nodeMocaVer,
+			info.Data,
+			snapshot.NodeVersions[nodeID],
 			ncMocaVer,
 			mocaNetVer,
 			nodeBitMask,
-			nodeVersions,
+			snapshot.NodeVersions,
 		)
 		if err != nil {
 			log.Printf("Warning: failed to calculate PHY rates for node %d: %v", nodeID, err)
 			continue
 		}
 
+		snapshot.PHYRates.Merge(matrix)
+	}
+}
+
+// fmrVersionParam returns the version parameter of an FMR request for a MoCA version
+func fmrVersionParam(mocaVer int) int {
+	if mocaVer < 0x20 {
+		return 1 // MoCA 1.x
+	}
+	return 2 // MoCA 2.x
+}
+
+// getFMRInfo requests FMR info for nodes sharing a version parameter, one node at a
+// time as the web UI does, or in one request with WithFMRBatch unless the device has
+// shown it does not support that. Nodes whose info could not be read are left out of
+// the result.
+func (c *GoCoaxCollector) getFMRInfo(ctx context.Context, nodeIDs []int, versionParam int) map[int]*client.FMRInfo {
+	if c.fmrBatch && len(nodeIDs) > 1 && !c.fmrPerNode.Load() {
+		fmrInfo, err := c.client.GetFMRInfoNodes(ctx, nodeIDs, versionParam)
+		if err == nil {
+			return fmrInfo
+		}
+		if errors.Is(err, client.ErrFMRLayout) {
+			log.Printf("Warning: device %s does not support multi-node FMR requests, requesting nodes one at a time: %v", c.deviceName, err)
+			c.fmrPerNode.Store(true)
+		} else {
+			log.Printf("Warning: failed to get FMR info for nodes %v, retrying one at a time: %v", nodeIDs, err)
+		}
+	}
+
+	fmrInfo := make(map[int]*client.FMRInfo, len(nodeIDs))
+	for _, nodeID := range nodeIDs {
+		info, err := c.client.GetFMRInfo(ctx, 1<<nodeID, versionParam)
+		if err != nil {
+			log.Printf("Warning: failed to get FMR info for node %d: %v", nodeID, err)
+			continue
+		}
+		fmrInfo[nodeID] = info
+	}
+	return fmrInfo
+}
+
+// collectMetrics gathers a snapshot and emits its metrics
+func (c *GoCoaxCollector) collectMetrics(ctx context.Context, ch chan<- prometheus.Metric) (*DeviceSnapshot, error) {
+	snapshot, err := c.Gather(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Emit node info metrics
+	for _, nodeID := range snapshot.ActiveNodes {
+		mocaVerStr := FormatMocaVersion(snapshot.NodeVersions[nodeID])
+		isNC := strconv.FormatBool(snapshot.IsNC(nodeID))
+		ch <- prometheus.MustNewConstMetric(
+			c.nodeInfo,
+			prometheus.GaugeValue,
+			1,
+			c.deviceName,
+			strconv.Itoa(nodeID),
+			mocaVerStr,
+			isNC,
+		)
+	}
+
+	for nodeID, nperRates := range snapshot.PHYRates.NPER {
 		// Emit NPER metrics
-		if nperRates, ok := matrix.NPER[nodeID]; ok {
-			for destNode, rate := range nperRates {
+		for destNode, rate := range nperRates {
+			ch <- prometheus.MustNewConstMetric(
+				c.phyRateNPER,
+				prometheus.GaugeValue,
+				float64(rate),
+				c.deviceName,
+				strconv.Itoa(nodeID),
+				strconv.Itoa(destNode),
+			)
+		}
+
+		// Emit VLPER metrics
+		for destNode, rate := range snapshot.PHYRates.VLPER[nodeID] {
+			// Only emit if rate is non-zero (VLPER only exists for MoCA 2.5)
+			if rate > 0 {
 				ch <- prometheus.MustNewConstMetric(
-					c.phyRateNPER,
+					c.phyRateVLPER,
 					prometheus.GaugeValue,
 					float64(rate),
 					c.deviceName,
@@ -215,41 +642,60 @@ func (c *GoCoaxCollector) collectMetrics(ctx context.Context, ch chan<- promethe
 				)
 			}
 		}
+	}
 
-		// Emit VLPER metrics
-		if vlperRates, ok := matrix.VLPER[nodeID]; ok {
-			for destNode, rate := range vlperRates {
-				// Only emit if rate is non-zero (VLPER only exists for MoCA 2.5)
-				if rate > 0 {
-					ch <- prometheus.MustNewConstMetric(
-						c.phyRateVLPER,
-						prometheus.GaugeValue,
-						float64(rate),
-						c.deviceName,
-						strconv.Itoa(nodeID),
-						strconv.Itoa(destNode),
-					)
-				}
-			}
-		}
+	// Emit GCD metrics
+	for nodeID, gcdRate := range snapshot.PHYRates.GCD {
+		ch <- prometheus.MustNewConstMetric(
+			c.phyRateGCD,
+			prometheus.GaugeValue,
+			float64(gcdRate),
+			c.deviceName,
+			strconv.Itoa(nodeID),
+		)
+	}
 
-		// Emit GCD metric
-		if gcdRate, ok := matrix.GCD[nodeID]; ok {
+	// Emit device status metrics
+	if status := snapshot.Status; status != nil {
+		if status.FirmwareVersion != "" || status.HardwareRevision != "" {
 			ch <- prometheus.MustNewConstMetric(
-				c.phyRateGCD,
+				c.deviceInfo,
 				prometheus.GaugeValue,
-				float64(gcdRate),
+				1,
 				c.deviceName,
-				strconv.Itoa(nodeID),
+				status.FirmwareVersion,
+				status.HardwareRevision,
 			)
 		}
+		ch <- prometheus.MustNewConstMetric(c.deviceUptime, prometheus.GaugeValue, status.Uptime.Seconds(), c.deviceName)
+		if status.FrequencyMHz > 0 {
+			ch <- prometheus.MustNewConstMetric(c.mocaFrequency, prometheus.GaugeValue, float64(status.FrequencyMHz), c.deviceName)
+		}
 	}
 
-	return nil
+	// Emit interface counters, kept monotonic across device reboots by the tracker,
+	// which gather updates once per snapshot
+	if snapshot.Stats != nil {
+		for _, iface := range counterInterfaces {
+			totals, resets := c.counters.current(iface.name)
+			for i, total := range totals {
+				ch <- prometheus.MustNewConstMetric(c.ifaceCounters[i], prometheus.CounterValue, total, c.deviceName, iface.name)
+			}
+			ch <- prometheus.MustNewConstMetric(c.counterResets, prometheus.CounterValue, resets, c.deviceName, iface.name)
+		}
+	}
+
+	c.collectCustom(snapshot, ch)
+
+	for _, eventType := range EventTypes {
+		ch <- prometheus.MustNewConstMetric(c.eventsTotal, prometheus.CounterValue, c.events.count(eventType), c.deviceName, string(eventType))
+	}
+
+	return snapshot, nil
 }
 
-// formatMocaVersion formats a MoCA version code into a readable string
-func formatMocaVersion(version int) string {
+// FormatMocaVersion formats a MoCA version code (e.g. 0x25) into a readable string ("2.5")
+func FormatMocaVersion(version int) string {
 	major := (version & 0xF0) >> 4
 	minor := version & 0x0F
 
@@ -265,7 +711,18 @@ func formatMocaVersion(version int) string {
 	return fmt.Sprintf("%d.%d", major, minor)
 }
 
-// Close releases resources held by the collector
+// DeviceName returns the configured name of the device
+func (c *GoCoaxCollector) DeviceName() string {
+	return c.deviceName
+}
+
+// Address returns the device address (host:port)
+func (c *GoCoaxCollector) Address() string {
+	return c.address
+}
+
+// Close releases resources held by the collector, ending the queries in progress
 func (c *GoCoaxCollector) Close() error {
+	c.cancel()
 	return c.client.Close()
 }
@@ -0,0 +1,658 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/client"
+	"github.com/louispool/gocoax-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
+)
+
+var update = flag.Bool("update", false, "regenerate golden files in testdata/fixtures")
+
+// fixture is a synthetic set of device responses, keyed by "<endpoint> <request data>",
+// e.g. "/ms/0/0x1D [4,2]"
+type fixture struct {
+	Description string `json:"description"`
+	Source      string `json:"source"`
+
+	// KnownHTMLDifferences lists cells, e.g. "nper 1->2", where phyRates.html is known to
+	// show a different value than the exporter, with the reason
+	KnownHTMLDifferences map[string]string `json:"known_html_differences"`
+
+	Responses map[string][]string `json:"responses"`
+}
+
+// phyRatesHTML is the table the adapter's phyRates.html shows for a fixture, as
+// produced by testdata/phyrates_html.js. The diagonal holds the GCD rate.
+type phyRatesHTML struct {
+	NPER  map[int]map[int]int `json:"nper"`
+	VLPER map[int]map[int]int `json:"vlper"`
+}
+
+// newFixtureDevice starts an httptest server that replays a fixture like a goCoax device
+func newFixtureDevice(t testing.TB, c *fixture) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(newFixtureHandler(c))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newFixtureHandler replays a fixture
+func newFixtureHandler(c *fixture) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/phyRates.html", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/ms/0/", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var data bytes.Buffer
+		if err := json.Compact(&data, req.Data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		key := fmt.Sprintf("%s %s", r.URL.Path, data.String())
+		words, ok := c.Responses[key]
+		if !ok {
+			http.Error(w, "no fixture response for "+key, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string][]string{"data": words})
+	})
+	return mux
+}
+
+// compareGolden compares got against a golden file, rewriting it when -update is set
+func compareGolden(t *testing.T, path string, got []byte) {
+	t.Helper()
+
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s does not match:\n--- got ---\n%s\n--- want ---\n%s", filepath.Base(path), got, want)
+	}
+}
+
+func TestGoldenFixtures(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "fixtures", "*"))
+	if err != nil {
+		t.Fatalf("Failed to list fixtures: %v", err)
+	}
+	if len(dirs) == 0 {
+		t.Fatal("No fixtures found in testdata/fixtures")
+	}
+
+	for _, dir := range dirs {
+		name := filepath.Base(dir)
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(filepath.Join(dir, "fixture.json"))
+			if err != nil {
+				t.Fatalf("Failed to read fixture: %v", err)
+			}
+			var c fixture
+			if err := json.Unmarshal(raw, &c); err != nil {
+				t.Fatalf("Failed to parse fixture: %v", err)
+			}
+
+			// The status and counters are read too, for the fixtures that include them
+			profile := client.GoCoaxProfile
+			profile.Status = client.DefaultStatusLayout
+			profile.Stats = client.DefaultStatsLayout
+			device := newFixtureDevice(t, &c)
+			collector, err := New(context.Background(), name, strings.TrimPrefix(device.URL, "http://"),
+				WithCredentials("admin", "secret"),
+				WithTimeout(5*time.Second),
+				WithProfile(profile),
+			)
+			if err != nil {
+				t.Fatalf("Failed to create collector: %v", err)
+			}
+			defer collector.Close()
+
+			snapshot, err := collector.Gather(context.Background())
+			if err != nil {
+				t.Fatalf("Failed to gather snapshot: %v", err)
+			}
+
+			matrixJSON, err := json.MarshalIndent(snapshot.PHYRates, "", "  ")
+			if err != nil {
+				t.Fatalf("Failed to marshal matrix: %v", err)
+			}
+			compareGolden(t, filepath.Join(dir, "matrix.golden.json"), append(matrixJSON, '\n'))
+
+			// Scrape duration varies between runs and is left out of the golden output
+			metrics, err := testutil.CollectAndFormat(collector, expfmt.TypeTextPlain,
+				"gocoax_phy_rate_nper_mbps",
+				"gocoax_phy_rate_vlper_mbps",
+				"gocoax_phy_rate_gcd_mbps",
+				"gocoax_node_info",
+				"gocoax_up",
+				"gocoax_scrape_errors_total",
+				"gocoax_device_info",
+				"gocoax_device_uptime_seconds",
+				"gocoax_moca_frequency_mhz",
+				"gocoax_interface_rx_crc_errors_total",
+				"gocoax_interface_tx_bytes_total",
+				"gocoax_interface_counter_resets_total",
+				"gocoax_events_total",
+			)
+			if err != nil {
+				t.Fatalf("Failed to collect metrics: %v", err)
+			}
+			compareGolden(t, filepath.Join(dir, "metrics.golden.prom"), metrics)
+
+			checkPHYRatesHTML(t, dir, &c, snapshot)
+		})
+	}
+}
+
+// checkPHYRatesHTML checks the calculated matrix against the table the adapter's own
+// phyRates.html shows for the same fixture, when one has been generated
+func checkPHYRatesHTML(t *testing.T, dir string, c *fixture, snapshot *DeviceSnapshot) {
+	t.Helper()
+
+	raw, err := os.ReadFile(filepath.Join(dir, "phyrates_html.json"))
+	if os.IsNotExist(err) {
+		t.Logf("No phyrates_html.json for %s; run testdata/phyrates_html.js to generate it", dir)
+		return
+	}
+	if err != nil {
+		t.Fatalf("Failed to read phyrates_html.json: %v", err)
+	}
+
+	var html phyRatesHTML
+	if err := json.Unmarshal(raw, &html); err != nil {
+		t.Fatalf("Failed to parse phyrates_html.json: %v", err)
+	}
+
+	mismatch := func(kind string, from, to, got, want int) {
+		key := fmt.Sprintf("%s %d->%d", kind, from, to)
+		if reason, ok := c.KnownHTMLDifferences[key]; ok {
+			t.Logf("%s: got %d, phyRates.html shows %d (known: %s)", key, got, want, reason)
+			return
+		}
+		t.Errorf("%s: got %d, phyRates.html shows %d", key, got, want)
+	}
+
+	for from, row := range html.NPER {
+		for to, want := range row {
+			got := snapshot.PHYRates.NPER[from][to]
+			if from == to {
+				got = snapshot.PHYRates.GCD[from]
+			}
+			if got != want {
+				mismatch("nper", from, to, got, want)
+			}
+		}
+	}
+
+	for from, row := range html.VLPER {
+		for to, want := range row {
+			got := snapshot.PHYRates.VLPER[from][to]
+			if from == to {
+				// The page hides GCD in the VLPER view of a MoCA 1.x network
+				got = snapshot.PHYRates.GCD[from]
+				if snapshot.LocalInfo.MocaNetVersion < 0x20 {
+					got = 0
+				}
+			}
+			if got != want {
+				mismatch("vlper", from, to, got, want)
+			}
+		}
+	}
+}
+
+// loadFixture reads the fixture in testdata/fixtures/<name>
+func loadFixture(t testing.TB, name string) *fixture {
+	t.Helper()
+
+	raw, err := os.ReadFile(filepath.Join("testdata", "fixtures", name, "fixture.json"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	var c fixture
+	if err := json.Unmarshal(raw, &c); err != nil {
+		t.Fatalf("Failed to parse fixture: %v", err)
+	}
+	return &c
+}
+
+// countRequests counts the requests to each endpoint before passing them on
+type countRequests struct {
+	handler http.Handler
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (h *countRequests) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	if h.counts == nil {
+		h.counts = make(map[string]int)
+	}
+	h.counts[r.URL.Path]++
+	h.mu.Unlock()
+	h.handler.ServeHTTP(w, r)
+}
+
+// reset returns the counts so far and starts counting again
+func (h *countRequests) reset() map[string]int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	counts := h.counts
+	h.counts = nil
+	return counts
+}
+
+func TestGatherFMRRequests(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("testdata", "fixtures", "moca25-only", "matrix.golden.json"))
+	if err != nil {
+		t.Fatalf("Failed to read golden matrix: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		opts        []Option
+		expectedFMR []int // FMR requests of successive gathers
+	}{
+		// One request per node, as the web UI does
+		{name: "per-node", expectedFMR: []int{3, 3}},
+		// The first gather tries one request, then one per node; later gathers go
+		// straight to one per node
+		{name: "batch", opts: []Option{WithFMRBatch()}, expectedFMR: []int{4, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := loadFixture(t, "moca25-only")
+
+			// A device that answers a multi-node request with the first node's block only
+			c.Responses["/ms/0/0x1D [7,2]"] = c.Responses["/ms/0/0x1D [1,2]"]
+
+			device := &countRequests{handler: newFixtureHandler(c)}
+			server := httptest.NewServer(device)
+			defer server.Close()
+
+			collector, err := New(context.Background(), "moca25-only", strings.TrimPrefix(server.URL, "http://"),
+				append([]Option{WithCredentials("admin", "secret"), WithTimeout(5 * time.Second)}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("Failed to create collector: %v", err)
+			}
+			defer collector.Close()
+
+			for i, expectedFMR := range tt.expectedFMR {
+				snapshot, err := collector.Gather(context.Background())
+				if err != nil {
+					t.Fatalf("Gather %d: %v", i, err)
+				}
+				got, _ := json.MarshalIndent(snapshot.PHYRates, "", "  ")
+				if !bytes.Equal(append(got, '\n'), want) {
+					t.Errorf("Gather %d: matrix does not match the golden matrix:\n%s", i, got)
+				}
+				if n := device.reset()["/ms/0/0x1D"]; n != expectedFMR {
+					t.Errorf("Gather %d: expected %d FMR requests, got %d", i, expectedFMR, n)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGather reports the device requests per gather of a 16-node network
+func BenchmarkGather(b *testing.B) {
+	client.DebugOutput = io.Discard
+	defer func() { client.DebugOutput = os.Stdout }()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	device := &countRequests{handler: newFixtureHandler(loadFixture(b, "full-16-node"))}
+	server := httptest.NewServer(device)
+	defer server.Close()
+
+	collector, err := NewGoCoaxCollector("full-16-node", strings.TrimPrefix(server.URL, "http://"), "admin", "secret", 5*time.Second)
+	if err != nil {
+		b.Fatalf("Failed to create collector: %v", err)
+	}
+	defer collector.Close()
+	device.reset()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := collector.Gather(context.Background()); err != nil {
+			b.Fatalf("Failed to gather snapshot: %v", err)
+		}
+	}
+	b.StopTimer()
+
+	requests := 0
+	for path, n := range device.reset() {
+		if strings.HasPrefix(path, "/ms/") {
+			requests += n
+		}
+	}
+	b.ReportMetric(float64(requests)/float64(b.N), "requests/op")
+}
+
+func TestGatherCoalescesConcurrentCalls(t *testing.T) {
+	c := loadFixture(t, "single-node")
+	started := make(chan struct{})
+	release := make(chan struct{})
+	device := &countRequests{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hold the first request until every caller has started gathering
+		if r.URL.Path == "/ms/0/0x15" {
+			select {
+			case started <- struct{}{}:
+				<-release
+			default:
+			}
+		}
+		newFixtureHandler(c).ServeHTTP(w, r)
+	})}
+	server := httptest.NewServer(device)
+	defer server.Close()
+
+	collector, err := NewGoCoaxCollector("single-node", strings.TrimPrefix(server.URL, "http://"), "admin", "secret", 5*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	defer collector.Close()
+	var gathers []error
+	collector.OnGather(func(err error) { gathers = append(gathers, err) })
+
+	const callers = 3
+	snapshots := make([]*DeviceSnapshot, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			snapshot, err := collector.Gather(context.Background())
+			if err != nil {
+				t.Errorf("Gather %d: %v", i, err)
+			}
+			snapshots[i] = snapshot
+		}()
+		if i == 0 {
+			<-started
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := device.reset()["/ms/0/0x15"]; n != 1 {
+		t.Errorf("Expected one query of the device, got %d", n)
+	}
+	if len(gathers) != 1 || gathers[0] != nil {
+		t.Errorf("Expected the shared query to be reported once, got %v", gathers)
+	}
+	for i := 1; i < callers; i++ {
+		if snapshots[i] != snapshots[0] {
+			t.Errorf("Gather %d did not share the first result", i)
+		}
+	}
+}
+
+func TestGatherOutlivesCallerThatGivesUp(t *testing.T) {
+	c := loadFixture(t, "single-node")
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hold the first request until the first caller has given up
+		if r.URL.Path == "/ms/0/0x15" {
+			select {
+			case started <- struct{}{}:
+				<-release
+			default:
+			}
+		}
+		newFixtureHandler(c).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	collector, err := NewGoCoaxCollector("single-node", strings.TrimPrefix(server.URL, "http://"), "admin", "secret", 5*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	defer collector.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := collector.Gather(ctx)
+		first <- err
+	}()
+	<-started
+
+	second := make(chan *DeviceSnapshot, 1)
+	go func() {
+		snapshot, err := collector.Gather(context.Background())
+		if err != nil {
+			t.Errorf("Second Gather: %v", err)
+		}
+		second <- snapshot
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the first caller to give up with context.Canceled, got %v", err)
+	}
+	close(release)
+	if snapshot := <-second; snapshot == nil || len(snapshot.ActiveNodes) == 0 {
+		t.Errorf("Expected the second caller to get the shared snapshot, got %+v", snapshot)
+	}
+}
+
+func TestGatherCancelledWhenLastCallerLeaves(t *testing.T) {
+	c := loadFixture(t, "single-node")
+	started := make(chan struct{})
+	aborted := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hold the first query until the client goes away
+		if r.URL.Path == "/ms/0/0x15" {
+			select {
+			case started <- struct{}{}:
+				io.Copy(io.Discard, r.Body)
+				<-r.Context().Done()
+				close(aborted)
+				return
+			default:
+			}
+		}
+		newFixtureHandler(c).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	collector, err := NewGoCoaxCollector("single-node", strings.TrimPrefix(server.URL, "http://"), "admin", "secret", 30*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	defer collector.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := collector.Gather(ctx)
+		done <- err
+	}()
+	<-started
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// The device sees the request aborted long before the collector's timeout
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the device request to be aborted once the only caller left")
+	}
+}
+
+func TestNewOptions(t *testing.T) {
+	server := newFixtureDevice(t, loadFixture(t, "single-node"))
+
+	var events []Event
+	collector, err := New(context.Background(), "single-node", strings.TrimPrefix(server.URL, "http://"),
+		WithCredentials("admin", "secret"),
+		WithTimeout(3*time.Second),
+		WithCircuitBreaker(2, time.Minute, time.Hour),
+		WithStepChangePercent(10),
+		WithEventHandler(func(e Event) { events = append(events, e) }),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	defer collector.Close()
+
+	if collector.timeout != 3*time.Second {
+		t.Errorf("Expected timeout 3s, got %s", collector.timeout)
+	}
+	if collector.breaker == nil || collector.breaker.threshold != 2 {
+		t.Errorf("Expected a circuit breaker opening after 2 failures, got %+v", collector.breaker)
+	}
+	if collector.events.stepPercent != 10 {
+		t.Errorf("Expected step change of 10%%, got %v", collector.events.stepPercent)
+	}
+	if collector.onEvent == nil {
+		t.Error("Expected the event handler to be set")
+	}
+
+	snapshot, err := collector.Gather(context.Background())
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	if snapshot.Device != "single-node" || len(snapshot.PHYRates.NPER) == 0 {
+		t.Errorf("Unexpected snapshot of %s with %d NPER rows", snapshot.Device, len(snapshot.PHYRates.NPER))
+	}
+}
+
+func TestAuthenticatorFromConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.AuthConfig
+		want client.Authenticator
+	}{
+		{name: "unset", want: client.BasicAuth{}},
+		{name: "basic", cfg: &config.AuthConfig{Method: config.AuthBasic}, want: client.BasicAuth{}},
+		{
+			name: "form",
+			cfg:  &config.AuthConfig{Method: config.AuthForm, LoginPath: "/login", UsernameField: "user"},
+			want: client.FormAuth{Path: "/login", UsernameField: "user"},
+		},
+		{
+			name: "challenge",
+			cfg:  &config.AuthConfig{Method: config.AuthChallenge, ChallengePath: "/nonce", PasswordField: "hash"},
+			want: client.ChallengeAuth{ChallengePath: "/nonce", PasswordField: "hash"},
+		},
+		{name: "auto", cfg: &config.AuthConfig{Method: config.AuthAuto}, want: client.AutoAuth{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AuthenticatorFromConfig(tt.cfg); got != tt.want {
+				t.Errorf("Expected %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestProfileFromConfig(t *testing.T) {
+	if got, err := ProfileFromConfig(nil); err != nil || got.Name != client.GoCoaxProfile.Name || got.LocalInfo != client.GoCoaxProfile.LocalInfo {
+		t.Errorf("Expected the goCoax profile without a configuration, got %+v, %v", got, err)
+	}
+
+	got, err := ProfileFromConfig(&config.ProfileConfig{
+		Name:        "screenbeam",
+		SessionPath: "/main.html",
+		CSRFCookies: []string{"sb_csrf"},
+		Auth:        &config.AuthConfig{Method: config.AuthAuto},
+		Endpoints:   map[string]string{"local_info": "/ms/0/0x25", "reboot": "/ms/1/0xc00"},
+		LocalInfo:   map[string]int{"node_bitmask": 13},
+		NodeInfo:    map[string]int{"moca_version": 5},
+	})
+	if err != nil {
+		t.Fatalf("ProfileFromConfig failed: %v", err)
+	}
+
+	want := client.GoCoaxProfile
+	want.Name = "screenbeam"
+	want.SessionPath = "/main.html"
+	want.Auth = client.AutoAuth{}
+	want.LocalInfo.Endpoint = "/ms/0/0x25"
+	want.LocalInfo.NodeBitMask = 13
+	want.NodeInfo.MocaVersion = 5
+	want.RebootEndpoint = "/ms/1/0xc00"
+	if got.Name != want.Name || got.SessionPath != want.SessionPath || got.Auth != want.Auth ||
+		got.LocalInfo != want.LocalInfo || got.NodeInfo != want.NodeInfo ||
+		got.FMREndpoint != want.FMREndpoint || got.RebootEndpoint != want.RebootEndpoint {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+	if len(got.CSRFCookies) != 1 || got.CSRFCookies[0] != "sb_csrf" {
+		t.Errorf("Expected CSRF cookie sb_csrf, got %v", got.CSRFCookies)
+	}
+	if len(client.GoCoaxProfile.CSRFCookies) != 2 || client.GoCoaxProfile.LocalInfo.NodeBitMask != 12 {
+		t.Errorf("Expected the goCoax profile to be left as it was, got %+v", client.GoCoaxProfile)
+	}
+	if got.Status.Endpoint != "" || got.Stats.Endpoint != "" {
+		t.Errorf("Expected the status and counters not to be read without endpoints, got %+v, %+v", got.Status, got.Stats)
+	}
+
+	// Setting the status endpoint reads it with the default layout
+	got, err = ProfileFromConfig(&config.ProfileConfig{Name: "status", Endpoints: map[string]string{"status": "/ms/0/0x24"}})
+	if err != nil {
+		t.Fatalf("ProfileFromConfig failed: %v", err)
+	}
+	if want := client.DefaultStatusLayout; got.Status.Endpoint != "/ms/0/0x24" || got.Status.Uptime != want.Uptime {
+		t.Errorf("Expected the default status layout at /ms/0/0x24, got %+v", got.Status)
+	}
+	if got.Stats.Endpoint != "" {
+		t.Errorf("Expected the counters not to be read without their endpoint, got %+v", got.Stats)
+	}
+
+	// Keys of an unvalidated configuration are checked
+	for _, cfg := range []*config.ProfileConfig{
+		{Name: "typo", Endpoints: map[string]string{"localinfo": "/ms/0/0x25"}},
+		{Name: "typo", LocalInfo: map[string]int{"node_id": 1}},
+		{Name: "typo", NodeInfo: map[string]int{"mac": 1}},
+	} {
+		if _, err := ProfileFromConfig(cfg); err == nil || !strings.Contains(err.Error(), "unknown") {
+			t.Errorf("Expected an error for an unknown key in %+v, got %v", cfg, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/client"
+)
+
+// interfaceCounter describes one exported interface counter
+type interfaceCounter struct {
+	name  string
+	help  string
+	value func(client.InterfaceStats) uint64
+}
+
+// interfaceCounters are exported per interface as gocoax_interface_<name>_total
+var interfaceCounters = []interfaceCounter{
+	{"tx_packets", "Packets transmitted on the interface", func(s client.InterfaceStats) uint64 { return s.TxPackets }},
+	{"rx_packets", "Packets received on the interface", func(s client.InterfaceStats) uint64 { return s.RxPackets }},
+	{"tx_bytes", "Bytes transmitted on the interface", func(s client.InterfaceStats) uint64 { return s.TxBytes }},
+	{"rx_bytes", "Bytes received on the interface", func(s client.InterfaceStats) uint64 { return s.RxBytes }},
+	{"rx_crc_errors", "Frames received with CRC errors on the interface", func(s client.InterfaceStats) uint64 { return s.RxCRCErrors }},
+	{"tx_dropped", "Frames dropped before transmission on the interface", func(s client.InterfaceStats) uint64 { return s.TxDropped }},
+	{"rx_dropped", "Received frames dropped on the interface", func(s client.InterfaceStats) uint64 { return s.RxDropped }},
+}
+
+// counterInterfaces are the interfaces of DeviceStats, by their interface label
+var counterInterfaces = []struct {
+	name  string
+	stats func(*client.DeviceStats) client.InterfaceStats
+}{
+	{"ethernet", func(s *client.DeviceStats) client.InterfaceStats { return s.Ethernet }},
+	{"moca", func(s *client.DeviceStats) client.InterfaceStats { return s.MoCA }},
+}
+
+// counterTracker turns raw device counters, which restart from zero when the device
+// reboots, into monotonic counters. A raw value lower than the previous one, or a
+// drop in device uptime, is taken as a reset: everything counted since then is added
+// to the total.
+type counterTracker struct {
+	mu         sync.Mutex
+	last       map[string][]uint64  // [interface] = raw values in interfaceCounters order
+	totals     map[string][]float64 // [interface] = monotonic totals
+	resets     map[string]float64   // [interface] = detected resets
+	lastUptime time.Duration
+	lastTime   time.Time // time of the last snapshot applied
+}
+
+// newCounterTracker creates an empty tracker
+func newCounterTracker() *counterTracker {
+	return &counterTracker{
+		last:   make(map[string][]uint64),
+		totals: make(map[string][]float64),
+		resets: make(map[string]float64),
+	}
+}
+
+// observe applies the counters of a snapshot, once per snapshot. Snapshots older than
+// the last one applied, from overlapping gathers, are ignored, so that they are not
+// taken as a reset.
+func (t *counterTracker) observe(s *DeviceSnapshot) {
+	if s.Stats == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s.Time.Before(t.lastTime) {
+		return
+	}
+	t.lastTime = s.Time
+
+	rebooted := false
+	if s.Status != nil {
+		rebooted = t.observeUptime(s.Status.Uptime)
+	}
+	for _, iface := range counterInterfaces {
+		t.update(iface.name, iface.stats(s.Stats), rebooted)
+	}
+}
+
+// current returns the monotonic totals of an interface in interfaceCounters order,
+// along with the number of resets detected so far
+func (t *counterTracker) current(iface string) ([]float64, float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]float64(nil), t.totals[iface]...), t.resets[iface]
+}
+
+// observeUptime records the device uptime and reports whether the device rebooted
+// since the previous observation. t.mu must be held.
+func (t *counterTracker) observeUptime(uptime time.Duration) bool {
+	rebooted := t.lastUptime > 0 && uptime < t.lastUptime
+	t.lastUptime = uptime
+	return rebooted
+}
+
+// update records the raw counters of an interface and returns the monotonic totals in
+// interfaceCounters order, along with the number of resets detected so far. t.mu must
+// be held.
+func (t *counterTracker) update(iface string, stats client.InterfaceStats, rebooted bool) ([]float64, float64) {
+	raw := make([]uint64, len(interfaceCounters))
+	for i, counter := range interfaceCounters {
+		raw[i] = counter.value(stats)
+	}
+
+	last, seen := t.last[iface]
+	if !seen {
+		// Start from the device's own count
+		totals := make([]float64, len(raw))
+		for i, v := range raw {
+			totals[i] = float64(v)
+		}
+		t.last[iface] = raw
+		t.totals[iface] = totals
+		return append([]float64(nil), totals...), t.resets[iface]
+	}
+
+	reset := rebooted
+	for i := range raw {
+		if raw[i] < last[i] {
+			reset = true
+		}
+	}
+	if reset {
+		t.resets[iface]++
+	}
+
+	totals := t.totals[iface]
+	for i := range raw {
+		if reset {
+			totals[i] += float64(raw[i])
+		} else {
+			totals[i] += float64(raw[i] - last[i])
+		}
+	}
+	t.last[iface] = raw
+
+	return append([]float64(nil), totals...), t.resets[iface]
+}
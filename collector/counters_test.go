@@ -0,0 +1,96 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/client"
+)
+
+func TestCounterTracker(t *testing.T) {
+	tracker := newCounterTracker()
+
+	steps := []struct {
+		name           string
+		txPackets      uint64
+		rebooted       bool
+		expectedTotal  float64
+		expectedResets float64
+	}{
+		{"starts from device count", 1000, false, 1000, 0},
+		{"adds increase", 1500, false, 1500, 0},
+		{"unchanged", 1500, false, 1500, 0},
+		{"raw value drops after reboot", 200, false, 1700, 1},
+		{"increase after reset", 300, false, 1800, 1},
+		{"reboot detected by uptime", 900, true, 2700, 2},
+	}
+
+	for _, step := range steps {
+		totals, resets := tracker.update("ethernet", client.InterfaceStats{TxPackets: step.txPackets}, step.rebooted)
+		if totals[0] != step.expectedTotal {
+			t.Errorf("%s: expected total %v, got %v", step.name, step.expectedTotal, totals[0])
+		}
+		if resets != step.expectedResets {
+			t.Errorf("%s: expected %v resets, got %v", step.name, step.expectedResets, resets)
+		}
+	}
+
+	// Interfaces are tracked independently
+	totals, resets := tracker.update("moca", client.InterfaceStats{TxPackets: 5}, false)
+	if totals[0] != 5 || resets != 0 {
+		t.Errorf("Expected independent moca counters, got total %v and %v resets", totals[0], resets)
+	}
+}
+
+func TestCounterTrackerUptime(t *testing.T) {
+	tracker := newCounterTracker()
+
+	if tracker.observeUptime(time.Hour) {
+		t.Error("First observation should not count as a reboot")
+	}
+	if tracker.observeUptime(2 * time.Hour) {
+		t.Error("Increasing uptime should not count as a reboot")
+	}
+	if !tracker.observeUptime(time.Minute) {
+		t.Error("Uptime drop should count as a reboot")
+	}
+}
+
+func TestCounterTrackerObserve(t *testing.T) {
+	tracker := newCounterTracker()
+	start := time.Unix(1700000000, 0)
+	snapshot := func(offset time.Duration, uptime time.Duration, txPackets uint64) *DeviceSnapshot {
+		return &DeviceSnapshot{
+			Time:   start.Add(offset),
+			Status: &client.DeviceStatus{Uptime: uptime},
+			Stats:  &client.DeviceStats{Ethernet: client.InterfaceStats{TxPackets: txPackets}},
+		}
+	}
+
+	tracker.observe(snapshot(0, time.Hour, 1000))
+	newer := snapshot(time.Minute, time.Hour+time.Minute, 1500)
+	tracker.observe(newer)
+
+	// A snapshot from an older gather arriving late is neither a reboot nor a reset
+	tracker.observe(snapshot(30*time.Second, time.Hour+30*time.Second, 1200))
+	if totals, resets := tracker.current("ethernet"); totals[0] != 1500 || resets != 0 {
+		t.Errorf("Expected a stale snapshot to be ignored, got total %v and %v resets", totals[0], resets)
+	}
+
+	// Observing the same snapshot again adds nothing
+	tracker.observe(newer)
+	if totals, _ := tracker.current("ethernet"); totals[0] != 1500 {
+		t.Errorf("Expected total 1500, got %v", totals[0])
+	}
+
+	tracker.observe(snapshot(2*time.Minute, time.Second, 1600))
+	if totals, resets := tracker.current("ethernet"); totals[0] != 3100 || resets != 1 {
+		t.Errorf("Expected a reboot to add on top of the total, got total %v and %v resets", totals[0], resets)
+	}
+
+	// Snapshots without counters leave the totals alone
+	tracker.observe(&DeviceSnapshot{Time: start.Add(3 * time.Minute)})
+	if totals, _ := tracker.current("moca"); totals[0] != 0 {
+		t.Errorf("Expected moca total 0, got %v", totals[0])
+	}
+}
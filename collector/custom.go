@@ -0,0 +1,103 @@
+package collector
+
+import (
+	"context"
+	"log"
+
+	"github.com/louispool/gocoax-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// customEndpoint is a device API call whose response words are exported as metrics
+type customEndpoint struct {
+	endpoint string
+	data     []int
+	metrics  []customMetric
+}
+
+// customMetric is one metric read from bits of a response word
+type customMetric struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	word      int
+	mask      uint32
+	shift     int
+}
+
+// newCustomEndpoints creates the endpoints of a custom_metrics configuration
+func newCustomEndpoints(cfg []config.CustomEndpoint) []customEndpoint {
+	endpoints := make([]customEndpoint, 0, len(cfg))
+	for _, e := range cfg {
+		endpoint := customEndpoint{endpoint: e.Endpoint, data: e.Data}
+		for _, m := range e.Metrics {
+			valueType := prometheus.GaugeValue
+			if m.Type == config.CustomCounter {
+				valueType = prometheus.CounterValue
+			}
+			endpoint.metrics = append(endpoint.metrics, customMetric{
+				desc:      prometheus.NewDesc(m.Name, m.Help, []string{"device"}, m.Labels),
+				valueType: valueType,
+				word:      m.Word,
+				mask:      m.Mask,
+				shift:     m.Shift,
+			})
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
+
+// value extracts the metric from the response words of its endpoint
+func (m customMetric) value(words []uint32) (float64, bool) {
+	if m.word >= len(words) {
+		return 0, false
+	}
+	return float64((words[m.word] & m.mask) >> m.shift), true
+}
+
+// gatherCustom calls the custom endpoints and returns their response words in the
+// same order, nil where a call failed
+func (c *GoCoaxCollector) gatherCustom(ctx context.Context) [][]uint32 {
+	if len(c.custom) == 0 {
+		return nil
+	}
+
+	words := make([][]uint32, len(c.custom))
+	for i, e := range c.custom {
+		w, err := c.client.GetWords(ctx, e.endpoint, e.data)
+		if err != nil {
+			log.Printf("Warning: failed to get custom metrics of device %s: %v", c.deviceName, err)
+			continue
+		}
+		words[i] = w
+	}
+	return words
+}
+
+// describeCustom sends the descriptors of the custom metrics
+func (c *GoCoaxCollector) describeCustom(ch chan<- *prometheus.Desc) {
+	for _, e := range c.custom {
+		for _, m := range e.metrics {
+			ch <- m.desc
+		}
+	}
+}
+
+// collectCustom emits the custom metrics of a snapshot. Metrics whose word is beyond
+// the end of the response are left out.
+func (c *GoCoaxCollector) collectCustom(snapshot *DeviceSnapshot, ch chan<- prometheus.Metric) {
+	for i, words := range snapshot.CustomWords {
+		if words == nil || i >= len(c.custom) {
+			continue
+		}
+		for _, m := range c.custom[i].metrics {
+			value, ok := m.value(words)
+			if !ok {
+				log.Printf("Warning: %s of device %s returned %d words, metric needs word %d",
+					c.custom[i].endpoint, c.deviceName, len(words), m.word)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, value, c.deviceName)
+		}
+	}
+}
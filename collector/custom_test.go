@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCustomMetrics(t *testing.T) {
+	server := newFixtureDevice(t, loadFixture(t, "single-node"))
+
+	// Local info words: [11] = 0x25 is the MoCA network version, [12] the node bitmask
+	endpoints := []config.CustomEndpoint{
+		{
+			Endpoint: "/ms/0/0x15",
+			Metrics: []config.CustomMetric{
+				{Name: "gocoax_custom_moca_version", Help: "MoCA version digit", Type: config.CustomGauge, Word: 11, Mask: 0xF0, Shift: 4, Labels: map[string]string{"digit": "major"}},
+				{Name: "gocoax_custom_moca_version", Help: "MoCA version digit", Type: config.CustomGauge, Word: 11, Mask: 0x0F, Labels: map[string]string{"digit": "minor"}},
+				{Name: "gocoax_custom_node_bitmask", Help: "Node bitmask", Type: config.CustomGauge, Word: 12, Mask: 0xFFFFFFFF},
+				{Name: "gocoax_custom_missing", Help: "Beyond the response", Type: config.CustomCounter, Word: 500, Mask: 0xFFFFFFFF},
+			},
+		},
+		{
+			// Not in the fixture, so the call fails and its metrics are left out
+			Endpoint: "/ms/0/0x99",
+			Metrics: []config.CustomMetric{
+				{Name: "gocoax_custom_unknown", Help: "Unknown call", Type: config.CustomGauge, Mask: 0xFFFFFFFF},
+			},
+		},
+	}
+
+	collector, err := New(context.Background(), "single-node", strings.TrimPrefix(server.URL, "http://"),
+		WithTimeout(5*time.Second), WithCustomMetrics(endpoints))
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	defer collector.Close()
+
+	metrics := `
+# HELP gocoax_custom_moca_version MoCA version digit
+# TYPE gocoax_custom_moca_version gauge
+gocoax_custom_moca_version{device="single-node",digit="major"} 2
+gocoax_custom_moca_version{device="single-node",digit="minor"} 5
+# HELP gocoax_custom_node_bitmask Node bitmask
+# TYPE gocoax_custom_node_bitmask gauge
+gocoax_custom_node_bitmask{device="single-node"} 1
+# HELP gocoax_up Device is reachable and responding (1=up, 0=down)
+# TYPE gocoax_up gauge
+gocoax_up{device="single-node"} 1
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(metrics),
+		"gocoax_custom_moca_version", "gocoax_custom_node_bitmask", "gocoax_custom_missing", "gocoax_custom_unknown", "gocoax_up"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,24 @@
+// Package collector reads goCoax MoCA adapters and exports their state to Prometheus.
+//
+// The MoCA logic is usable without Prometheus. New creates a collector for one
+// adapter, and Gather returns a DeviceSnapshot: the adapter's local info, with the
+// network coordinator and node bitmask, the MoCA version of every active node and the
+// PHY rate matrix between them, calculated as the adapter's PHY Rates page does:
+//
+//	c, err := collector.New(ctx, "bridge-50", "192.168.98.50:80",
+//		collector.WithCredentials("admin", "secret"))
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//
+//	snapshot, err := c.Gather(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	fmt.Println(snapshot.PHYRates.NPER[0][1]) // Mbps from node 0 to node 1
+//
+// GoCoaxCollector also implements prometheus.Collector, emitting the metrics of a
+// snapshot on every scrape, and MultiDeviceRegistry does so for all devices of a
+// configuration. Package client provides the adapter's API requests on their own.
+package collector
@@ -0,0 +1,168 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EventType identifies a change in a device's MoCA network
+type EventType string
+
+// Event types, in the order they are reported for one snapshot
+const (
+	EventNodeJoined         EventType = "node_joined"
+	EventNodeLeft           EventType = "node_left"
+	EventNCChanged          EventType = "nc_changed"
+	EventMocaVersionChanged EventType = "moca_version_changed"
+	EventPHYRateStepChange  EventType = "phy_rate_step_change"
+)
+
+// DefaultStepChangePercent is the PHY rate change reported as a step change unless
+// configured otherwise
+const DefaultStepChangePercent = 25
+
+// EventTypes lists all event types
+var EventTypes = []EventType{
+	EventNodeJoined,
+	EventNodeLeft,
+	EventNCChanged,
+	EventMocaVersionChanged,
+	EventPHYRateStepChange,
+}
+
+// Event is a change between two successive snapshots of a device
+type Event struct {
+	Time    time.Time `json:"time"`
+	Device  string    `json:"device"`
+	Type    EventType `json:"type"`
+	Node    *int      `json:"node,omitempty"`    // node the event is about; the source node of a link
+	ToNode  *int      `json:"to_node,omitempty"` // destination node of a link
+	Old     *int      `json:"old,omitempty"`     // previous NC node, MoCA version or rate
+	New     *int      `json:"new,omitempty"`     // new NC node, MoCA version or rate
+	Message string    `json:"message"`
+}
+
+// intPtr returns a pointer to a copy of v
+func intPtr(v int) *int {
+	return &v
+}
+
+// DiffSnapshots returns the events between two successive snapshots of a device.
+// Joins and leaves follow the node bitmask. A PHY rate step change is an NPER rate of
+// a link present in both snapshots that changed by at least stepPercent percent;
+// partial snapshots have no rates to compare.
+func DiffSnapshots(prev, cur *DeviceSnapshot, stepPercent float64) []Event {
+	var events []Event
+	add := func(e Event) {
+		e.Time = cur.Time
+		e.Device = cur.Device
+		events = append(events, e)
+	}
+
+	// Membership comes from the node bitmask, so a node whose info could not be read
+	// is not reported as gone
+	prevMask, curMask := prev.LocalInfo.NodeBitMask, cur.LocalInfo.NodeBitMask
+	for node := 0; node < MAX_NUM_NODES; node++ {
+		bit := 1 << node
+		switch {
+		case curMask&bit != 0 && prevMask&bit == 0:
+			message := fmt.Sprintf("node %d joined", node)
+			if version, ok := cur.NodeVersions[node]; ok {
+				message += " with MoCA " + FormatMocaVersion(version)
+			}
+			add(Event{Type: EventNodeJoined, Node: intPtr(node), Message: message})
+		case curMask&bit == 0 && prevMask&bit != 0:
+			add(Event{Type: EventNodeLeft, Node: intPtr(node), Message: fmt.Sprintf("node %d left", node)})
+		}
+	}
+
+	if oldNC, newNC := prev.LocalInfo.NCNodeID, cur.LocalInfo.NCNodeID; oldNC != newNC {
+		add(Event{Type: EventNCChanged, Old: intPtr(oldNC), New: intPtr(newNC),
+			Message: fmt.Sprintf("network coordinator moved from node %d to node %d", oldNC, newNC)})
+	}
+
+	for _, node := range sortedNodes(cur.NodeVersions) {
+		oldVer, ok := prev.NodeVersions[node]
+		if newVer := cur.NodeVersions[node]; ok && oldVer != newVer {
+			add(Event{Type: EventMocaVersionChanged, Node: intPtr(node), Old: intPtr(oldVer), New: intPtr(newVer),
+				Message: fmt.Sprintf("node %d MoCA version changed from %s to %s", node, FormatMocaVersion(oldVer), FormatMocaVersion(newVer))})
+		}
+	}
+
+	if prev.PHYRates == nil || cur.PHYRates == nil || prev.Partial || cur.Partial {
+		return events
+	}
+	for _, from := range sortedNodes(cur.PHYRates.NPER) {
+		for _, to := range sortedNodes(cur.PHYRates.NPER[from]) {
+			oldRate, ok := prev.PHYRates.NPER[from][to]
+			newRate := cur.PHYRates.NPER[from][to]
+			if !ok || oldRate <= 0 {
+				continue
+			}
+			change := float64(newRate-oldRate) / float64(oldRate) * 100
+			if change >= stepPercent || -change >= stepPercent {
+				add(Event{Type: EventPHYRateStepChange, Node: intPtr(from), ToNode: intPtr(to), Old: intPtr(oldRate), New: intPtr(newRate),
+					Message: fmt.Sprintf("PHY rate %d->%d changed from %d to %d Mbps (%+.0f%%)", from, to, oldRate, newRate, change)})
+			}
+		}
+	}
+
+	return events
+}
+
+// sortedNodes returns the node IDs of a map in ascending order
+func sortedNodes[V any](m map[int]V) []int {
+	nodes := make([]int, 0, len(m))
+	for node := range m {
+		nodes = append(nodes, node)
+	}
+	sort.Ints(nodes)
+	return nodes
+}
+
+// eventTracker diffs successive snapshots of a device and counts the events
+type eventTracker struct {
+	mu          sync.Mutex
+	prev        *DeviceSnapshot
+	counts      map[EventType]float64
+	stepPercent float64
+}
+
+// newEventTracker creates a tracker with no previous snapshot
+func newEventTracker() *eventTracker {
+	return &eventTracker{
+		counts:      make(map[EventType]float64),
+		stepPercent: DefaultStepChangePercent,
+	}
+}
+
+// observe diffs a snapshot against the previous one and returns the new events.
+// Snapshots older than the previous one, from overlapping gathers, are ignored.
+func (t *eventTracker) observe(s *DeviceSnapshot) []Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prev := t.prev
+	if prev != nil && s.Time.Before(prev.Time) {
+		return nil
+	}
+	t.prev = s
+	if prev == nil {
+		return nil
+	}
+
+	events := DiffSnapshots(prev, s, t.stepPercent)
+	for _, e := range events {
+		t.counts[e.Type]++
+	}
+	return events
+}
+
+// count returns the number of events of a type seen so far
+func (t *eventTracker) count(eventType EventType) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.counts[eventType]
+}
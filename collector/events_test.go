@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/client"
+)
+
+// eventSnapshot builds a snapshot of nodes with the given MoCA versions, NC node and
+// 0->1 NPER rate
+func eventSnapshot(at time.Time, nc int, versions map[int]int, rate int) *DeviceSnapshot {
+	mask := 0
+	for node := range versions {
+		mask |= 1 << node
+	}
+	rates := NewPHYRateMatrix()
+	rates.NPER[0] = map[int]int{1: rate}
+	return &DeviceSnapshot{
+		Device:       "bridge-50",
+		Time:         at,
+		LocalInfo:    &client.LocalInfo{NCNodeID: nc, NodeBitMask: mask},
+		NodeVersions: versions,
+		PHYRates:     rates,
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	prev := eventSnapshot(t0, 0, map[int]int{0: 0x25, 1: 0x25, 2: 0x20}, 3000)
+	cur := eventSnapshot(t0.Add(time.Minute), 1, map[int]int{0: 0x25, 1: 0x20, 3: 0x25}, 2000)
+
+	events := DiffSnapshots(prev, cur, 25)
+
+	expected := []struct {
+		eventType EventType
+		message   string
+	}{
+		{EventNodeLeft, "node 2 left"},
+		{EventNodeJoined, "node 3 joined with MoCA 2.5"},
+		{EventNCChanged, "network coordinator moved from node 0 to node 1"},
+		{EventMocaVersionChanged, "node 1 MoCA version changed from 2.5 to 2.0"},
+		{EventPHYRateStepChange, "PHY rate 0->1 changed from 3000 to 2000 Mbps (-33%)"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d: %+v", len(expected), len(events), events)
+	}
+	for i, e := range events {
+		if e.Type != expected[i].eventType || e.Message != expected[i].message {
+			t.Errorf("Event %d: expected %s %q, got %s %q", i, expected[i].eventType, expected[i].message, e.Type, e.Message)
+		}
+		if e.Device != "bridge-50" || !e.Time.Equal(cur.Time) {
+			t.Errorf("Event %d: unexpected device or time: %+v", i, e)
+		}
+	}
+	if nc := events[2]; *nc.Old != 0 || *nc.New != 1 {
+		t.Errorf("Unexpected NC change values: old %d, new %d", *nc.Old, *nc.New)
+	}
+	if step := events[4]; *step.Node != 0 || *step.ToNode != 1 || *step.New != 2000 {
+		t.Errorf("Unexpected step change event: %+v", step)
+	}
+}
+
+func TestDiffSnapshotsQuiet(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	prev := eventSnapshot(t0, 0, map[int]int{0: 0x25, 1: 0x25}, 3000)
+
+	// A small rate change is not a step
+	cur := eventSnapshot(t0.Add(time.Minute), 0, map[int]int{0: 0x25, 1: 0x25}, 2800)
+	if events := DiffSnapshots(prev, cur, 25); len(events) != 0 {
+		t.Errorf("Expected no events, got %+v", events)
+	}
+
+	// A node whose info could not be read is still in the bitmask, so it has not left
+	cur = eventSnapshot(t0.Add(time.Minute), 0, map[int]int{0: 0x25, 1: 0x25}, 3000)
+	delete(cur.NodeVersions, 1)
+	if events := DiffSnapshots(prev, cur, 25); len(events) != 0 {
+		t.Errorf("Expected no events for a node with missing info, got %+v", events)
+	}
+}
+
+func TestEventTracker(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := newEventTracker()
+
+	if events := tracker.observe(eventSnapshot(t0, 0, map[int]int{0: 0x25}, 3000)); events != nil {
+		t.Errorf("Expected no events for the first snapshot, got %+v", events)
+	}
+	joined := eventSnapshot(t0.Add(2*time.Minute), 0, map[int]int{0: 0x25, 1: 0x25}, 3000)
+	if events := tracker.observe(joined); len(events) != 1 {
+		t.Errorf("Expected a join event, got %+v", events)
+	}
+
+	// A snapshot older than the last one, from an overlapping gather, is ignored
+	if events := tracker.observe(eventSnapshot(t0.Add(time.Minute), 0, map[int]int{0: 0x25}, 3000)); events != nil {
+		t.Errorf("Expected an out-of-order snapshot to be ignored, got %+v", events)
+	}
+
+	if got := tracker.count(EventNodeJoined); got != 1 {
+		t.Errorf("Expected 1 join counted, got %v", got)
+	}
+	if got := tracker.count(EventNodeLeft); got != 0 {
+		t.Errorf("Expected no leaves counted, got %v", got)
+	}
+}
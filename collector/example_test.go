@@ -0,0 +1,60 @@
+package collector_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Read the PHY rate matrix of an adapter without Prometheus
+func ExampleGoCoaxCollector_Gather() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c, err := collector.New(ctx, "bridge-50", "192.168.98.50:80",
+		collector.WithCredentials("admin", "secret"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	snapshot, err := c.Gather(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("MoCA %s network, NC is node %d\n",
+		collector.FormatMocaVersion(snapshot.LocalInfo.MocaNetVersion), snapshot.LocalInfo.NCNodeID)
+	for _, from := range snapshot.ActiveNodes {
+		for _, to := range snapshot.ActiveNodes {
+			if rate, ok := snapshot.PHYRates.NPER[from][to]; ok {
+				fmt.Printf("%d -> %d: %d Mbps\n", from, to, rate)
+			}
+		}
+	}
+}
+
+// Export an adapter's metrics from your own service
+func ExampleNew() {
+	c, err := collector.New(context.Background(), "bridge-50", "192.168.98.50:80",
+		collector.WithCredentials("admin", "secret"),
+		collector.WithTimeout(5*time.Second),
+		collector.WithCircuitBreaker(3, 30*time.Second, 10*time.Minute),
+		collector.WithEventHandler(func(e collector.Event) {
+			log.Printf("%s: %s", e.Device, e.Message)
+		}))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+}
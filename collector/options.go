@@ -0,0 +1,115 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/louispool/gocoax-exporter/client"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// Option configures a collector created with New
+type Option func(*options)
+
+// options holds the settings of New
+type options struct {
+	timeout time.Duration
+	client  []client.Option
+	setup   []func(*GoCoaxCollector) // applied to the new collector
+}
+
+// WithCredentials sets the username and password of the adapter's web interface,
+// admin and gocoax by default
+func WithCredentials(username, password string) Option {
+	return func(o *options) {
+		o.client = append(o.client, client.WithCredentials(username, password))
+	}
+}
+
+// WithAuthenticator sets how the client logs into the adapter, the profile's
+// authenticator or client.BasicAuth by default
+func WithAuthenticator(auth client.Authenticator) Option {
+	return func(o *options) {
+		o.client = append(o.client, client.WithAuthenticator(auth))
+	}
+}
+
+// WithProfile sets the interface of the adapter, client.GoCoaxProfile by default
+func WithProfile(profile client.Profile) Option {
+	return func(o *options) {
+		o.client = append(o.client, client.WithProfile(profile))
+	}
+}
+
+// WithFMRBatch requests the FMR data of all nodes sharing a MoCA version in one request
+// instead of one request per node. The layout of the adapter's answer has not been
+// confirmed; a device answering with another layout is asked one node at a time.
+func WithFMRBatch() Option {
+	return func(o *options) {
+		o.setup = append(o.setup, func(c *GoCoaxCollector) {
+			c.fmrBatch = true
+		})
+	}
+}
+
+// WithTimeout sets the timeout of a collection, of a query of the adapter and of each
+// request to it, 10 seconds by default
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithMinRequestInterval sets the minimum time between requests to the adapter
+func WithMinRequestInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.client = append(o.client, client.WithMinRequestInterval(d))
+	}
+}
+
+// WithClientOptions passes options to the client of the adapter
+func WithClientOptions(opts ...client.Option) Option {
+	return func(o *options) {
+		o.client = append(o.client, opts...)
+	}
+}
+
+// WithCircuitBreaker stops queries of the adapter after consecutive failures; see
+// SetCircuitBreaker
+func WithCircuitBreaker(threshold int, initialBackoff, maxBackoff time.Duration) Option {
+	return func(o *options) {
+		o.setup = append(o.setup, func(c *GoCoaxCollector) {
+			c.SetCircuitBreaker(threshold, initialBackoff, maxBackoff)
+		})
+	}
+}
+
+// WithStepChangePercent sets the PHY rate change reported as a phy_rate_step_change
+// event, DefaultStepChangePercent by default
+func WithStepChangePercent(percent float64) Option {
+	return func(o *options) {
+		o.setup = append(o.setup, func(c *GoCoaxCollector) {
+			c.SetStepChangePercent(percent)
+		})
+	}
+}
+
+// WithCustomMetrics exports the response words of further device API calls as
+// metrics, as configured in custom_metrics. The configuration must have been
+// validated.
+func WithCustomMetrics(endpoints []config.CustomEndpoint) Option {
+	return func(o *options) {
+		o.setup = append(o.setup, func(c *GoCoaxCollector) {
+			c.custom = newCustomEndpoints(endpoints)
+		})
+	}
+}
+
+// WithEventHandler sets a function called with every event detected between
+// successive snapshots; see OnEvent
+func WithEventHandler(fn func(Event)) Option {
+	return func(o *options) {
+		o.setup = append(o.setup, func(c *GoCoaxCollector) {
+			c.OnEvent(fn)
+		})
+	}
+}
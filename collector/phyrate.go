@@ -29,6 +29,19 @@ func NewPHYRateMatrix() *PHYRateMatrix {
 	}
 }
 
+// Merge copies the rows of another matrix into this one, overwriting rows for the same nodes
+func (m *PHYRateMatrix) Merge(other *PHYRateMatrix) {
+	for node, rates := range other.NPER {
+		m.NPER[node] = rates
+	}
+	for node, rates := range other.VLPER {
+		m.VLPER[node] = rates
+	}
+	for node, rate := range other.GCD {
+		m.GCD[node] = rate
+	}
+}
+
 // FMRPayloadParser parses FMR payload data to extract PHY rate parameters
 type FMRPayloadParser struct {
 	fmrData        []uint32
@@ -225,7 +238,9 @@ func CalculatePHYRates(
 	// Determine entry node payload version
 	entryPayloadVer := min(entryMocaVer, ncMocaVer)
 
-	parser := NewFMRPayloadParser(fmrData, entryNodeID, entryPayloadVer, ncMocaVer, mocaNetVer, nodeBitMask, nodeVersions)
+	// The parser takes the entry node's own MoCA version: absent nodes are skipped
+	// using that version's entry size, even when the NC is MoCA 1.x
+	parser := NewFMRPayloadParser(fmrData, entryNodeID, entryMocaVer, ncMocaVer, mocaNetVer, nodeBitMask, nodeVersions)
 
 	// Parse FMR data for each possible destination node
 	for destNodeID := 0; destNodeID < MAX_NUM_NODES; destNodeID++ {
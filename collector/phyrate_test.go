@@ -1,6 +1,8 @@
 package collector
 
 import (
+	"encoding/binary"
+	"math/rand/v2"
 	"testing"
 )
 
@@ -207,3 +209,221 @@ func TestFMRPayloadParser(t *testing.T) {
 		t.Errorf("Expected entry node ID 0, got %d", parser.entryNodeID)
 	}
 }
+
+// fmrTestEntry holds the raw FMR fields for one entry->destination link
+type fmrTestEntry struct {
+	gapNper, gapVLper, ofdmbNper, ofdmbVLper int
+}
+
+// encodeFMR builds an FMR payload the way the device lays it out (see refreshPage in
+// examples/PHY Rates.html): entries start at word 10, 2.x entries take 6 bytes and 1.x
+// entries 2 bytes, and absent nodes occupy space sized by the entry node's version.
+func encodeFMR(entryMocaVer, ncMocaVer, nodeBitMask int, nodeVersions map[int]int, entries map[int]fmrTestEntry) []uint32 {
+	data := make([]uint32, 40)
+	readIndex := 10
+	aligned := true
+	entryPayloadVer := min(entryMocaVer, ncMocaVer)
+
+	for dest := 0; dest < MAX_NUM_NODES; dest++ {
+		fmrPayloadVer := entryMocaVer
+		if (nodeBitMask&(1<<dest)) != 0 && ncMocaVer < 0x20 {
+			fmrPayloadVer = min(entryPayloadVer, nodeVersions[dest])
+		}
+
+		if (nodeBitMask & (1 << dest)) == 0 {
+			if fmrPayloadVer >= 0x20 {
+				if aligned {
+					readIndex++
+				} else {
+					readIndex += 2
+				}
+			} else if !aligned {
+				readIndex++
+			}
+			aligned = !aligned
+			continue
+		}
+
+		e := entries[dest]
+		if fmrPayloadVer == 0x20 || fmrPayloadVer == 0x25 {
+			if aligned {
+				data[readIndex] |= uint32(e.gapNper)<<24 | uint32(e.gapVLper)<<16 | uint32(e.ofdmbNper)
+				data[readIndex+1] |= uint32(e.ofdmbVLper) << 16
+				readIndex++
+			} else {
+				data[readIndex] |= uint32(e.gapNper)<<8 | uint32(e.gapVLper)
+				data[readIndex+1] |= uint32(e.ofdmbNper)<<16 | uint32(e.ofdmbVLper)
+				readIndex += 2
+			}
+		} else {
+			if aligned {
+				data[readIndex] |= uint32(e.gapNper)<<27 | uint32(e.ofdmbNper)<<16
+			} else {
+				data[readIndex] |= uint32(e.gapNper)<<11 | uint32(e.ofdmbNper)
+				readIndex++
+			}
+		}
+		aligned = !aligned
+	}
+
+	return data
+}
+
+// TestFMRPayloadRoundTrip generates random topologies, encodes FMR words the way the
+// device does and checks that every gap/OFDMB value decodes back unchanged
+func TestFMRPayloadRoundTrip(t *testing.T) {
+	versions := []int{0x10, 0x11, 0x20, 0x25}
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	for iter := 0; iter < 2000; iter++ {
+		nodeBitMask := int(rng.Uint32N(1<<MAX_NUM_NODES-1)) + 1
+		nodeVersions := make(map[int]int)
+		var present []int
+		for node := 0; node < MAX_NUM_NODES; node++ {
+			if (nodeBitMask & (1 << node)) != 0 {
+				nodeVersions[node] = versions[rng.IntN(len(versions))]
+				present = append(present, node)
+			}
+		}
+		ncNodeID := present[rng.IntN(len(present))]
+		ncMocaVer := nodeVersions[ncNodeID]
+
+		for _, entryNodeID := range present {
+			entryMocaVer := nodeVersions[entryNodeID]
+			entryPayloadVer := min(entryMocaVer, ncMocaVer)
+
+			entries := make(map[int]fmrTestEntry)
+			for _, dest := range present {
+				fmrPayloadVer := entryMocaVer
+				if ncMocaVer < 0x20 {
+					fmrPayloadVer = min(entryPayloadVer, nodeVersions[dest])
+				}
+				if fmrPayloadVer >= 0x20 {
+					entries[dest] = fmrTestEntry{
+						gapNper:    rng.IntN(0x100),
+						gapVLper:   rng.IntN(0x100),
+						ofdmbNper:  rng.IntN(0x10000),
+						ofdmbVLper: rng.IntN(0x10000),
+					}
+				} else {
+					entries[dest] = fmrTestEntry{
+						gapNper:   rng.IntN(0x20),
+						ofdmbNper: rng.IntN(0x800),
+					}
+				}
+			}
+
+			fmrData := encodeFMR(entryMocaVer, ncMocaVer, nodeBitMask, nodeVersions, entries)
+			parser := NewFMRPayloadParser(fmrData, entryNodeID, entryMocaVer, ncMocaVer, 0x25, nodeBitMask, nodeVersions)
+
+			for dest := 0; dest < MAX_NUM_NODES; dest++ {
+				gapNper, gapVLper, ofdmbNper, ofdmbVLper, err := parser.parseFMREntry(dest)
+				if err != nil {
+					t.Fatalf("mask=%#x versions=%v nc=%d entry=%d dest=%d: %v",
+						nodeBitMask, nodeVersions, ncNodeID, entryNodeID, dest, err)
+				}
+				want, ok := entries[dest]
+				if !ok {
+					continue
+				}
+				got := fmrTestEntry{gapNper, gapVLper, ofdmbNper, ofdmbVLper}
+				if got != want {
+					t.Fatalf("mask=%#x versions=%v nc=%d entry=%d dest=%d: got %+v, want %+v",
+						nodeBitMask, nodeVersions, ncNodeID, entryNodeID, dest, got, want)
+				}
+			}
+		}
+	}
+}
+
+// TestCalculatePHYRatesMixedNetworkSkip covers a 2.x entry node behind a 1.x NC, where
+// absent nodes must be skipped using the entry node's own (2.x) entry size
+func TestCalculatePHYRatesMixedNetworkSkip(t *testing.T) {
+	nodeVersions := map[int]int{0: 0x11, 2: 0x25}
+	nodeBitMask := 0x05 // nodes 0 and 2, node 1 absent
+	entries := map[int]fmrTestEntry{
+		0: {gapNper: 12, ofdmbNper: 1500},
+		2: {gapNper: 9, ofdmbNper: 1400},
+	}
+	fmrData := encodeFMR(0x25, 0x11, nodeBitMask, nodeVersions, entries)
+
+	matrix, err := CalculatePHYRates(2, fmrData, 0x25, 0x11, 0x11, nodeBitMask, nodeVersions)
+	if err != nil {
+		t.Fatalf("CalculatePHYRates failed: %v", err)
+	}
+
+	want := CalculateNPERRate(9, 1400, 0x11, 0)
+	if got := matrix.NPER[2][2]; got != want {
+		t.Errorf("Expected NPER 2->2 of %d, got %d", want, got)
+	}
+}
+
+// FuzzCalculatePHYRates feeds arbitrary device output to the FMR parser and checks that
+// it never panics, never reads past the payload and only reports present nodes
+func FuzzCalculatePHYRates(f *testing.F) {
+	seed := encodeFMR(0x25, 0x25, 0x03, map[int]int{0: 0x25, 1: 0x25}, map[int]fmrTestEntry{
+		0: {gapNper: 20, gapVLper: 15, ofdmbNper: 2000, ofdmbVLper: 3000},
+		1: {gapNper: 18, gapVLper: 14, ofdmbNper: 2200, ofdmbVLper: 2800},
+	})
+	f.Add(wordsToBytes(seed), uint8(0), []byte{0x25, 0x25}, uint8(0x25), uint8(0x25), uint16(0x03))
+	f.Add([]byte{}, uint8(1), []byte{0x11, 0x20, 0x25}, uint8(0x11), uint8(0x11), uint16(0x07))
+	f.Add(make([]byte, 44), uint8(15), []byte{0x20}, uint8(0x20), uint8(0x10), uint16(0xFFFF))
+
+	f.Fuzz(func(t *testing.T, raw []byte, entry uint8, versions []byte, ncVer, netVer uint8, mask uint16) {
+		fmrData := bytesToWords(raw)
+		entryNodeID := int(entry) % MAX_NUM_NODES
+		nodeBitMask := int(mask)
+
+		nodeVersions := make(map[int]int)
+		for node := 0; node < MAX_NUM_NODES && len(versions) > 0; node++ {
+			nodeVersions[node] = int(versions[node%len(versions)])
+		}
+		entryMocaVer := nodeVersions[entryNodeID]
+
+		parser := NewFMRPayloadParser(fmrData, entryNodeID, entryMocaVer, int(ncVer), int(netVer), nodeBitMask, nodeVersions)
+		for dest := 0; dest < MAX_NUM_NODES; dest++ {
+			if _, _, _, _, err := parser.parseFMREntry(dest); err != nil {
+				break
+			}
+			if (nodeBitMask&(1<<dest)) != 0 && parser.readIndex > len(fmrData) {
+				t.Fatalf("read index %d past payload of %d words", parser.readIndex, len(fmrData))
+			}
+		}
+
+		matrix, err := CalculatePHYRates(entryNodeID, fmrData, entryMocaVer, int(ncVer), int(netVer), nodeBitMask, nodeVersions)
+		if err != nil {
+			return
+		}
+		for dest, rate := range matrix.NPER[entryNodeID] {
+			if (nodeBitMask & (1 << dest)) == 0 {
+				t.Errorf("NPER reported for absent node %d", dest)
+			}
+			if rate < 0 {
+				t.Errorf("negative NPER rate %d for node %d", rate, dest)
+			}
+		}
+		for dest, rate := range matrix.VLPER[entryNodeID] {
+			if rate < 0 {
+				t.Errorf("negative VLPER rate %d for node %d", rate, dest)
+			}
+		}
+	})
+}
+
+// wordsToBytes flattens FMR words into big-endian bytes for the fuzz corpus
+func wordsToBytes(words []uint32) []byte {
+	raw := make([]byte, 0, len(words)*4)
+	for _, w := range words {
+		raw = binary.BigEndian.AppendUint32(raw, w)
+	}
+	return raw
+}
+
+// bytesToWords packs fuzz bytes into big-endian FMR words, dropping any trailing partial word
+func bytesToWords(raw []byte) []uint32 {
+	words := make([]uint32, len(raw)/4)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint32(raw[i*4:])
+	}
+	return words
+}
@@ -1,60 +1,237 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/louispool/gocoax-exporter/client"
 	"github.com/louispool/gocoax-exporter/config"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 // MultiDeviceRegistry manages collectors for multiple goCoax devices
 type MultiDeviceRegistry struct {
+	mu         sync.RWMutex
 	collectors []*GoCoaxCollector
+
+	discovery  *config.DiscoveryConfig // credentials for discovered devices
+	timeout    time.Duration
+	configured map[string]bool              // addresses of configured devices
+	discovered map[string]*discoveredDevice // [address] = discovered device
+	labels     map[string]map[string]string // [device name] = target labels
+
+	stepPercent float64                      // PHY rate step change reported as an event
+	minInterval time.Duration                // minimum time between requests to a device
+	breaker     *config.CircuitBreakerConfig // nil without circuit breakers
+	custom      []config.CustomEndpoint      // further device API calls exported as metrics
+	onEvent     func(Event)                  // applied to discovered devices as well
+	onGather    func(string, error)          // applied to discovered devices as well
+}
+
+// DeviceTarget describes a scraped device for service discovery
+type DeviceTarget struct {
+	Name    string
+	Address string
+	Labels  map[string]string
 }
 
-// NewMultiDeviceRegistry creates a registry with collectors for all configured devices
+// NewMultiDeviceRegistry creates a registry with collectors for all configured devices.
+// With discovery configured the registry may start empty.
 func NewMultiDeviceRegistry(cfg *config.Config) (*MultiDeviceRegistry, error) {
-	if len(cfg.Devices) == 0 {
+	if len(cfg.Devices) == 0 && cfg.Discovery == nil {
 		return nil, fmt.Errorf("no devices configured")
 	}
 
+	timeout := cfg.GetTimeout()
+
 	registry := &MultiDeviceRegistry{
 		collectors: make([]*GoCoaxCollector, 0, len(cfg.Devices)),
-	}
+		discovery:  cfg.Discovery,
+		timeout:    timeout,
+		configured: make(map[string]bool, len(cfg.Devices)),
+		discovered: make(map[string]*discoveredDevice),
+		labels:     make(map[string]map[string]string),
 
-	timeout := cfg.GetTimeout()
+		stepPercent: DefaultStepChangePercent,
+		minInterval: cfg.GetMinRequestInterval(),
+		breaker:     cfg.CircuitBreaker,
+		custom:      cfg.CustomMetrics,
+	}
+	if cfg.Events != nil {
+		registry.stepPercent = cfg.Events.StepChangePercent
+	}
 
 	// Create a collector for each configured device
 	for i, device := range cfg.Devices {
-		collector, err := NewGoCoaxCollector(
-			device.Name,
-			device.Address,
-			device.Username,
-			device.Password,
-			timeout,
-		)
+		registry.configured[device.Address] = true
+
+		opts, err := registry.deviceOptions(device, cfg.GetProfile(device.Profile))
+		if err != nil {
+			log.Printf("Warning: failed to create collector for device %s: %v", device.Name, err)
+			continue
+		}
+		collector, err := New(context.Background(), device.Name, device.Address, opts...)
 		if err != nil {
 			log.Printf("Warning: failed to create collector for device %s: %v", device.Name, err)
 			continue
 		}
 
 		registry.collectors = append(registry.collectors, collector)
+		registry.labels[device.Name] = device.Labels
 		log.Printf("Created collector %d/%d for device: %s (%s)", i+1, len(cfg.Devices), device.Name, device.Address)
 	}
 
-	if len(registry.collectors) == 0 {
+	if len(registry.collectors) == 0 && cfg.Discovery == nil {
 		return nil, fmt.Errorf("no collectors were successfully created")
 	}
 
 	return registry, nil
 }
 
+// options returns the options of a new collector: its credentials and the settings
+// shared by all devices
+func (r *MultiDeviceRegistry) options(username, password string) []Option {
+	opts := []Option{
+		WithCredentials(username, password),
+		WithTimeout(r.timeout),
+		WithStepChangePercent(r.stepPercent),
+		WithMinRequestInterval(r.minInterval),
+	}
+	if r.breaker != nil {
+		opts = append(opts, WithCircuitBreaker(r.breaker.FailureThreshold, r.breaker.GetInitialBackoff(), r.breaker.GetMaxBackoff()))
+	}
+	if len(r.custom) > 0 {
+		opts = append(opts, WithCustomMetrics(r.custom))
+	}
+	return opts
+}
+
+// deviceOptions returns the options of a configured device's collector
+func (r *MultiDeviceRegistry) deviceOptions(device config.Device, profileCfg *config.ProfileConfig) ([]Option, error) {
+	profile, err := ProfileFromConfig(profileCfg)
+	if err != nil {
+		return nil, err
+	}
+	if device.ReadStatus && profile.Status.Endpoint == "" {
+		profile.Status = client.DefaultStatusLayout
+	}
+
+	opts := append(r.options(device.Username, device.Password), WithProfile(profile))
+	if device.Auth != nil {
+		opts = append(opts, WithAuthenticator(AuthenticatorFromConfig(device.Auth)))
+	}
+	if profileCfg != nil && profileCfg.FMRBatch {
+		opts = append(opts, WithFMRBatch())
+	}
+	return opts, nil
+}
+
+// ProfileFromConfig returns the client profile of a configured profile:
+// client.GoCoaxProfile with the settings of cfg applied, or client.GoCoaxProfile
+// itself if cfg is nil. Unknown endpoint and offset keys are an error.
+func ProfileFromConfig(cfg *config.ProfileConfig) (client.Profile, error) {
+	profile := client.GoCoaxProfile
+	if cfg == nil {
+		return profile, nil
+	}
+
+	profile.Name = cfg.Name
+	if cfg.SessionPath != "" {
+		profile.SessionPath = cfg.SessionPath
+	}
+	if len(cfg.CSRFCookies) > 0 {
+		profile.CSRFCookies = cfg.CSRFCookies
+	}
+	if cfg.Auth != nil {
+		profile.Auth = AuthenticatorFromConfig(cfg.Auth)
+	}
+
+	// The status and counters are read only by profiles that set their endpoints
+	if _, ok := cfg.Endpoints["status"]; ok {
+		profile.Status = client.DefaultStatusLayout
+	}
+	if _, ok := cfg.Endpoints["stats"]; ok {
+		profile.Stats = client.DefaultStatsLayout
+	}
+	endpoints := map[string]*string{
+		"local_info": &profile.LocalInfo.Endpoint,
+		"node_info":  &profile.NodeInfo.Endpoint,
+		"fmr":        &profile.FMREndpoint,
+		"status":     &profile.Status.Endpoint,
+		"stats":      &profile.Stats.Endpoint,
+		"reboot":     &profile.RebootEndpoint,
+	}
+	for key, endpoint := range cfg.Endpoints {
+		field, ok := endpoints[key]
+		if !ok {
+			return client.Profile{}, fmt.Errorf("profile %s: unknown endpoint %q", cfg.Name, key)
+		}
+		*field = endpoint
+	}
+
+	for _, section := range []struct {
+		name    string
+		values  map[string]int
+		offsets map[string]*int
+	}{
+		{"local_info", cfg.LocalInfo, map[string]*int{
+			"my_node_id":       &profile.LocalInfo.MyNodeID,
+			"nc_node_id":       &profile.LocalInfo.NCNodeID,
+			"moca_net_version": &profile.LocalInfo.MocaNetVersion,
+			"node_bitmask":     &profile.LocalInfo.NodeBitMask,
+		}},
+		{"node_info", cfg.NodeInfo, map[string]*int{
+			"mac_high":     &profile.NodeInfo.MACHigh,
+			"mac_low":      &profile.NodeInfo.MACLow,
+			"moca_version": &profile.NodeInfo.MocaVersion,
+		}},
+	} {
+		for key, value := range section.values {
+			field, ok := section.offsets[key]
+			if !ok {
+				return client.Profile{}, fmt.Errorf("profile %s: unknown %s offset %q", cfg.Name, section.name, key)
+			}
+			*field = value
+		}
+	}
+	return profile, nil
+}
+
+// AuthenticatorFromConfig returns the client authenticator of a device's auth
+// section, client.BasicAuth if it is nil
+func AuthenticatorFromConfig(cfg *config.AuthConfig) client.Authenticator {
+	if cfg == nil {
+		return client.BasicAuth{}
+	}
+
+	switch cfg.Method {
+	case config.AuthForm:
+		return client.FormAuth{Path: cfg.LoginPath, UsernameField: cfg.UsernameField, PasswordField: cfg.PasswordField}
+	case config.AuthChallenge:
+		return client.ChallengeAuth{
+			ChallengePath: cfg.ChallengePath,
+			Path:          cfg.LoginPath,
+			UsernameField: cfg.UsernameField,
+			PasswordField: cfg.PasswordField,
+		}
+	case config.AuthAuto:
+		return client.AutoAuth{}
+	default:
+		return client.BasicAuth{}
+	}
+}
+
 // Describe implements prometheus.Collector interface
 // This allows MultiDeviceRegistry itself to be registered as a single collector
 func (r *MultiDeviceRegistry) Describe(ch chan<- *prometheus.Desc) {
 	// Delegate to all sub-collectors
-	for _, collector := range r.collectors {
+	for _, collector := range r.Collectors() {
 		collector.Describe(ch)
 	}
 }
@@ -63,11 +240,19 @@ func (r *MultiDeviceRegistry) Describe(ch chan<- *prometheus.Desc) {
 // This collects metrics from all devices
 func (r *MultiDeviceRegistry) Collect(ch chan<- prometheus.Metric) {
 	// Delegate to all sub-collectors
-	for _, collector := range r.collectors {
+	for _, collector := range r.Collectors() {
 		collector.Collect(ch)
 	}
 }
 
+// CollectWithContext collects metrics from all devices for a scrape with its own
+// context, stopping when ctx is cancelled or its deadline passes
+func (r *MultiDeviceRegistry) CollectWithContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	for _, collector := range r.Collectors() {
+		collector.CollectWithContext(ctx, ch)
+	}
+}
+
 // Register registers the multi-device collector with the Prometheus registry
 func (r *MultiDeviceRegistry) Register(registry *prometheus.Registry) error {
 	// Register the multi-device collector itself (not individual collectors)
@@ -75,7 +260,7 @@ func (r *MultiDeviceRegistry) Register(registry *prometheus.Registry) error {
 		return fmt.Errorf("failed to register multi-device collector: %w", err)
 	}
 
-	log.Printf("Successfully registered multi-device collector with %d device(s)", len(r.collectors))
+	log.Printf("Successfully registered multi-device collector with %d device(s)", r.GetCollectorCount())
 	return nil
 }
 
@@ -83,7 +268,7 @@ func (r *MultiDeviceRegistry) Register(registry *prometheus.Registry) error {
 func (r *MultiDeviceRegistry) Close() error {
 	var lastErr error
 
-	for _, collector := range r.collectors {
+	for _, collector := range r.Collectors() {
 		if err := collector.Close(); err != nil {
 			lastErr = err
 			log.Printf("Error closing collector: %v", err)
@@ -93,7 +278,247 @@ func (r *MultiDeviceRegistry) Close() error {
 	return lastErr
 }
 
+// discoveredDevice is a device added by discovery
+type discoveredDevice struct {
+	collector *GoCoaxCollector
+	missed    int // consecutive scans the device did not answer
+}
+
+// KnownAddresses returns the addresses of the configured and discovered devices.
+// Configured host names are resolved, so that an adapter configured by name is not
+// discovered again at its IP address.
+func (r *MultiDeviceRegistry) KnownAddresses(ctx context.Context) map[string]bool {
+	r.mu.RLock()
+	known := make(map[string]bool, len(r.configured)+len(r.discovered))
+	for address := range r.discovered {
+		known[address] = true
+	}
+	r.mu.RUnlock()
+
+	// configured does not change after NewMultiDeviceRegistry
+	for address := range r.configured {
+		known[address] = true
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			continue
+		}
+		ips, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			log.Printf("Warning: failed to resolve configured device address %s: %v", address, err)
+			continue
+		}
+		for _, ip := range ips {
+			known[net.JoinHostPort(ip, port)] = true
+		}
+	}
+	return known
+}
+
+// RegisterDiscovered adds a collector for a device found by discovery, keyed by its
+// address and named after it; see DiscoveredDeviceName. Known addresses are skipped.
+//
+// The MAC address a device reports is not used to identify it, since where node info
+// holds it has not been confirmed on a real adapter. A device that moves to a new
+// address is added again under a new name, and the old one is removed by
+// RefreshDiscovered once it has missed enough scans.
+func (r *MultiDeviceRegistry) RegisterDiscovered(ctx context.Context, address string) error {
+	if r.KnownAddresses(ctx)[address] {
+		return nil
+	}
+	return r.register(address)
+}
+
+// register adds a collector for a discovered device
+func (r *MultiDeviceRegistry) register(address string) error {
+	if r.discovery == nil {
+		return fmt.Errorf("discovery is not configured")
+	}
+
+	name := DiscoveredDeviceName(address)
+	collector, err := New(context.Background(), name, address, r.options(r.discovery.Username, r.discovery.Password)...)
+	if err != nil {
+		return fmt.Errorf("failed to create collector for discovered device %s: %w", name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Another scan may have added it meanwhile
+	if _, ok := r.discovered[address]; ok {
+		collector.Close()
+		return nil
+	}
+
+	collector.OnEvent(r.onEvent)
+	if r.onGather != nil {
+		collector.OnGather(func(err error) { r.onGather(name, err) })
+	}
+	r.collectors = append(r.collectors, collector)
+	r.discovered[address] = &discoveredDevice{collector: collector}
+	log.Printf("Discovered device %s at %s", name, address)
+
+	return nil
+}
+
+// RefreshDiscovered updates the discovered devices with the addresses of the adapters
+// a scan found. New addresses are added. Discovered devices the scan did not find,
+// including ones it skipped as known, are checked through their own collectors, which
+// wait their turn behind other queries of the device and use its open session; a
+// device that fails the check in discovery.max_missed_scans scans in a row is removed.
+func (r *MultiDeviceRegistry) RefreshDiscovered(ctx context.Context, found []string) {
+	if r.discovery == nil {
+		return
+	}
+
+	known := r.KnownAddresses(ctx)
+	seen := make(map[string]bool, len(found))
+	for _, address := range found {
+		seen[address] = true
+		if known[address] {
+			continue
+		}
+		if err := r.register(address); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	r.mu.RLock()
+	unseen := make(map[string]*GoCoaxCollector)
+	for address, d := range r.discovered {
+		if !seen[address] {
+			unseen[address] = d.collector
+		}
+	}
+	r.mu.RUnlock()
+
+	answered := make(map[string]bool, len(unseen))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for address, c := range unseen {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := c.Ping(ctx)
+			mu.Lock()
+			answered[address] = err == nil
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for address, d := range r.discovered {
+		if seen[address] || answered[address] {
+			d.missed = 0
+			continue
+		}
+		if _, checked := unseen[address]; !checked {
+			continue // added meanwhile
+		}
+		d.missed++
+		if d.missed < r.discovery.MaxMissedScans {
+			continue
+		}
+
+		delete(r.discovered, address)
+		r.collectors = slices.DeleteFunc(r.collectors, func(c *GoCoaxCollector) bool { return c == d.collector })
+		d.collector.Close()
+		log.Printf("Removed discovered device %s at %s after %d missed scans", d.collector.DeviceName(), address, d.missed)
+	}
+}
+
+// OnEvent registers a function called with the events of every device, including
+// devices discovered later. It must be set before the registry is registered.
+func (r *MultiDeviceRegistry) OnEvent(fn func(Event)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onEvent = fn
+	for _, c := range r.collectors {
+		c.OnEvent(fn)
+	}
+}
+
+// OnGather registers a function called with the device name and result of every query
+// of a device, including devices discovered later; see GoCoaxCollector.OnGather. It
+// must be set before the registry is registered.
+func (r *MultiDeviceRegistry) OnGather(fn func(device string, err error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onGather = fn
+	for _, c := range r.collectors {
+		name := c.DeviceName()
+		c.OnGather(func(err error) { fn(name, err) })
+	}
+}
+
+// DiscoveredDeviceName returns the device name used for a discovered device, derived
+// from its host:port address, e.g. gocoax-192-168-98-50; the port is left out when it
+// is 80
+func DiscoveredDeviceName(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = address, "80"
+	}
+	name := "gocoax-" + strings.NewReplacer(".", "-", ":", "-").Replace(strings.ToLower(host))
+	if port != "80" {
+		name += "-" + port
+	}
+	return name
+}
+
+// Collectors returns the per-device collectors
+func (r *MultiDeviceRegistry) Collectors() []*GoCoaxCollector {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*GoCoaxCollector(nil), r.collectors...)
+}
+
+// Collector returns the collector of the named device
+func (r *MultiDeviceRegistry) Collector(name string) (*GoCoaxCollector, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, c := range r.collectors {
+		if c.DeviceName() == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// Targets returns the devices with their target labels, in registration order
+func (r *MultiDeviceRegistry) Targets() []DeviceTarget {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	targets := make([]DeviceTarget, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		targets = append(targets, DeviceTarget{
+			Name:    c.DeviceName(),
+			Address: c.Address(),
+			Labels:  r.labels[c.DeviceName()],
+		})
+	}
+	return targets
+}
+
+// Gatherers returns the per-device collectors as snapshot sources
+func (r *MultiDeviceRegistry) Gatherers() []SnapshotGatherer {
+	collectors := r.Collectors()
+	gatherers := make([]SnapshotGatherer, 0, len(collectors))
+	for _, c := range collectors {
+		gatherers = append(gatherers, c)
+	}
+	return gatherers
+}
+
 // GetCollectorCount returns the number of active collectors
 func (r *MultiDeviceRegistry) GetCollectorCount() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return len(r.collectors)
 }
@@ -0,0 +1,240 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+func TestRegisterDiscovered(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("testdata", "fixtures", "single-node", "fixture.json"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	var c fixture
+	if err := json.Unmarshal(raw, &c); err != nil {
+		t.Fatalf("Failed to parse fixture: %v", err)
+	}
+
+	configured := strings.TrimPrefix(newFixtureDevice(t, &c).URL, "http://")
+	first := strings.TrimPrefix(newFixtureDevice(t, &c).URL, "http://")
+	second := strings.TrimPrefix(newFixtureDevice(t, &c).URL, "http://")
+
+	registry, err := NewMultiDeviceRegistry(&config.Config{
+		ScrapeTimeout: 5,
+		Devices:       []config.Device{{Name: "bridge-50", Address: configured, Username: "admin", Password: "secret", Labels: map[string]string{"room": "office"}}},
+		Discovery:     &config.DiscoveryConfig{Username: "admin", Password: "gocoax"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+
+	// A configured device found again by discovery is not added twice
+	if err := registry.RegisterDiscovered(context.Background(), configured); err != nil {
+		t.Fatalf("RegisterDiscovered failed: %v", err)
+	}
+	if got := registry.GetCollectorCount(); got != 1 {
+		t.Fatalf("Expected configured device to be skipped, got %d collectors", got)
+	}
+
+	// The same adapters answer every scan; each address is added once
+	for _, address := range []string{first, first, second} {
+		if err := registry.RegisterDiscovered(context.Background(), address); err != nil {
+			t.Fatalf("RegisterDiscovered(%s) failed: %v", address, err)
+		}
+	}
+
+	collectors := registry.Collectors()
+	if len(collectors) != 3 {
+		t.Fatalf("Expected 3 collectors, got %d", len(collectors))
+	}
+	discovered := collectors[1]
+	if discovered.DeviceName() != DiscoveredDeviceName(first) || discovered.Address() != first {
+		t.Errorf("Unexpected discovered device: %s at %s", discovered.DeviceName(), discovered.Address())
+	}
+	if collectors[2].Address() != second {
+		t.Errorf("Expected second discovered device at %s, got %s", second, collectors[2].Address())
+	}
+
+	targets := registry.Targets()
+	if targets[0].Name != "bridge-50" || targets[0].Labels["room"] != "office" {
+		t.Errorf("Expected configured labels on bridge-50, got %+v", targets[0])
+	}
+	if targets[1].Address != first || len(targets[1].Labels) != 0 {
+		t.Errorf("Expected discovered device without labels, got %+v", targets[1])
+	}
+
+	if c, ok := registry.Collector(DiscoveredDeviceName(first)); !ok || c != discovered {
+		t.Error("Expected to find the discovered device by name")
+	}
+	if _, ok := registry.Collector("nope"); ok {
+		t.Error("Expected unknown device not to be found")
+	}
+}
+
+func TestRegisterDiscoveredSkipsConfiguredHostName(t *testing.T) {
+	server := newFixtureDevice(t, loadFixture(t, "single-node"))
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+
+	registry, err := NewMultiDeviceRegistry(&config.Config{
+		ScrapeTimeout: 5,
+		Devices:       []config.Device{{Name: "bridge-50", Address: net.JoinHostPort("localhost", port), Username: "admin", Password: "secret"}},
+		Discovery:     &config.DiscoveryConfig{Username: "admin", Password: "gocoax", MaxMissedScans: 2},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+
+	// The adapter configured by name is found again by its IP address
+	registry.RefreshDiscovered(context.Background(), []string{net.JoinHostPort("127.0.0.1", port)})
+	if got := registry.GetCollectorCount(); got != 1 {
+		t.Errorf("Expected the configured device only, got %d collectors", got)
+	}
+}
+
+func TestRefreshDiscoveredRemovesMissingDevices(t *testing.T) {
+	c := loadFixture(t, "single-node")
+	gone := newFixtureDevice(t, c)
+	stays := strings.TrimPrefix(newFixtureDevice(t, c).URL, "http://")
+
+	registry, err := NewMultiDeviceRegistry(&config.Config{
+		ScrapeTimeout: 2,
+		Discovery:     &config.DiscoveryConfig{Username: "admin", Password: "gocoax", MaxMissedScans: 2},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+
+	goneAddress := strings.TrimPrefix(gone.URL, "http://")
+	registry.RefreshDiscovered(context.Background(), []string{goneAddress, stays})
+	if got := registry.GetCollectorCount(); got != 2 {
+		t.Fatalf("Expected 2 discovered devices, got %d", got)
+	}
+
+	// One adapter goes away; the other is not found by the scans but still answers
+	gone.Close()
+	for scan := 1; scan <= 2; scan++ {
+		registry.RefreshDiscovered(context.Background(), nil)
+		want := 2
+		if scan == 2 {
+			want = 1
+		}
+		if got := registry.GetCollectorCount(); got != want {
+			t.Fatalf("Scan %d: expected %d devices, got %d", scan, want, got)
+		}
+	}
+	if _, ok := registry.Collector(DiscoveredDeviceName(stays)); !ok {
+		t.Error("Expected the device that still answers to be kept")
+	}
+	if registry.KnownAddresses(context.Background())[goneAddress] {
+		t.Error("Expected the removed device's address to be forgotten")
+	}
+}
+
+func TestRegistryReadStatus(t *testing.T) {
+	c := loadFixture(t, "moca25-only")
+	plain := strings.TrimPrefix(newFixtureDevice(t, c).URL, "http://")
+	status := strings.TrimPrefix(newFixtureDevice(t, c).URL, "http://")
+
+	registry, err := NewMultiDeviceRegistry(&config.Config{
+		ScrapeTimeout: 5,
+		Devices: []config.Device{
+			{Name: "plain", Address: plain, Username: "admin", Password: "secret"},
+			{Name: "status", Address: status, Username: "admin", Password: "secret", ReadStatus: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+
+	// Only the device configured with read_status exports the status metrics
+	for _, c := range registry.Collectors() {
+		snapshot, err := c.Gather(context.Background())
+		if err != nil {
+			t.Fatalf("Gather of %s failed: %v", c.DeviceName(), err)
+		}
+		if read := snapshot.Status != nil; read != (c.DeviceName() == "status") {
+			t.Errorf("Device %s: expected the status to be read only with read_status, got %+v", c.DeviceName(), snapshot.Status)
+		}
+	}
+}
+
+func TestDiscoveredDeviceName(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"192.168.98.50:80", "gocoax-192-168-98-50"},
+		{"192.168.98.50:8080", "gocoax-192-168-98-50-8080"},
+		{"192.168.98.50", "gocoax-192-168-98-50"},
+		{"[fd00::50]:80", "gocoax-fd00--50"},
+	}
+	for _, tt := range tests {
+		if got := DiscoveredDeviceName(tt.address); got != tt.want {
+			t.Errorf("DiscoveredDeviceName(%q) = %q, want %q", tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestNewMultiDeviceRegistryDiscoveryOnly(t *testing.T) {
+	registry, err := NewMultiDeviceRegistry(&config.Config{
+		ScrapeTimeout: 5,
+		Discovery:     &config.DiscoveryConfig{CIDRs: []string{"192.168.98.0/24"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected an empty registry with discovery configured, got %v", err)
+	}
+	if got := registry.GetCollectorCount(); got != 0 {
+		t.Errorf("Expected no collectors, got %d", got)
+	}
+
+	if _, err := NewMultiDeviceRegistry(&config.Config{ScrapeTimeout: 5}); err == nil {
+		t.Error("Expected error without devices or discovery")
+	}
+}
+
+func TestRegistryHooksReachDiscoveredDevices(t *testing.T) {
+	address := strings.TrimPrefix(newFixtureDevice(t, loadFixture(t, "single-node")).URL, "http://")
+
+	registry, err := NewMultiDeviceRegistry(&config.Config{
+		ScrapeTimeout: 5,
+		Discovery:     &config.DiscoveryConfig{Username: "admin", Password: "gocoax"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+
+	// Outputs started before discovery hold the method, not its result
+	gatherers := registry.Gatherers
+	var gathered []string
+	registry.OnGather(func(device string, err error) {
+		if err == nil {
+			gathered = append(gathered, device)
+		}
+	})
+
+	if err := registry.RegisterDiscovered(context.Background(), address); err != nil {
+		t.Fatalf("RegisterDiscovered failed: %v", err)
+	}
+	current := gatherers()
+	if len(current) != 1 {
+		t.Fatalf("Expected the discovered device, got %d gatherers", len(current))
+	}
+	if _, err := current[0].Gather(context.Background()); err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	if len(gathered) != 1 || gathered[0] != current[0].DeviceName() {
+		t.Errorf("Expected OnGather to report %s, got %v", current[0].DeviceName(), gathered)
+	}
+}
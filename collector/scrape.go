@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ScrapeTimeoutHeader is the header in which Prometheus sends its scrape timeout
+const ScrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+
+// ContextCollector is a collector that can collect for a scrape with its own context;
+// GoCoaxCollector and MultiDeviceRegistry implement it
+type ContextCollector interface {
+	prometheus.Collector
+	CollectWithContext(ctx context.Context, ch chan<- prometheus.Metric)
+}
+
+// contextCollector collects a ContextCollector with a fixed context
+type contextCollector struct {
+	ctx       context.Context
+	collector ContextCollector
+}
+
+// WithContext returns a collector that collects c with ctx, to be registered with a
+// registry created for one scrape
+func WithContext(ctx context.Context, c ContextCollector) prometheus.Collector {
+	return &contextCollector{ctx: ctx, collector: c}
+}
+
+// Describe implements prometheus.Collector
+func (c *contextCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.collector.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *contextCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collector.CollectWithContext(c.ctx, ch)
+}
+
+// ScrapeContext returns the context for a scrape request. It is cancelled when the
+// client goes away and, when Prometheus sends its scrape timeout, ends offset before
+// that timeout so the response can still be written. Offsets that would leave no time
+// are ignored.
+func ScrapeContext(r *http.Request, offset time.Duration) (context.Context, context.CancelFunc) {
+	seconds, err := strconv.ParseFloat(r.Header.Get(ScrapeTimeoutHeader), 64)
+	if err != nil || seconds <= 0 {
+		return context.WithCancel(r.Context())
+	}
+
+	timeout := time.Duration(seconds * float64(time.Second))
+	if offset < timeout {
+		timeout -= offset
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
@@ -0,0 +1,163 @@
+package collector
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestScrapeContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		offset   time.Duration
+		deadline time.Duration // 0 for none
+	}{
+		{name: "no header", offset: 500 * time.Millisecond},
+		{name: "invalid header", header: "soon", offset: 500 * time.Millisecond},
+		{name: "timeout less offset", header: "10", offset: 500 * time.Millisecond, deadline: 9500 * time.Millisecond},
+		{name: "fractional timeout", header: "2.5", offset: time.Second, deadline: 1500 * time.Millisecond},
+		{name: "offset longer than timeout", header: "0.2", offset: 500 * time.Millisecond, deadline: 200 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.header != "" {
+				r.Header.Set(ScrapeTimeoutHeader, tt.header)
+			}
+
+			start := time.Now()
+			ctx, cancel := ScrapeContext(r, tt.offset)
+			defer cancel()
+
+			deadline, ok := ctx.Deadline()
+			if tt.deadline == 0 {
+				if ok {
+					t.Errorf("Expected no deadline, got one in %s", deadline.Sub(start))
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("Expected a deadline")
+			}
+			if got := deadline.Sub(start); got < tt.deadline || got > tt.deadline+100*time.Millisecond {
+				t.Errorf("Expected deadline in %s, got %s", tt.deadline, got)
+			}
+		})
+	}
+
+	// The scrape ends with the request
+	reqCtx, cancelReq := context.WithCancel(context.Background())
+	ctx, cancel := ScrapeContext(httptest.NewRequest(http.MethodGet, "/metrics", nil).WithContext(reqCtx), 0)
+	defer cancel()
+	cancelReq()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Error("Scrape context was not cancelled with the request")
+	}
+}
+
+func TestGatherSkipsFMRNearDeadline(t *testing.T) {
+	c := loadFixture(t, "single-node")
+	device := &countRequests{handler: newFixtureHandler(c)}
+	server := httptest.NewServer(device)
+	defer server.Close()
+
+	collector, err := NewGoCoaxCollector("single-node", strings.TrimPrefix(server.URL, "http://"), "admin", "secret", 5*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	defer collector.Close()
+
+	snapshot, err := collector.Gather(context.Background())
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	if snapshot.Partial || len(snapshot.PHYRates.NPER) == 0 {
+		t.Fatalf("Expected PHY rates from the first gather")
+	}
+	device.reset()
+
+	// Pretend reading the PHY rates takes longer than the scrape has left
+	collector.fmrDuration.Store(int64(time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	snapshot, err = collector.Gather(ctx)
+	if err != nil {
+		t.Fatalf("Gather near deadline: %v", err)
+	}
+	if !snapshot.Partial || len(snapshot.PHYRates.NPER) != 0 {
+		t.Errorf("Expected a partial snapshot without PHY rates, got partial=%v with %d rates", snapshot.Partial, len(snapshot.PHYRates.NPER))
+	}
+	if len(snapshot.ActiveNodes) == 0 {
+		t.Error("Expected the active nodes in the partial snapshot")
+	}
+	if n := device.reset()["/ms/0/0x1D"]; n != 0 {
+		t.Errorf("Expected no FMR requests, got %d", n)
+	}
+
+	// The device is still reported up, without PHY rate metrics
+	metrics := `
+# HELP gocoax_up Device is reachable and responding (1=up, 0=down)
+# TYPE gocoax_up gauge
+gocoax_up{device="single-node"} 1
+`
+	var scrapeErr error
+	collector.OnScrape(func(err error) { scrapeErr = err })
+	collect := WithContext(ctx, collector)
+	if err := testutil.CollectAndCompare(collect, strings.NewReader(metrics), "gocoax_up", "gocoax_phy_rate_nper_mbps"); err != nil {
+		t.Error(err)
+	}
+	if scrapeErr != ErrPartialSnapshot {
+		t.Errorf("Expected the scrape to be reported partial, got %v", scrapeErr)
+	}
+}
+
+func TestCloseCancelsGather(t *testing.T) {
+	c := loadFixture(t, "single-node")
+	blocked := make(chan struct{})
+	var handler http.Handler = newFixtureHandler(c)
+	gathering := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hang on the first query of the gather until the client goes away
+		if gathering && r.URL.Path == "/ms/0/0x15" {
+			io.Copy(io.Discard, r.Body)
+			close(blocked)
+			<-r.Context().Done()
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	collector, err := NewGoCoaxCollector("single-node", strings.TrimPrefix(server.URL, "http://"), "admin", "secret", 5*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	gathering = true
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := collector.Gather(context.Background())
+		done <- err
+	}()
+	<-blocked
+	collector.Close()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected the gather to fail")
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Gather was not cancelled by Close")
+	}
+}
@@ -0,0 +1,98 @@
+// Runs the PHY rate script from the adapter's own phyRates.html (examples/PHY Rates.html)
+// against a fixture and writes the table it would display to phyrates_html.json next to
+// the fixture. The Go golden tests compare CalculatePHYRates against this output.
+//
+// Usage: node phyrates_html.js fixtures/<name> [fixtures/<name> ...]
+
+const fs = require("fs");
+const path = require("path");
+const vm = require("vm");
+
+const page = fs.readFileSync(path.join(__dirname, "..", "..", "examples", "PHY Rates.html"), "utf8");
+
+// The rate calculation lives in the first inline script block
+const match = page.match(/<script language="JavaScript">([\s\S]*?)<\/script>/);
+if (!match) {
+  throw new Error("inline PHY rate script not found in PHY Rates.html");
+}
+
+function render(fixtureDir) {
+  const fixture = JSON.parse(fs.readFileSync(path.join(fixtureDir, "fixture.json"), "utf8"));
+  const responses = fixture.responses;
+
+  const mocaPhyType = [{ checked: true }, { checked: false }];
+  const sandbox = {
+    console: { log() {} },
+    Math,
+    document: {
+      netform: { mocaPhyType },
+      getElementById() { throw new Error("DOM access is not stubbed"); },
+      getElementsByTagName() { return [{ style: {} }]; },
+    },
+  };
+  vm.createContext(sandbox);
+  vm.runInContext(match[1], sandbox);
+
+  // Table rendering is DOM-only; keep the calculated rates instead
+  vm.runInContext("buildTable = function() {};", sandbox);
+
+  // Replay the data formLoad() would have fetched. The device returns hex strings and
+  // the page relies on JavaScript's numeric coercion of them, so pass them unchanged.
+  sandbox.LocalInfo = responses["/ms/0/0x15 []"];
+  vm.runInContext(`
+    init_proc();
+    myNodeID = LocalInfo[0];
+    mocaNetVer = LocalInfo[11];
+    nodeBitMask = LocalInfo[12];
+  `, sandbox);
+
+  const netInfo = vm.runInContext("netInfo", sandbox);
+  const fmrInfo = vm.runInContext("fmrInfo", sandbox);
+  const nodeBitMask = vm.runInContext("nodeBitMask", sandbox) & 0xffff;
+
+  for (let id = 0; id < 16; id++) {
+    if (nodeBitMask & (1 << id)) {
+      netInfo[id] = responses[`/ms/0/0x16 [${id}]`];
+    }
+  }
+  const ncMocaVer = netInfo[sandbox.LocalInfo[1] & 0xff][4] & 0xff;
+  vm.runInContext(`ncMocaVer = ${ncMocaVer};`, sandbox);
+
+  for (let id = 0; id < 16; id++) {
+    if (!(nodeBitMask & (1 << id))) {
+      continue;
+    }
+    const nodeMocaVer = netInfo[id][4] & 0xff;
+    const finalVer = Math.min(ncMocaVer, nodeMocaVer) < 0x20 ? 1 : 2;
+    fmrInfo[id] = responses[`/ms/0/0x1D [${1 << id},${finalVer}]`];
+  }
+
+  // Read the table once per PHY type radio button, as the user would see it
+  const table = {};
+  for (const [name, vlper] of [["nper", false], ["vlper", true]]) {
+    mocaPhyType[0].checked = !vlper;
+    mocaPhyType[1].checked = vlper;
+    vm.runInContext("refreshPage();", sandbox);
+
+    const numNode = vm.runInContext("numNode", sandbox);
+    const nodeId = vm.runInContext("nodeId", sandbox);
+    const phyRates = vm.runInContext("phy_rates", sandbox);
+
+    table[name] = {};
+    for (let row = 0; row < numNode; row++) {
+      const from = nodeId[row];
+      table[name][from] = {};
+      for (let col = 0; col < numNode; col++) {
+        const to = nodeId[col];
+        // The page shows "NA" for falsy rates
+        table[name][from][to] = phyRates[row][to] || 0;
+      }
+    }
+  }
+
+  fs.writeFileSync(path.join(fixtureDir, "phyrates_html.json"), JSON.stringify(table, null, 2) + "\n");
+}
+
+for (const dir of process.argv.slice(2)) {
+  render(path.resolve(dir));
+}
@@ -3,7 +3,12 @@ package config
 import (
 	"fmt"
 	"net"
+	"net/netip"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -13,19 +18,355 @@ import (
 
 // Config represents the application configuration
 type Config struct {
-	ListenAddress string   `yaml:"listen_address"`
-	ScrapeTimeout int      `yaml:"scrape_timeout"` // Timeout in seconds
-	Devices       []Device `yaml:"devices"`
+	ListenAddress string          `yaml:"listen_address"`
+	ScrapeTimeout int             `yaml:"scrape_timeout"` // Timeout in seconds
+	Devices       []Device        `yaml:"devices"`
+	Push          *PushConfig     `yaml:"push"`     // Optional push mode
+	OTLP          *OTLPConfig     `yaml:"otlp"`     // Optional OpenTelemetry export
+	InfluxDB      *InfluxDBConfig `yaml:"influxdb"` // Optional direct writes to InfluxDB v2
+	MQTT          *MQTTConfig     `yaml:"mqtt"`     // Optional MQTT publishing
+
+	// Minimum milliseconds between requests to one device, for adapters whose web
+	// server fails under back-to-back requests
+	MinRequestInterval int `yaml:"min_request_interval_ms"`
+
+	// Milliseconds taken off the scrape timeout sent by Prometheus, leaving time to
+	// write the response before Prometheus gives up
+	ScrapeTimeoutOffset int `yaml:"scrape_timeout_offset_ms"`
+
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker"` // Optional fast failure of unreachable devices
+
+	Admin      *AdminConfig      `yaml:"admin"`       // Optional admin API, disabled when absent
+	AutoReboot *AutoRebootConfig `yaml:"auto_reboot"` // Optional reboot of devices that stop responding
+
+	Discovery        *DiscoveryConfig        `yaml:"discovery"`         // Optional discovery of adapters on the local network
+	ServiceDiscovery *ServiceDiscoveryConfig `yaml:"service_discovery"` // Optional file_sd output for Prometheus
+
+	History *HistoryConfig `yaml:"history"` // Optional local storage of PHY rate history
+	Events  *EventsConfig  `yaml:"events"`  // Optional event log outputs and thresholds
+
+	Alerting *AlertingConfig `yaml:"alerting"` // Optional built-in notifications to webhooks
+
+	CustomMetrics []CustomEndpoint `yaml:"custom_metrics"` // Optional metrics from further device API calls
+
+	Profiles []ProfileConfig `yaml:"profiles"` // Optional interfaces of adapters other than goCoax
 }
 
 // Device represents a single goCoax device configuration
 type Device struct {
-	Name     string `yaml:"name"`
-	Address  string `yaml:"address"`
+	Name     string            `yaml:"name"`
+	Address  string            `yaml:"address"`
+	Username string            `yaml:"username"`
+	Password string            `yaml:"password"`
+	Labels   map[string]string `yaml:"labels"` // Target labels for service discovery
+
+	Auth       *AuthConfig `yaml:"auth"`        // Optional login flow; HTTP basic authentication by default
+	Profile    string      `yaml:"profile"`     // Interface of the adapter: gocoax (default) or a configured profile
+	ReadStatus bool        `yaml:"read_status"` // Read the device status with client.DefaultStatusLayout; unverified
+}
+
+// Device login methods
+const (
+	AuthBasic     = "basic"     // HTTP basic authentication with every request, as goCoax firmware expects
+	AuthForm      = "form"      // A login form that sets a session cookie
+	AuthChallenge = "challenge" // A login form that posts a SHA-256 response to a challenge
+	AuthAuto      = "auto"      // Detected from the device's login page
+)
+
+// AuthConfig selects how the exporter logs into a device's web interface. Paths and
+// field names left empty take the client's defaults.
+type AuthConfig struct {
+	Method        string `yaml:"method"`         // basic (default), form, challenge or auto
+	LoginPath     string `yaml:"login_path"`     // form, challenge: path the login is posted to
+	ChallengePath string `yaml:"challenge_path"` // challenge: path the challenge is fetched from
+	UsernameField string `yaml:"username_field"` // form, challenge: name of the username field
+	PasswordField string `yaml:"password_field"` // form, challenge: name of the password field
+}
+
+// PushConfig configures periodic pushing of the collected metrics, for exporters
+// that Prometheus cannot scrape directly
+type PushConfig struct {
+	Interval    int                `yaml:"interval"`    // Push interval in seconds
+	QueueSize   int                `yaml:"queue_size"`  // Pending pushes kept while a target is unavailable
+	MaxRetries  int                `yaml:"max_retries"` // Attempts per push before it is dropped
+	Pushgateway *PushgatewayConfig `yaml:"pushgateway"`
+	RemoteWrite *RemoteWriteConfig `yaml:"remote_write"`
+}
+
+// PushgatewayConfig represents a Prometheus Pushgateway target
+type PushgatewayConfig struct {
+	URL      string `yaml:"url"`
+	Job      string `yaml:"job"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// RemoteWriteConfig represents a Prometheus remote-write target
+type RemoteWriteConfig struct {
+	URL      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// GetInterval returns the push interval as a time.Duration
+func (p *PushConfig) GetInterval() time.Duration {
+	return time.Duration(p.Interval) * time.Second
+}
+
+// OTLPConfig configures export of the device metrics to an OpenTelemetry collector
+type OTLPConfig struct {
+	Protocol string            `yaml:"protocol"` // "http" or "grpc"
+	URL      string            `yaml:"url"`      // e.g. http://otel-collector:4318
+	Interval int               `yaml:"interval"` // Export interval in seconds
+	Headers  map[string]string `yaml:"headers"`
+
+	// DisableMetricsEndpoint turns off the Prometheus /metrics handler when OTLP is
+	// the only consumer
+	DisableMetricsEndpoint bool `yaml:"disable_metrics_endpoint"`
+}
+
+// GetInterval returns the export interval as a time.Duration
+func (o *OTLPConfig) GetInterval() time.Duration {
+	return time.Duration(o.Interval) * time.Second
+}
+
+// InfluxDBConfig configures periodic writes to the InfluxDB v2 write API
+type InfluxDBConfig struct {
+	URL      string `yaml:"url"` // e.g. http://influxdb:8086
+	Org      string `yaml:"org"`
+	Bucket   string `yaml:"bucket"`
+	Token    string `yaml:"token"`
+	Interval int    `yaml:"interval"` // Write interval in seconds
+}
+
+// GetInterval returns the write interval as a time.Duration
+func (i *InfluxDBConfig) GetInterval() time.Duration {
+	return time.Duration(i.Interval) * time.Second
+}
+
+// MQTTConfig configures publishing of device state to an MQTT broker
+type MQTTConfig struct {
+	Broker           string `yaml:"broker"` // e.g. tcp://mqtt:1883
+	ClientID         string `yaml:"client_id"`
+	Username         string `yaml:"username"`
+	Password         string `yaml:"password"`
+	TopicPrefix      string `yaml:"topic_prefix"`      // State topics are <prefix>/<device>/...
+	DiscoveryPrefix  string `yaml:"discovery_prefix"`  // Home Assistant discovery prefix
+	DisableDiscovery bool   `yaml:"disable_discovery"` // Skip Home Assistant discovery config
+	QoS              byte   `yaml:"qos"`
+	Interval         int    `yaml:"interval"` // Publish interval in seconds
+}
+
+// GetInterval returns the publish interval as a time.Duration
+func (m *MQTTConfig) GetInterval() time.Duration {
+	return time.Duration(m.Interval) * time.Second
+}
+
+// CircuitBreakerConfig stops querying a device after consecutive failures, probing it
+// again at increasing intervals, so unreachable devices do not slow down scrapes
+type CircuitBreakerConfig struct {
+	FailureThreshold int `yaml:"failure_threshold"` // Consecutive failures before the circuit opens
+	InitialBackoff   int `yaml:"initial_backoff"`   // Seconds before the first probe of an open circuit
+	MaxBackoff       int `yaml:"max_backoff"`       // Longest wait between probes in seconds
+}
+
+// GetInitialBackoff returns the wait before the first probe as a time.Duration
+func (b *CircuitBreakerConfig) GetInitialBackoff() time.Duration {
+	return time.Duration(b.InitialBackoff) * time.Second
+}
+
+// GetMaxBackoff returns the longest wait between probes as a time.Duration
+func (b *CircuitBreakerConfig) GetMaxBackoff() time.Duration {
+	return time.Duration(b.MaxBackoff) * time.Second
+}
+
+// AdminConfig enables the admin API for management actions such as reboots
+type AdminConfig struct {
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
+	AuditLog string `yaml:"audit_log"` // File for the audit log; empty writes to the standard log
+}
+
+// AutoRebootConfig reboots a device after consecutive failed queries
+type AutoRebootConfig struct {
+	FailureThreshold int `yaml:"failure_threshold"` // Consecutive failed queries before a reboot
+	MinInterval      int `yaml:"min_interval"`      // Minimum seconds between reboots of a device
+}
+
+// GetMinInterval returns the minimum time between reboots as a time.Duration
+func (a *AutoRebootConfig) GetMinInterval() time.Duration {
+	return time.Duration(a.MinInterval) * time.Second
+}
+
+// DiscoveryConfig enables periodic probing of address ranges for goCoax adapters
+type DiscoveryConfig struct {
+	CIDRs    []string `yaml:"cidrs"`    // e.g. 192.168.98.0/24
+	Interval int      `yaml:"interval"` // Seconds between probes of the ranges
+	Port     int      `yaml:"port"`     // HTTP port of the adapters
+	Workers  int      `yaml:"workers"`  // Hosts probed concurrently
+	Username string   `yaml:"username"` // Credentials for discovered adapters
+	Password string   `yaml:"password"`
+
+	MaxMissedScans int `yaml:"max_missed_scans"` // Scans a discovered adapter may miss before it is dropped
+}
+
+// GetInterval returns the probe interval as a time.Duration
+func (d *DiscoveryConfig) GetInterval() time.Duration {
+	return time.Duration(d.Interval) * time.Second
+}
+
+// ServiceDiscoveryConfig enables writing the scrape targets to a Prometheus file_sd file
+type ServiceDiscoveryConfig struct {
+	File            string `yaml:"file"`             // e.g. /etc/prometheus/targets/gocoax.json
+	ExporterAddress string `yaml:"exporter_address"` // host:port Prometheus uses to reach the exporter
+	Interval        int    `yaml:"interval"`         // Seconds between updates of the file
+}
+
+// GetInterval returns the update interval as a time.Duration
+func (s *ServiceDiscoveryConfig) GetInterval() time.Duration {
+	return time.Duration(s.Interval) * time.Second
+}
+
+// HistoryConfig enables recording of PHY rates and node membership to a local file
+type HistoryConfig struct {
+	Path          string `yaml:"path"`           // e.g. /var/lib/gocoax/history.db
+	Interval      int    `yaml:"interval"`       // Seconds between polls
+	RetentionDays int    `yaml:"retention_days"` // Records older than this are removed
+}
+
+// GetInterval returns the poll interval as a time.Duration
+func (h *HistoryConfig) GetInterval() time.Duration {
+	return time.Duration(h.Interval) * time.Second
+}
+
+// GetRetention returns the retention period as a time.Duration
+func (h *HistoryConfig) GetRetention() time.Duration {
+	return time.Duration(h.RetentionDays) * 24 * time.Hour
+}
+
+// EventsConfig configures the log of network changes such as nodes joining or leaving
+type EventsConfig struct {
+	File              string  `yaml:"file"`                // JSON lines file for events
+	WebhookURL        string  `yaml:"webhook_url"`         // Events are POSTed here as JSON
+	StepChangePercent float64 `yaml:"step_change_percent"` // PHY rate change reported as an event
+	BufferSize        int     `yaml:"buffer_size"`         // Events kept for /api/v1/events
+}
+
+// AlertingConfig enables notifications to webhooks when rules about devices and
+// links fire and resolve
+type AlertingConfig struct {
+	Interval       int                  `yaml:"interval"`        // Seconds between polls of the devices
+	RepeatInterval int                  `yaml:"repeat_interval"` // Seconds before a firing alert is sent again
+	Rules          []AlertRule          `yaml:"rules"`
+	Webhooks       []AlertWebhookConfig `yaml:"webhooks"`
+}
+
+// Alert rule types
+const (
+	AlertDeviceDown       = "device_down"        // Device failed Polls consecutive polls
+	AlertLinkBelow        = "link_below"         // A link's NPER rate is below ThresholdMbps
+	AlertNodeCountChanged = "node_count_changed" // The number of nodes differs from ExpectedNodes
+)
+
+// AlertRule is a condition checked against every poll of a device
+type AlertRule struct {
+	Name          string   `yaml:"name"`
+	Type          string   `yaml:"type"`           // device_down, link_below or node_count_changed
+	Devices       []string `yaml:"devices"`        // Devices the rule applies to; empty for all
+	Polls         int      `yaml:"polls"`          // device_down: consecutive failed polls
+	ThresholdMbps int      `yaml:"threshold_mbps"` // link_below: lowest acceptable NPER rate
+	ExpectedNodes int      `yaml:"expected_nodes"` // node_count_changed: the first count seen if unset
+}
+
+// AlertWebhookConfig is a receiver of alert notifications
+type AlertWebhookConfig struct {
+	URL             string `yaml:"url"`
+	Format          string `yaml:"format"`           // generic, slack, discord or ntfy
+	DisableResolved bool   `yaml:"disable_resolved"` // Skip notifications of resolved alerts
+}
+
+// GetInterval returns the poll interval as a time.Duration
+func (a *AlertingConfig) GetInterval() time.Duration {
+	return time.Duration(a.Interval) * time.Second
+}
+
+// GetRepeatInterval returns the repeat interval as a time.Duration
+func (a *AlertingConfig) GetRepeatInterval() time.Duration {
+	return time.Duration(a.RepeatInterval) * time.Second
 }
 
+// ProfileGoCoax is the built-in profile of goCoax adapters
+const ProfileGoCoax = "gocoax"
+
+// ProfileConfig describes the interface of adapters built on the same chipsets as
+// goCoax, such as ScreenBeam and Motorola models, by how it differs from goCoax's
+type ProfileConfig struct {
+	Name        string            `yaml:"name"`
+	SessionPath string            `yaml:"session_path"` // Page that opens a session
+	CSRFCookies []string          `yaml:"csrf_cookies"` // Cookies sent back as the X-CSRF-TOKEN header
+	Auth        *AuthConfig       `yaml:"auth"`         // Login flow of devices without their own auth
+	Endpoints   map[string]string `yaml:"endpoints"`    // local_info, node_info, fmr, status, stats or reboot
+	LocalInfo   map[string]int    `yaml:"local_info"`   // Word offsets: my_node_id, nc_node_id, moca_net_version, node_bitmask
+	NodeInfo    map[string]int    `yaml:"node_info"`    // Word offsets: mac_high, mac_low, moca_version
+	FMRBatch    bool              `yaml:"fmr_batch"`    // Request FMR for all nodes at once; unverified
+}
+
+// Keys of the profile endpoints and offsets
+var (
+	profileEndpoints  = []string{"local_info", "node_info", "fmr", "status", "stats", "reboot"}
+	profileLocalInfo  = []string{"my_node_id", "nc_node_id", "moca_net_version", "node_bitmask"}
+	profileNodeInfo   = []string{"mac_high", "mac_low", "moca_version"}
+	profileEndpointRE = regexp.MustCompile(`^/ms/[01]/0x[0-9a-fA-F]+$`)
+)
+
+// GetProfile returns the configured profile with the given name, or nil for the
+// built-in goCoax profile and unknown names
+func (c *Config) GetProfile(name string) *ProfileConfig {
+	for i := range c.Profiles {
+		if c.Profiles[i].Name == name {
+			return &c.Profiles[i]
+		}
+	}
+	return nil
+}
+
+// CustomEndpoint is a device API call, such as /ms/0/0x14, whose response words are
+// exported as metrics
+type CustomEndpoint struct {
+	Endpoint string         `yaml:"endpoint"` // /ms/0/<id>; only space 0, which reads data, is allowed
+	Data     []int          `yaml:"data"`     // Request data, empty by default
+	Metrics  []CustomMetric `yaml:"metrics"`
+}
+
+// Custom metric types
+const (
+	CustomGauge   = "gauge"
+	CustomCounter = "counter"
+)
+
+// CustomMetric maps bits of one response word to a metric: (word & mask) >> shift
+type CustomMetric struct {
+	Name   string            `yaml:"name"`
+	Help   string            `yaml:"help"`
+	Type   string            `yaml:"type"`   // gauge (default) or counter
+	Word   int               `yaml:"word"`   // Index of the response word
+	Mask   uint32            `yaml:"mask"`   // Bits of the word; all bits by default
+	Shift  int               `yaml:"shift"`  // Right shift applied after the mask
+	Labels map[string]string `yaml:"labels"` // Constant labels, in addition to device
+}
+
+// customEndpointRE matches the read-only device API endpoints
+var customEndpointRE = regexp.MustCompile(`^/ms/0/0x[0-9a-fA-F]+$`)
+
+// metricNameRE matches valid Prometheus metric names
+var metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// labelNameRE matches valid Prometheus label names
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Largest range discovery will probe, a /16 for IPv4
+const maxDiscoveryHosts = 1 << 16
+
 // Load reads configuration from a YAML file and applies defaults
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
@@ -33,7 +374,9 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	cfg := &Config{}
+	// Defaults for which zero is a valid setting are set before parsing, so that an
+	// explicit zero is kept
+	cfg := &Config{ScrapeTimeoutOffset: 500}
 	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
@@ -45,6 +388,136 @@ func Load(path string) (*Config, error) {
 	if cfg.ScrapeTimeout == 0 {
 		cfg.ScrapeTimeout = 10
 	}
+	if cfg.Push != nil {
+		if cfg.Push.Interval == 0 {
+			cfg.Push.Interval = 30
+		}
+		if cfg.Push.QueueSize == 0 {
+			cfg.Push.QueueSize = 10
+		}
+		if cfg.Push.MaxRetries == 0 {
+			cfg.Push.MaxRetries = 3
+		}
+		if cfg.Push.Pushgateway != nil && cfg.Push.Pushgateway.Job == "" {
+			cfg.Push.Pushgateway.Job = "gocoax"
+		}
+	}
+	if cfg.InfluxDB != nil && cfg.InfluxDB.Interval == 0 {
+		cfg.InfluxDB.Interval = 30
+	}
+	if cfg.MQTT != nil {
+		if cfg.MQTT.ClientID == "" {
+			cfg.MQTT.ClientID = "gocoax-exporter"
+		}
+		if cfg.MQTT.TopicPrefix == "" {
+			cfg.MQTT.TopicPrefix = "gocoax"
+		}
+		if cfg.MQTT.DiscoveryPrefix == "" {
+			cfg.MQTT.DiscoveryPrefix = "homeassistant"
+		}
+		if cfg.MQTT.Interval == 0 {
+			cfg.MQTT.Interval = 30
+		}
+	}
+	if cfg.AutoReboot != nil {
+		if cfg.AutoReboot.FailureThreshold == 0 {
+			cfg.AutoReboot.FailureThreshold = 5
+		}
+		if cfg.AutoReboot.MinInterval == 0 {
+			cfg.AutoReboot.MinInterval = 3600
+		}
+	}
+	if cfg.Discovery != nil {
+		if cfg.Discovery.Interval == 0 {
+			cfg.Discovery.Interval = 300
+		}
+		if cfg.Discovery.Port == 0 {
+			cfg.Discovery.Port = 80
+		}
+		if cfg.Discovery.Workers == 0 {
+			cfg.Discovery.Workers = 16
+		}
+		if cfg.Discovery.MaxMissedScans == 0 {
+			cfg.Discovery.MaxMissedScans = 3
+		}
+		// Factory default credentials of goCoax adapters
+		if cfg.Discovery.Username == "" {
+			cfg.Discovery.Username = "admin"
+		}
+		if cfg.Discovery.Password == "" {
+			cfg.Discovery.Password = "gocoax"
+		}
+	}
+	if cfg.ServiceDiscovery != nil && cfg.ServiceDiscovery.Interval == 0 {
+		cfg.ServiceDiscovery.Interval = 60
+	}
+	if cfg.History != nil {
+		if cfg.History.Interval == 0 {
+			cfg.History.Interval = 60
+		}
+		if cfg.History.RetentionDays == 0 {
+			cfg.History.RetentionDays = 30
+		}
+	}
+	if cfg.Events != nil {
+		if cfg.Events.StepChangePercent == 0 {
+			cfg.Events.StepChangePercent = 25
+		}
+		if cfg.Events.BufferSize == 0 {
+			cfg.Events.BufferSize = 1000
+		}
+	}
+	if cfg.CircuitBreaker != nil {
+		if cfg.CircuitBreaker.FailureThreshold == 0 {
+			cfg.CircuitBreaker.FailureThreshold = 3
+		}
+		if cfg.CircuitBreaker.InitialBackoff == 0 {
+			cfg.CircuitBreaker.InitialBackoff = 30
+		}
+		if cfg.CircuitBreaker.MaxBackoff == 0 {
+			cfg.CircuitBreaker.MaxBackoff = 600
+		}
+	}
+	if cfg.Alerting != nil {
+		if cfg.Alerting.Interval == 0 {
+			cfg.Alerting.Interval = 60
+		}
+		if cfg.Alerting.RepeatInterval == 0 {
+			cfg.Alerting.RepeatInterval = 4 * 60 * 60
+		}
+		for i := range cfg.Alerting.Rules {
+			if cfg.Alerting.Rules[i].Type == AlertDeviceDown && cfg.Alerting.Rules[i].Polls == 0 {
+				cfg.Alerting.Rules[i].Polls = 3
+			}
+		}
+		for i := range cfg.Alerting.Webhooks {
+			if cfg.Alerting.Webhooks[i].Format == "" {
+				cfg.Alerting.Webhooks[i].Format = "generic"
+			}
+		}
+	}
+	for i := range cfg.CustomMetrics {
+		for j := range cfg.CustomMetrics[i].Metrics {
+			metric := &cfg.CustomMetrics[i].Metrics[j]
+			if metric.Type == "" {
+				metric.Type = CustomGauge
+			}
+			if metric.Mask == 0 {
+				metric.Mask = 0xFFFFFFFF
+			}
+			if metric.Help == "" {
+				metric.Help = "Custom metric from the goCoax device API"
+			}
+		}
+	}
+	if cfg.OTLP != nil {
+		if cfg.OTLP.Protocol == "" {
+			cfg.OTLP.Protocol = "http"
+		}
+		if cfg.OTLP.Interval == 0 {
+			cfg.OTLP.Interval = 30
+		}
+	}
 
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
@@ -54,13 +527,22 @@ func Load(path string) (*Config, error) {
 	// Load from environment variables if set
 	cfg.loadFromEnv()
 
+	// Checked after the environment, which may supply the admin password
+	if cfg.Admin != nil && cfg.Admin.Password == "" {
+		return nil, fmt.Errorf("invalid configuration: admin: password is required")
+	}
+
 	return cfg, nil
 }
 
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
-	if len(c.Devices) == 0 {
-		return fmt.Errorf("at least one device must be configured")
+	if len(c.Devices) == 0 && c.Discovery == nil {
+		return fmt.Errorf("at least one device or discovery must be configured")
+	}
+
+	if err := validateProfiles(c.Profiles); err != nil {
+		return fmt.Errorf("profiles: %w", err)
 	}
 
 	for i, device := range c.Devices {
@@ -99,12 +581,455 @@ func (c *Config) Validate() error {
 		if device.Password == "" {
 			return fmt.Errorf("device %d (%s): password is required", i, device.Name)
 		}
+		for name := range device.Labels {
+			if !labelNameRE.MatchString(name) || strings.HasPrefix(name, "__") {
+				return fmt.Errorf("device %d (%s): invalid label name %q", i, device.Name, name)
+			}
+		}
+		if err := validateAuth(device.Auth); err != nil {
+			return fmt.Errorf("device %d (%s): %w", i, device.Name, err)
+		}
+		if device.Profile != "" && device.Profile != ProfileGoCoax && c.GetProfile(device.Profile) == nil {
+			return fmt.Errorf("device %d (%s): unknown profile %q", i, device.Name, device.Profile)
+		}
 	}
 
 	if c.ScrapeTimeout < 1 {
 		return fmt.Errorf("scrape_timeout must be at least 1 second")
 	}
+	if c.MinRequestInterval < 0 || c.MinRequestInterval > 1000 {
+		return fmt.Errorf("min_request_interval_ms must be from 0 to 1000")
+	}
+	if c.ScrapeTimeoutOffset < 0 || c.ScrapeTimeoutOffset > 5000 {
+		return fmt.Errorf("scrape_timeout_offset_ms must be from 0 to 5000")
+	}
+
+	if c.CircuitBreaker != nil {
+		if c.CircuitBreaker.FailureThreshold < 1 {
+			return fmt.Errorf("circuit_breaker: failure_threshold must be at least 1")
+		}
+		if c.CircuitBreaker.InitialBackoff < 1 {
+			return fmt.Errorf("circuit_breaker: initial_backoff must be at least 1 second")
+		}
+		if c.CircuitBreaker.MaxBackoff < c.CircuitBreaker.InitialBackoff {
+			return fmt.Errorf("circuit_breaker: max_backoff must be at least initial_backoff")
+		}
+	}
+
+	if c.Push != nil {
+		if err := c.Push.Validate(); err != nil {
+			return fmt.Errorf("push: %w", err)
+		}
+	}
+
+	if c.InfluxDB != nil {
+		if err := validateURL(c.InfluxDB.URL); err != nil {
+			return fmt.Errorf("influxdb: %w", err)
+		}
+		if c.InfluxDB.Org == "" || c.InfluxDB.Bucket == "" {
+			return fmt.Errorf("influxdb: org and bucket are required")
+		}
+		if c.InfluxDB.Interval < 1 {
+			return fmt.Errorf("influxdb: interval must be at least 1 second")
+		}
+	}
+
+	if c.MQTT != nil {
+		if err := c.MQTT.Validate(); err != nil {
+			return fmt.Errorf("mqtt: %w", err)
+		}
+	}
+
+	if c.Admin != nil && c.Admin.Username == "" {
+		return fmt.Errorf("admin: username is required")
+	}
+
+	if c.AutoReboot != nil {
+		if c.AutoReboot.FailureThreshold < 1 {
+			return fmt.Errorf("auto_reboot: failure_threshold must be at least 1")
+		}
+		if c.AutoReboot.MinInterval < 60 {
+			return fmt.Errorf("auto_reboot: min_interval must be at least 60 seconds")
+		}
+	}
+
+	if c.Discovery != nil {
+		if err := c.Discovery.Validate(); err != nil {
+			return fmt.Errorf("discovery: %w", err)
+		}
+	}
+
+	if c.ServiceDiscovery != nil {
+		if c.ServiceDiscovery.File == "" {
+			return fmt.Errorf("service_discovery: file is required")
+		}
+		if c.ServiceDiscovery.ExporterAddress != "" {
+			if _, _, err := net.SplitHostPort(c.ServiceDiscovery.ExporterAddress); err != nil {
+				return fmt.Errorf("service_discovery: invalid exporter_address: %w", err)
+			}
+		}
+		if c.ServiceDiscovery.Interval < 1 {
+			return fmt.Errorf("service_discovery: interval must be at least 1 second")
+		}
+	}
+
+	if c.History != nil {
+		if c.History.Path == "" {
+			return fmt.Errorf("history: path is required")
+		}
+		if c.History.Interval < 10 {
+			return fmt.Errorf("history: interval must be at least 10 seconds")
+		}
+		if c.History.RetentionDays < 1 {
+			return fmt.Errorf("history: retention_days must be at least 1")
+		}
+	}
+
+	if c.Events != nil {
+		if c.Events.WebhookURL != "" {
+			if err := validateURL(c.Events.WebhookURL); err != nil {
+				return fmt.Errorf("events: webhook_url: %w", err)
+			}
+		}
+		if c.Events.StepChangePercent < 0 {
+			return fmt.Errorf("events: step_change_percent must be positive")
+		}
+		if c.Events.BufferSize < 1 {
+			return fmt.Errorf("events: buffer_size must be at least 1")
+		}
+	}
+
+	if c.Alerting != nil {
+		if err := c.Alerting.Validate(); err != nil {
+			return fmt.Errorf("alerting: %w", err)
+		}
+	}
+
+	if err := validateCustomMetrics(c.CustomMetrics); err != nil {
+		return fmt.Errorf("custom_metrics: %w", err)
+	}
+
+	if c.OTLP != nil {
+		if c.OTLP.Protocol != "http" && c.OTLP.Protocol != "grpc" {
+			return fmt.Errorf("otlp: protocol must be http or grpc")
+		}
+		if c.OTLP.Interval < 1 {
+			return fmt.Errorf("otlp: interval must be at least 1 second")
+		}
+		if err := validateURL(c.OTLP.URL); err != nil {
+			return fmt.Errorf("otlp: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks if the push configuration is valid
+func (p *PushConfig) Validate() error {
+	if p.Pushgateway == nil && p.RemoteWrite == nil {
+		return fmt.Errorf("at least one of pushgateway or remote_write must be configured")
+	}
+	if p.Interval < 1 {
+		return fmt.Errorf("interval must be at least 1 second")
+	}
+	if p.QueueSize < 1 {
+		return fmt.Errorf("queue_size must be at least 1")
+	}
+	if p.MaxRetries < 1 {
+		return fmt.Errorf("max_retries must be at least 1")
+	}
+
+	if p.Pushgateway != nil {
+		if err := validateURL(p.Pushgateway.URL); err != nil {
+			return fmt.Errorf("pushgateway: %w", err)
+		}
+	}
+	if p.RemoteWrite != nil {
+		if err := validateURL(p.RemoteWrite.URL); err != nil {
+			return fmt.Errorf("remote_write: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks if the MQTT configuration is valid
+func (m *MQTTConfig) Validate() error {
+	if m.Broker == "" {
+		return fmt.Errorf("broker is required")
+	}
+	u, err := url.Parse(m.Broker)
+	if err != nil {
+		return fmt.Errorf("invalid broker: %w", err)
+	}
+	switch u.Scheme {
+	case "tcp", "ssl", "tls", "mqtt", "mqtts", "ws", "wss":
+	default:
+		return fmt.Errorf("broker must be a tcp://, ssl:// or ws:// URL")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("broker must include a host")
+	}
+	if strings.ContainsAny(m.TopicPrefix, "+#") || strings.ContainsAny(m.DiscoveryPrefix, "+#") {
+		return fmt.Errorf("topic prefixes must not contain wildcards")
+	}
+	if m.QoS > 2 {
+		return fmt.Errorf("qos must be 0, 1 or 2")
+	}
+	if m.Interval < 1 {
+		return fmt.Errorf("interval must be at least 1 second")
+	}
+	return nil
+}
+
+// Validate checks if the discovery configuration is valid
+func (d *DiscoveryConfig) Validate() error {
+	if len(d.CIDRs) == 0 {
+		return fmt.Errorf("at least one cidr is required")
+	}
+	for _, cidr := range d.CIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid cidr %q: %w", cidr, err)
+		}
+		if hostBits := prefix.Addr().BitLen() - prefix.Bits(); hostBits > 16 {
+			return fmt.Errorf("cidr %q has more than %d addresses", cidr, maxDiscoveryHosts)
+		}
+	}
+	if d.Interval < 10 {
+		return fmt.Errorf("interval must be at least 10 seconds")
+	}
+	if d.Port < 1 || d.Port > 65535 {
+		return fmt.Errorf("invalid port number")
+	}
+	if d.Workers < 1 {
+		return fmt.Errorf("workers must be at least 1")
+	}
+	if d.MaxMissedScans < 1 {
+		return fmt.Errorf("max_missed_scans must be at least 1")
+	}
+	return nil
+}
+
+// Validate checks if the alerting configuration is valid
+func (a *AlertingConfig) Validate() error {
+	if a.Interval < 10 {
+		return fmt.Errorf("interval must be at least 10 seconds")
+	}
+	if a.RepeatInterval < a.Interval {
+		return fmt.Errorf("repeat_interval must be at least the interval")
+	}
+	if len(a.Rules) == 0 {
+		return fmt.Errorf("at least one rule is required")
+	}
+	if len(a.Webhooks) == 0 {
+		return fmt.Errorf("at least one webhook is required")
+	}
+
+	names := make(map[string]bool, len(a.Rules))
+	for i, rule := range a.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d: name is required", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rule %d (%s): duplicate name", i, rule.Name)
+		}
+		names[rule.Name] = true
+
+		switch rule.Type {
+		case AlertDeviceDown:
+			if rule.Polls < 1 {
+				return fmt.Errorf("rule %d (%s): polls must be at least 1", i, rule.Name)
+			}
+		case AlertLinkBelow:
+			if rule.ThresholdMbps < 1 {
+				return fmt.Errorf("rule %d (%s): threshold_mbps must be at least 1", i, rule.Name)
+			}
+		case AlertNodeCountChanged:
+			if rule.ExpectedNodes < 0 || rule.ExpectedNodes > 16 {
+				return fmt.Errorf("rule %d (%s): expected_nodes must be from 1 to 16, or 0 for the first count seen", i, rule.Name)
+			}
+		default:
+			return fmt.Errorf("rule %d (%s): type must be device_down, link_below or node_count_changed", i, rule.Name)
+		}
+	}
+
+	for i, hook := range a.Webhooks {
+		if err := validateURL(hook.URL); err != nil {
+			return fmt.Errorf("webhook %d: %w", i, err)
+		}
+		switch hook.Format {
+		case "generic", "slack", "discord", "ntfy":
+		default:
+			return fmt.Errorf("webhook %d: format must be generic, slack, discord or ntfy", i)
+		}
+	}
+	return nil
+}
+
+// validateCustomMetrics checks the custom endpoints. A metric name may be used more
+// than once, with the same help, type and label names but different label values,
+// such as one metric per channel.
+func validateCustomMetrics(endpoints []CustomEndpoint) error {
+	first := make(map[string]CustomMetric) // first metric of each name
+	series := make(map[string]bool)        // name and label values of each metric
+	for i, e := range endpoints {
+		if !customEndpointRE.MatchString(e.Endpoint) {
+			return fmt.Errorf("endpoint %d: %q is not a /ms/0/0x<id> endpoint", i, e.Endpoint)
+		}
+		if len(e.Metrics) == 0 {
+			return fmt.Errorf("endpoint %d (%s): at least one metric is required", i, e.Endpoint)
+		}
+
+		for j, m := range e.Metrics {
+			if !metricNameRE.MatchString(m.Name) {
+				return fmt.Errorf("endpoint %d (%s) metric %d: invalid name %q", i, e.Endpoint, j, m.Name)
+			}
+			// gocoax_ names belong to the built-in metrics, except under gocoax_custom_
+			if strings.HasPrefix(m.Name, "gocoax_") && !strings.HasPrefix(m.Name, "gocoax_custom_") {
+				return fmt.Errorf("metric %s: names starting with gocoax_ are reserved, use gocoax_custom_ or another prefix", m.Name)
+			}
+			if m.Type != CustomGauge && m.Type != CustomCounter {
+				return fmt.Errorf("metric %s: type must be gauge or counter", m.Name)
+			}
+			if m.Word < 0 {
+				return fmt.Errorf("metric %s: word must not be negative", m.Name)
+			}
+			if m.Shift < 0 || m.Shift > 31 {
+				return fmt.Errorf("metric %s: shift must be from 0 to 31", m.Name)
+			}
+
+			names := make([]string, 0, len(m.Labels))
+			for name := range m.Labels {
+				if !labelNameRE.MatchString(name) || strings.HasPrefix(name, "__") || name == "device" {
+					return fmt.Errorf("metric %s: invalid label name %q", m.Name, name)
+				}
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			key := m.Name
+			for _, name := range names {
+				key += "," + name + "=" + m.Labels[name]
+			}
+			if series[key] {
+				return fmt.Errorf("metric %s: duplicate metric with the same labels", m.Name)
+			}
+			series[key] = true
+
+			if prev, ok := first[m.Name]; ok {
+				if prev.Help != m.Help || prev.Type != m.Type || !sameLabelNames(prev.Labels, m.Labels) {
+					return fmt.Errorf("metric %s: repeated with a different help, type or label names", m.Name)
+				}
+			} else {
+				first[m.Name] = m
+			}
+		}
+	}
+	return nil
+}
+
+// validateAuth checks the login settings of a device and defaults the method to basic
+func validateAuth(auth *AuthConfig) error {
+	if auth == nil {
+		return nil
+	}
+
+	switch auth.Method {
+	case "":
+		auth.Method = AuthBasic
+	case AuthBasic, AuthForm, AuthChallenge, AuthAuto:
+	default:
+		return fmt.Errorf("auth: method must be basic, form, challenge or auto")
+	}
+	for _, path := range []string{auth.LoginPath, auth.ChallengePath} {
+		if path != "" && !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("auth: path %q must start with /", path)
+		}
+	}
+	return nil
+}
+
+// validateProfiles checks the configured profiles. Endpoints must be API calls, in
+// space 1 for reboot and space 0, which reads data, for the others.
+func validateProfiles(profiles []ProfileConfig) error {
+	names := make(map[string]bool, len(profiles))
+	for i, p := range profiles {
+		if p.Name == "" {
+			return fmt.Errorf("profile %d: name is required", i)
+		}
+		if p.Name == ProfileGoCoax || names[p.Name] {
+			return fmt.Errorf("profile %s: name is already used", p.Name)
+		}
+		names[p.Name] = true
+
+		if p.SessionPath != "" && !strings.HasPrefix(p.SessionPath, "/") {
+			return fmt.Errorf("profile %s: session_path must start with /", p.Name)
+		}
+		if err := validateAuth(p.Auth); err != nil {
+			return fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+
+		for key, endpoint := range p.Endpoints {
+			if !slices.Contains(profileEndpoints, key) {
+				return fmt.Errorf("profile %s: unknown endpoint %q", p.Name, key)
+			}
+			space := "/ms/0/"
+			if key == "reboot" {
+				space = "/ms/1/"
+			}
+			if !profileEndpointRE.MatchString(endpoint) || !strings.HasPrefix(endpoint, space) {
+				return fmt.Errorf("profile %s: endpoint %s must be a %s0x<id> call", p.Name, key, space)
+			}
+		}
+		if err := validateOffsets(p.LocalInfo, profileLocalInfo); err != nil {
+			return fmt.Errorf("profile %s: local_info: %w", p.Name, err)
+		}
+		if err := validateOffsets(p.NodeInfo, profileNodeInfo); err != nil {
+			return fmt.Errorf("profile %s: node_info: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateOffsets checks the word offsets of a profile against their known keys
+func validateOffsets(offsets map[string]int, keys []string) error {
+	for key, offset := range offsets {
+		if !slices.Contains(keys, key) {
+			return fmt.Errorf("unknown field %q", key)
+		}
+		if offset < 0 || offset > 255 {
+			return fmt.Errorf("%s must be from 0 to 255", key)
+		}
+	}
+	return nil
+}
+
+// sameLabelNames reports whether two label sets have the same names
+func sameLabelNames(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name := range a {
+		if _, ok := b[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
 
+// validateURL checks that a target URL is an absolute http(s) URL
+func validateURL(raw string) error {
+	if raw == "" {
+		return fmt.Errorf("url is required")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
 	return nil
 }
 
@@ -114,6 +1039,30 @@ func (c *Config) loadFromEnv() {
 		c.ListenAddress = addr
 	}
 
+	if c.InfluxDB != nil {
+		if token := os.Getenv("GOCOAX_INFLUXDB_TOKEN"); token != "" {
+			c.InfluxDB.Token = token
+		}
+	}
+
+	if c.MQTT != nil {
+		if password := os.Getenv("GOCOAX_MQTT_PASSWORD"); password != "" {
+			c.MQTT.Password = password
+		}
+	}
+
+	if c.Admin != nil {
+		if password := os.Getenv("GOCOAX_ADMIN_PASSWORD"); password != "" {
+			c.Admin.Password = password
+		}
+	}
+
+	if c.Discovery != nil {
+		if password := os.Getenv("GOCOAX_DISCOVERY_PASSWORD"); password != "" {
+			c.Discovery.Password = password
+		}
+	}
+
 	if timeout := os.Getenv("GOCOAX_SCRAPE_TIMEOUT"); timeout != "" {
 		if t, err := strconv.Atoi(timeout); err == nil && t > 0 {
 			c.ScrapeTimeout = t
@@ -139,6 +1088,16 @@ func (c *Config) loadFromEnv() {
 	}
 }
 
+// GetMinRequestInterval returns the minimum time between requests to a device
+func (c *Config) GetMinRequestInterval() time.Duration {
+	return time.Duration(c.MinRequestInterval) * time.Millisecond
+}
+
+// GetScrapeTimeoutOffset returns the time taken off the scrape timeout sent by Prometheus
+func (c *Config) GetScrapeTimeoutOffset() time.Duration {
+	return time.Duration(c.ScrapeTimeoutOffset) * time.Millisecond
+}
+
 // GetTimeout returns the scrape timeout as a time.Duration
 func (c *Config) GetTimeout() time.Duration {
 	return time.Duration(c.ScrapeTimeout) * time.Second
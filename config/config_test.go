@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -19,6 +20,7 @@ devices:
     address: "192.168.1.100:80"
     username: "admin"
     password: "secret"
+    read_status: true
 `
 
 	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
@@ -60,6 +62,10 @@ devices:
 	if device.Password != "secret" {
 		t.Errorf("Expected password 'secret', got %s", device.Password)
 	}
+
+	if !device.ReadStatus {
+		t.Error("Expected read_status to be set")
+	}
 }
 
 func TestConfigDefaults(t *testing.T) {
@@ -92,6 +98,21 @@ devices:
 	if cfg.ScrapeTimeout != 10 {
 		t.Errorf("Expected default scrape timeout 10, got %d", cfg.ScrapeTimeout)
 	}
+	if cfg.ScrapeTimeoutOffset != 500 {
+		t.Errorf("Expected default scrape timeout offset 500, got %d", cfg.ScrapeTimeoutOffset)
+	}
+
+	// An explicit zero turns the offset off
+	if err := os.WriteFile(configPath, []byte("scrape_timeout_offset_ms: 0\n"+configContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	cfg, err = Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.ScrapeTimeoutOffset != 0 {
+		t.Errorf("Expected scrape timeout offset 0 to be kept, got %d", cfg.ScrapeTimeoutOffset)
+	}
 
 	// Check auto-port addition
 	if cfg.Devices[0].Address != "192.168.1.1:80" {
@@ -116,6 +137,20 @@ devices: []
 			expectError: true,
 			errorMsg:    "at least one device",
 		},
+		{
+			name: "reserved label name",
+			config: `
+devices:
+  - name: "test"
+    address: "192.168.1.1"
+    username: "admin"
+    password: "pass"
+    labels:
+      __param_target: "other"
+`,
+			expectError: true,
+			errorMsg:    "invalid label name",
+		},
 		{
 			name: "missing device name",
 			config: `
@@ -172,6 +207,32 @@ devices:
 			expectError: true,
 			errorMsg:    "invalid port",
 		},
+		{
+			name: "request interval too long",
+			config: `
+min_request_interval_ms: 5000
+devices:
+  - name: "test"
+    address: "192.168.1.1"
+    username: "admin"
+    password: "pass"
+`,
+			expectError: true,
+			errorMsg:    "min_request_interval_ms",
+		},
+		{
+			name: "negative scrape timeout offset",
+			config: `
+scrape_timeout_offset_ms: -1
+devices:
+  - name: "test"
+    address: "192.168.1.1"
+    username: "admin"
+    password: "pass"
+`,
+			expectError: true,
+			errorMsg:    "scrape_timeout_offset_ms",
+		},
 	}
 
 	for _, tt := range tests {
@@ -243,3 +304,1057 @@ devices:
 		t.Errorf("Expected overridden scrape timeout 20, got %d", cfg.ScrapeTimeout)
 	}
 }
+
+func TestPushConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		push        string
+		expectError bool
+	}{
+		{
+			name: "pushgateway with defaults",
+			push: `
+push:
+  pushgateway:
+    url: "http://pushgateway:9091"
+`,
+		},
+		{
+			name: "remote write",
+			push: `
+push:
+  interval: 60
+  remote_write:
+    url: "https://prometheus.example.com/api/v1/write"
+`,
+		},
+		{
+			name: "no targets",
+			push: `
+push:
+  interval: 60
+`,
+			expectError: true,
+		},
+		{
+			name: "relative url",
+			push: `
+push:
+  pushgateway:
+    url: "pushgateway:9091"
+`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `
+devices:
+  - name: "test"
+    address: "192.168.1.1"
+    username: "admin"
+    password: "pass"
+` + tt.push
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+
+			if cfg.Push.QueueSize != 10 {
+				t.Errorf("Expected default queue size 10, got %d", cfg.Push.QueueSize)
+			}
+			if cfg.Push.MaxRetries != 3 {
+				t.Errorf("Expected default max retries 3, got %d", cfg.Push.MaxRetries)
+			}
+			if cfg.Push.Pushgateway != nil && cfg.Push.Pushgateway.Job != "gocoax" {
+				t.Errorf("Expected default job 'gocoax', got %s", cfg.Push.Pushgateway.Job)
+			}
+		})
+	}
+}
+
+func TestOTLPConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		otlp        string
+		expectError bool
+	}{
+		{
+			name: "http with defaults",
+			otlp: `
+otlp:
+  url: "http://otel-collector:4318/v1/metrics"
+`,
+		},
+		{
+			name: "grpc",
+			otlp: `
+otlp:
+  protocol: "grpc"
+  url: "http://otel-collector:4317"
+`,
+		},
+		{
+			name: "unknown protocol",
+			otlp: `
+otlp:
+  protocol: "udp"
+  url: "http://otel-collector:4317"
+`,
+			expectError: true,
+		},
+		{
+			name: "missing url",
+			otlp: `
+otlp:
+  protocol: "http"
+`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `
+devices:
+  - name: "test"
+    address: "192.168.1.1"
+    username: "admin"
+    password: "pass"
+` + tt.otlp
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+
+			if cfg.OTLP.Interval != 30 {
+				t.Errorf("Expected default interval 30, got %d", cfg.OTLP.Interval)
+			}
+		})
+	}
+}
+
+func TestInfluxDBConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		influxdb    string
+		expectError bool
+	}{
+		{
+			name: "valid with defaults",
+			influxdb: `
+influxdb:
+  url: "http://influxdb:8086"
+  org: "home"
+  bucket: "moca"
+`,
+		},
+		{
+			name: "missing bucket",
+			influxdb: `
+influxdb:
+  url: "http://influxdb:8086"
+  org: "home"
+`,
+			expectError: true,
+		},
+		{
+			name: "invalid url",
+			influxdb: `
+influxdb:
+  url: "influxdb:8086"
+  org: "home"
+  bucket: "moca"
+`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `
+devices:
+  - name: "test"
+    address: "192.168.1.1"
+    username: "admin"
+    password: "pass"
+` + tt.influxdb
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if cfg.InfluxDB.Interval != 30 {
+				t.Errorf("Expected default interval 30, got %d", cfg.InfluxDB.Interval)
+			}
+		})
+	}
+}
+
+func TestMQTTConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		mqtt        string
+		expectError bool
+	}{
+		{
+			name: "valid with defaults",
+			mqtt: `
+mqtt:
+  broker: "tcp://mqtt:1883"
+`,
+		},
+		{
+			name: "missing broker",
+			mqtt: `
+mqtt:
+  username: "gocoax"
+`,
+			expectError: true,
+		},
+		{
+			name: "unsupported scheme",
+			mqtt: `
+mqtt:
+  broker: "http://mqtt:1883"
+`,
+			expectError: true,
+		},
+		{
+			name: "wildcard in prefix",
+			mqtt: `
+mqtt:
+  broker: "tcp://mqtt:1883"
+  topic_prefix: "gocoax/#"
+`,
+			expectError: true,
+		},
+		{
+			name: "invalid qos",
+			mqtt: `
+mqtt:
+  broker: "tcp://mqtt:1883"
+  qos: 3
+`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `
+devices:
+  - name: "test"
+    address: "192.168.1.1"
+    username: "admin"
+    password: "pass"
+` + tt.mqtt
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if cfg.MQTT.TopicPrefix != "gocoax" || cfg.MQTT.DiscoveryPrefix != "homeassistant" {
+				t.Errorf("Unexpected default prefixes %q, %q", cfg.MQTT.TopicPrefix, cfg.MQTT.DiscoveryPrefix)
+			}
+			if cfg.MQTT.ClientID != "gocoax-exporter" || cfg.MQTT.Interval != 30 {
+				t.Errorf("Unexpected defaults: client_id %q, interval %d", cfg.MQTT.ClientID, cfg.MQTT.Interval)
+			}
+		})
+	}
+}
+
+func TestAdminConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		admin       string
+		env         string
+		expectError bool
+	}{
+		{
+			name: "admin with password",
+			admin: `
+admin:
+  username: "admin"
+  password: "secret"
+`,
+		},
+		{
+			name: "admin password from environment",
+			admin: `
+admin:
+  username: "admin"
+`,
+			env: "secret",
+		},
+		{
+			name: "admin without password",
+			admin: `
+admin:
+  username: "admin"
+`,
+			expectError: true,
+		},
+		{
+			name: "admin without username",
+			admin: `
+admin:
+  password: "secret"
+`,
+			expectError: true,
+		},
+		{
+			name: "auto reboot with defaults",
+			admin: `
+auto_reboot: {}
+`,
+		},
+		{
+			name: "auto reboot interval too short",
+			admin: `
+auto_reboot:
+  min_interval: 10
+`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GOCOAX_ADMIN_PASSWORD", tt.env)
+
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `
+devices:
+  - name: "test"
+    address: "192.168.1.1"
+    username: "admin"
+    password: "pass"
+` + tt.admin
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if cfg.AutoReboot != nil && (cfg.AutoReboot.FailureThreshold != 5 || cfg.AutoReboot.MinInterval != 3600) {
+				t.Errorf("Unexpected auto_reboot defaults: %+v", cfg.AutoReboot)
+			}
+		})
+	}
+}
+
+func TestDiscoveryConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectError bool
+	}{
+		{
+			name: "discovery without devices",
+			content: `
+discovery:
+  cidrs: ["192.168.98.0/24"]
+`,
+		},
+		{
+			name: "discovery alongside devices",
+			content: `
+devices:
+  - name: "test"
+    address: "192.168.1.1"
+    username: "admin"
+    password: "pass"
+discovery:
+  cidrs: ["192.168.98.0/24", "fd00::/120"]
+  workers: 4
+`,
+		},
+		{
+			name: "no cidrs",
+			content: `
+discovery: {}
+`,
+			expectError: true,
+		},
+		{
+			name: "invalid cidr",
+			content: `
+discovery:
+  cidrs: ["192.168.98.0"]
+`,
+			expectError: true,
+		},
+		{
+			name: "range too large",
+			content: `
+discovery:
+  cidrs: ["10.0.0.0/8"]
+`,
+			expectError: true,
+		},
+		{
+			name: "interval too short",
+			content: `
+discovery:
+  cidrs: ["192.168.98.0/24"]
+  interval: 1
+`,
+			expectError: true,
+		},
+		{
+			name: "negative max missed scans",
+			content: `
+discovery:
+  cidrs: ["192.168.98.0/24"]
+  max_missed_scans: -1
+`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			d := cfg.Discovery
+			if d.Interval != 300 || d.Port != 80 || d.Username != "admin" || d.Password != "gocoax" || d.MaxMissedScans != 3 {
+				t.Errorf("Unexpected discovery defaults: %+v", d)
+			}
+			if d.Workers == 0 {
+				t.Error("Expected workers to be set")
+			}
+		})
+	}
+}
+
+func TestServiceDiscoveryConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectError bool
+	}{
+		{
+			name: "file only",
+			content: `
+service_discovery:
+  file: "/tmp/gocoax.json"
+`,
+		},
+		{
+			name: "with exporter address",
+			content: `
+service_discovery:
+  file: "/tmp/gocoax.json"
+  exporter_address: "exporter:9090"
+`,
+		},
+		{
+			name: "missing file",
+			content: `
+service_discovery:
+  exporter_address: "exporter:9090"
+`,
+			expectError: true,
+		},
+		{
+			name: "exporter address without port",
+			content: `
+service_discovery:
+  file: "/tmp/gocoax.json"
+  exporter_address: "exporter"
+`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			configContent := `
+devices:
+  - name: "test"
+    address: "192.168.1.1"
+    username: "admin"
+    password: "pass"
+    labels:
+      room: "office"
+` + tt.content
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if cfg.ServiceDiscovery.Interval != 60 {
+				t.Errorf("Expected default interval 60, got %d", cfg.ServiceDiscovery.Interval)
+			}
+			if cfg.Devices[0].Labels["room"] != "office" {
+				t.Errorf("Expected device labels to be loaded, got %v", cfg.Devices[0].Labels)
+			}
+		})
+	}
+}
+
+func TestHistoryConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		history     string
+		expectError bool
+	}{
+		{name: "defaults", history: "history:\n  path: \"/tmp/history.db\"\n"},
+		{name: "missing path", history: "history: {}\n", expectError: true},
+		{name: "interval too short", history: "history:\n  path: \"/tmp/history.db\"\n  interval: 1\n", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			configContent := `
+devices:
+  - name: "test"
+    address: "192.168.1.1"
+    username: "admin"
+    password: "pass"
+` + tt.history
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if cfg.History.Interval != 60 || cfg.History.RetentionDays != 30 {
+				t.Errorf("Unexpected history defaults: %+v", cfg.History)
+			}
+		})
+	}
+}
+
+func TestEventsConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		events      string
+		expectError bool
+	}{
+		{name: "defaults", events: "events: {}\n"},
+		{name: "invalid webhook", events: "events:\n  webhook_url: \"not a url\"\n", expectError: true},
+		{name: "negative step", events: "events:\n  step_change_percent: -5\n", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			configContent := `
+devices:
+  - name: "test"
+    address: "192.168.1.1"
+    username: "admin"
+    password: "pass"
+` + tt.events
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if cfg.Events.StepChangePercent != 25 || cfg.Events.BufferSize != 1000 {
+				t.Errorf("Unexpected events defaults: %+v", cfg.Events)
+			}
+		})
+	}
+}
+
+func TestAlertingConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		alerting    string
+		expectError bool
+	}{
+		{name: "defaults", alerting: `
+alerting:
+  rules:
+    - name: down
+      type: device_down
+  webhooks:
+    - url: "http://localhost:8080/hook"
+`},
+		{name: "missing webhook", alerting: `
+alerting:
+  rules:
+    - name: down
+      type: device_down
+`, expectError: true},
+		{name: "unknown rule type", alerting: `
+alerting:
+  rules:
+    - name: down
+      type: device_slow
+  webhooks:
+    - url: "http://localhost:8080/hook"
+`, expectError: true},
+		{name: "link without threshold", alerting: `
+alerting:
+  rules:
+    - name: slow
+      type: link_below
+  webhooks:
+    - url: "http://localhost:8080/hook"
+`, expectError: true},
+		{name: "duplicate rule", alerting: `
+alerting:
+  rules:
+    - name: down
+      type: device_down
+    - name: down
+      type: node_count_changed
+  webhooks:
+    - url: "http://localhost:8080/hook"
+`, expectError: true},
+		{name: "too many expected nodes", alerting: `
+alerting:
+  rules:
+    - name: nodes
+      type: node_count_changed
+      expected_nodes: 17
+  webhooks:
+    - url: "http://localhost:8080/hook"
+`, expectError: true},
+		{name: "unknown format", alerting: `
+alerting:
+  rules:
+    - name: down
+      type: device_down
+  webhooks:
+    - url: "http://localhost:8080/hook"
+      format: teams
+`, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			configContent := `
+devices:
+  - name: "test"
+    address: "192.168.1.1"
+    username: "admin"
+    password: "pass"
+` + tt.alerting
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			a := cfg.Alerting
+			if a.Interval != 60 || a.RepeatInterval != 14400 || a.Rules[0].Polls != 3 || a.Webhooks[0].Format != "generic" {
+				t.Errorf("Unexpected alerting defaults: %+v", a)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		breaker     string
+		expectError bool
+	}{
+		{name: "defaults", breaker: "circuit_breaker: {}\n"},
+		{name: "max below initial", breaker: "circuit_breaker:\n  initial_backoff: 60\n  max_backoff: 30\n", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			configContent := `
+devices:
+  - name: "test"
+    address: "192.168.1.1"
+    username: "admin"
+    password: "pass"
+` + tt.breaker
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			b := cfg.CircuitBreaker
+			if b.FailureThreshold != 3 || b.InitialBackoff != 30 || b.MaxBackoff != 600 {
+				t.Errorf("Unexpected circuit breaker defaults: %+v", b)
+			}
+		})
+	}
+}
+
+func TestCustomMetricsConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		custom   string
+		errorMsg string // empty when valid
+	}{
+		{
+			name: "defaults",
+			custom: `
+  - endpoint: /ms/0/0x14
+    metrics:
+      - name: gocoax_custom_word
+        word: 3
+`,
+		},
+		{
+			name: "repeated name with other labels",
+			custom: `
+  - endpoint: /ms/0/0x14
+    data: [1]
+    metrics:
+      - name: gocoax_custom_snr
+        word: 0
+        mask: 0xFF
+        labels: {channel: "0"}
+      - name: gocoax_custom_snr
+        word: 0
+        mask: 0xFF00
+        shift: 8
+        labels: {channel: "1"}
+`,
+		},
+		{
+			name: "write endpoint",
+			custom: `
+  - endpoint: /ms/1/0xb00
+    metrics:
+      - name: gocoax_custom_reboot
+`,
+			errorMsg: "not a /ms/0/0x<id> endpoint",
+		},
+		{
+			name: "duplicate series",
+			custom: `
+  - endpoint: /ms/0/0x14
+    metrics:
+      - name: gocoax_custom_word
+        word: 0
+      - name: gocoax_custom_word
+        word: 1
+`,
+			errorMsg: "duplicate metric",
+		},
+		{
+			name: "repeated name with other type",
+			custom: `
+  - endpoint: /ms/0/0x14
+    metrics:
+      - name: gocoax_custom_word
+        labels: {word: "0"}
+      - name: gocoax_custom_word
+        type: counter
+        labels: {word: "1"}
+`,
+			errorMsg: "different help, type or label names",
+		},
+		{
+			name: "device label",
+			custom: `
+  - endpoint: /ms/0/0x14
+    metrics:
+      - name: gocoax_custom_word
+        labels: {device: "x"}
+`,
+			errorMsg: "invalid label name",
+		},
+		{
+			name: "reserved name",
+			custom: `
+  - endpoint: /ms/0/0x15
+    metrics:
+      - name: gocoax_node_count
+`,
+			errorMsg: "reserved",
+		},
+		{
+			name: "other prefix",
+			custom: `
+  - endpoint: /ms/0/0x15
+    metrics:
+      - name: moca_node_count
+`,
+		},
+		{
+			name: "shift too large",
+			custom: `
+  - endpoint: /ms/0/0x14
+    metrics:
+      - name: gocoax_custom_word
+        shift: 32
+`,
+			errorMsg: "shift",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			configContent := `
+devices:
+  - name: "test"
+    address: "192.168.1.1"
+    username: "admin"
+    password: "pass"
+custom_metrics:` + tt.custom
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Errorf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			metric := cfg.CustomMetrics[0].Metrics[0]
+			if metric.Type != CustomGauge || metric.Help == "" {
+				t.Errorf("Expected a gauge with default help, got %+v", metric)
+			}
+			if tt.name == "defaults" && metric.Mask != 0xFFFFFFFF {
+				t.Errorf("Expected all bits by default, got mask %#x", metric.Mask)
+			}
+		})
+	}
+}
+
+func TestAuthConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		auth       string
+		wantMethod string
+		errorMsg   string // empty when valid
+	}{
+		{name: "default method", auth: "    auth: {}\n", wantMethod: AuthBasic},
+		{name: "form", auth: "    auth:\n      method: form\n      login_path: /cgi-bin/login\n", wantMethod: AuthForm},
+		{name: "auto", auth: "    auth:\n      method: auto\n", wantMethod: AuthAuto},
+		{name: "unknown method", auth: "    auth:\n      method: digest\n", errorMsg: "method must be"},
+		{name: "relative path", auth: "    auth:\n      method: challenge\n      challenge_path: challenge.cgi\n", errorMsg: "must start with /"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			configContent := `
+devices:
+  - name: "test"
+    address: "192.168.1.1"
+    username: "admin"
+    password: "pass"
+` + tt.auth
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Errorf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := cfg.Devices[0].Auth.Method; got != tt.wantMethod {
+				t.Errorf("Expected method %q, got %q", tt.wantMethod, got)
+			}
+		})
+	}
+}
+
+func TestProfilesConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  string // profile of the device
+		profiles string
+		errorMsg string // empty when valid
+	}{
+		{name: "default", profile: ""},
+		{name: "built-in", profile: "gocoax"},
+		{
+			name:    "configured",
+			profile: "screenbeam",
+			profiles: `
+profiles:
+  - name: screenbeam
+    session_path: /main.html
+    csrf_cookies: [sb_csrf]
+    auth: {method: form}
+    endpoints: {local_info: /ms/0/0x25, reboot: /ms/1/0xc00}
+    local_info: {node_bitmask: 13}
+    node_info: {moca_version: 5}
+`,
+		},
+		{name: "unknown profile", profile: "motorola", errorMsg: `unknown profile "motorola"`},
+		{name: "built-in name", profiles: "profiles:\n  - name: gocoax\n", errorMsg: "already used"},
+		{name: "unknown endpoint", profiles: "profiles:\n  - name: p\n    endpoints: {phy: /ms/0/0x1}\n", errorMsg: `unknown endpoint "phy"`},
+		{name: "write endpoint", profiles: "profiles:\n  - name: p\n    endpoints: {status: /ms/1/0x14}\n", errorMsg: "must be a /ms/0/0x<id> call"},
+		{name: "read reboot", profiles: "profiles:\n  - name: p\n    endpoints: {reboot: /ms/0/0xb00}\n", errorMsg: "must be a /ms/1/0x<id> call"},
+		{name: "unknown field", profiles: "profiles:\n  - name: p\n    node_info: {mac: 0}\n", errorMsg: `unknown field "mac"`},
+		{name: "offset out of range", profiles: "profiles:\n  - name: p\n    local_info: {nc_node_id: 256}\n", errorMsg: "from 0 to 255"},
+		{name: "invalid auth", profiles: "profiles:\n  - name: p\n    auth: {method: digest}\n", errorMsg: "method must be"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			configContent := `
+devices:
+  - name: "test"
+    address: "192.168.1.1"
+    username: "admin"
+    password: "pass"
+    profile: "` + tt.profile + `"
+` + tt.profiles
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Errorf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if p := cfg.GetProfile(tt.profile); (p != nil) != (tt.profiles != "") {
+				t.Errorf("Unexpected profile %+v for %q", p, tt.profile)
+			}
+		})
+	}
+}
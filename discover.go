@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/client"
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/louispool/gocoax-exporter/config"
+	"github.com/louispool/gocoax-exporter/discovery"
+)
+
+// runDiscover implements the discover command, which scans address ranges for goCoax
+// adapters and prints what it finds
+func runDiscover(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("discover", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	cidrs := fs.String("cidr", "", "Comma-separated address ranges to scan, e.g. 192.168.98.0/24")
+	port := fs.Int("port", 80, "HTTP port of the adapters")
+	workers := fs.Int("workers", 32, "Hosts probed concurrently")
+	username := fs.String("username", "admin", "Adapter username")
+	password := fs.String("password", "gocoax", "Adapter password")
+	timeout := fs.Duration("timeout", 2*time.Second, "Timeout per request")
+	output := fs.String("output", "table", "Output format: table or json")
+	verbose := fs.Bool("verbose", false, "Print the requests to each host to stderr")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg := &config.DiscoveryConfig{
+		Interval: 300,
+		Port:     *port,
+		Workers:  *workers,
+		Username: *username,
+		Password: *password,
+	}
+	for _, cidr := range strings.Split(*cidrs, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr != "" {
+			cfg.CIDRs = append(cfg.CIDRs, cidr)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(stderr, "discover: %v\n", err)
+		return 2
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(stderr, "discover: output must be table or json\n")
+		return 2
+	}
+
+	// The client's debug output is discarded unless -verbose is set
+	if *verbose {
+		client.DebugOutput = stderr
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	devices, err := discovery.NewScanner(cfg, *timeout).Scan(ctx)
+	if err != nil {
+		fmt.Fprintf(stderr, "discover: %v\n", err)
+		return 1
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(devices)
+		return 0
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ADDRESS\tNAME\tNODE\tNC\tMOCA\tMAC")
+	for _, d := range devices {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n", d.Address, collector.DiscoveredDeviceName(d.Address),
+			d.NodeID, d.NCNodeID, collector.FormatMocaVersion(d.MocaVersion), d.MAC)
+	}
+	tw.Flush()
+	fmt.Fprintf(stderr, "Found %d device(s)\n", len(devices))
+
+	return 0
+}
@@ -0,0 +1,234 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/client"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// phyRatesSignature are strings every goCoax phyRates.html contains: the forms the
+// page posts to read local info and the FMR results
+var phyRatesSignature = [][]byte{
+	[]byte(`action="/ms/0/0x15"`),
+	[]byte(`action="/ms/0/0x1D"`),
+}
+
+// Largest phyRates.html read while probing
+const maxPageSize = 1 << 20
+
+// Device is a goCoax adapter found by a scan, identified by its address. MAC is what
+// the adapter's node info holds at the profile's MAC offsets, which have not been
+// confirmed on a real adapter; it is shown for reference only.
+type Device struct {
+	MAC         string `json:"mac"`
+	Address     string `json:"address"` // host:port
+	NodeID      int    `json:"node_id"`
+	NCNodeID    int    `json:"nc_node_id"`
+	MocaVersion int    `json:"moca_version"`
+}
+
+// Scanner probes address ranges for goCoax adapters
+type Scanner struct {
+	cfg        *config.DiscoveryConfig
+	timeout    time.Duration
+	httpClient *http.Client
+}
+
+// NewScanner creates a scanner for the configured ranges. The timeout applies to each
+// request to a host.
+func NewScanner(cfg *config.DiscoveryConfig, timeout time.Duration) *Scanner {
+	return &Scanner{
+		cfg:        cfg,
+		timeout:    timeout,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// Run scans the configured ranges every interval and calls found with the adapters of
+// each completed scan, until ctx is cancelled. Addresses known returns at the start of
+// a scan are not probed, so adapters already being scraped are not logged in to again.
+func (s *Scanner) Run(ctx context.Context, known func(context.Context) map[string]bool, found func([]Device)) {
+	ticker := time.NewTicker(s.cfg.GetInterval())
+	defer ticker.Stop()
+
+	for {
+		hosts, err := s.hosts()
+		if err == nil {
+			skip := known(ctx)
+			hosts = slices.DeleteFunc(hosts, func(h string) bool { return skip[h] })
+		}
+		switch {
+		case err != nil:
+			log.Printf("Error scanning for devices: %v", err)
+		default:
+			devices := s.ScanHosts(ctx, hosts)
+			if ctx.Err() == nil {
+				found(devices)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan probes every host in the configured ranges
+func (s *Scanner) Scan(ctx context.Context) ([]Device, error) {
+	hosts, err := s.hosts()
+	if err != nil {
+		return nil, err
+	}
+	return s.ScanHosts(ctx, hosts), nil
+}
+
+// hosts returns the addresses in the configured ranges
+func (s *Scanner) hosts() ([]string, error) {
+	var hosts []string
+	for _, cidr := range s.cfg.CIDRs {
+		h, err := Hosts(cidr, s.cfg.Port)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, h...)
+	}
+	return hosts, nil
+}
+
+// ScanHosts probes the given host:port addresses with a bounded worker pool. Adapters
+// are returned in the order of hosts; an address listed twice is probed once.
+func (s *Scanner) ScanHosts(ctx context.Context, hosts []string) []Device {
+	seen := make(map[string]bool, len(hosts))
+	hosts = slices.DeleteFunc(slices.Clone(hosts), func(h string) bool {
+		dup := seen[h]
+		seen[h] = true
+		return dup
+	})
+
+	queue := make(chan int)
+	found := make([]*Device, len(hosts))
+	var wg sync.WaitGroup
+
+	for i := 0; i < min(s.cfg.Workers, len(hosts)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if d, err := s.Probe(ctx, hosts[i]); err == nil {
+					found[i] = d
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := range hosts {
+		select {
+		case queue <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	var devices []Device
+	for _, d := range found {
+		if d != nil {
+			devices = append(devices, *d)
+		}
+	}
+	return devices
+}
+
+// Probe checks whether a goCoax adapter answers at address and reads its identity
+func (s *Scanner) Probe(ctx context.Context, address string) (*Device, error) {
+	if err := s.checkSignature(ctx, address); err != nil {
+		return nil, err
+	}
+
+	c, err := client.New(ctx, address, client.WithCredentials(s.cfg.Username, s.cfg.Password), client.WithTimeout(s.timeout))
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	localInfo, err := c.GetLocalInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodeInfo, err := c.GetNetworkNodeInfo(ctx, localInfo.MyNodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Device{
+		MAC:         nodeInfo.MACAddress,
+		Address:     address,
+		NodeID:      localInfo.MyNodeID,
+		NCNodeID:    localInfo.NCNodeID,
+		MocaVersion: nodeInfo.MocaVersion,
+	}, nil
+}
+
+// checkSignature fetches phyRates.html and checks that it is the goCoax page
+func (s *Scanner) checkSignature(ctx context.Context, address string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("http://%s/phyRates.html", address), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return err
+	}
+	for _, sig := range phyRatesSignature {
+		if !bytes.Contains(page, sig) {
+			return fmt.Errorf("not a goCoax adapter")
+		}
+	}
+	return nil
+}
+
+// Hosts returns the host:port addresses to probe in a CIDR range. The network and
+// broadcast addresses of IPv4 ranges larger than /31 are left out.
+func Hosts(cidr string, port int) ([]string, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cidr %q: %w", cidr, err)
+	}
+	prefix = prefix.Masked()
+
+	var hosts []string
+	for addr := prefix.Addr(); addr.IsValid() && prefix.Contains(addr); addr = addr.Next() {
+		hosts = append(hosts, netip.AddrPortFrom(addr, uint16(port)).String())
+	}
+
+	if prefix.Addr().Is4() && prefix.Bits() < 31 {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+	return hosts, nil
+}
@@ -0,0 +1,226 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// phyRatesPage is the part of phyRates.html the scanner looks for
+const phyRatesPage = `<html><head><title>PHY Rates</title></head><body>
+<form name="localInfo" method="post" action="/ms/0/0x15"></form>
+<form name="netInfo" method="post" action="/ms/0/0x16" value="0"></form>
+<form name="fmrInfo" method="post" action="/ms/0/0x1D"></form>
+</body></html>`
+
+// newAdapter starts an httptest server standing in for a goCoax adapter with the
+// given node ID, answering to admin/gocoax
+func newAdapter(t *testing.T, nodeID int) string {
+	t.Helper()
+
+	requireAuth := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "gocoax" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/phyRates.html", requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, phyRatesPage)
+	}))
+	mux.HandleFunc("/ms/0/0x15", requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		words := make([]string, 13)
+		for i := range words {
+			words[i] = `"0x00000000"`
+		}
+		words[0] = fmt.Sprintf(`"0x%08X"`, nodeID)
+		words[12] = fmt.Sprintf(`"0x%08X"`, 1<<nodeID)
+		fmt.Fprintf(w, `{"data":[%s]}`, strings.Join(words, ","))
+	}))
+	mux.HandleFunc("/ms/0/0x16", requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"data":["0x0012AB%02X","0xCD%02X0000","0x00000000","0x00000000","0x00000025"]}`, nodeID, nodeID)
+	}))
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// newOtherServer starts a web server that is not a goCoax adapter
+func newOtherServer(t *testing.T, status int, body string) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func newTestScanner(workers int) *Scanner {
+	return NewScanner(&config.DiscoveryConfig{
+		Port:     80,
+		Workers:  workers,
+		Username: "admin",
+		Password: "gocoax",
+	}, 2*time.Second)
+}
+
+func TestProbe(t *testing.T) {
+	s := newTestScanner(1)
+	address := newAdapter(t, 2)
+
+	d, err := s.Probe(context.Background(), address)
+	if err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	expected := Device{MAC: "00:12:ab:02:cd:02", Address: address, NodeID: 2, MocaVersion: 0x25}
+	if *d != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *d)
+	}
+
+	for name, other := range map[string]string{
+		"other web server": newOtherServer(t, http.StatusOK, "<html>router login</html>"),
+		"unauthorized":     newOtherServer(t, http.StatusUnauthorized, phyRatesPage),
+		"nothing listening": func() string {
+			server := httptest.NewServer(http.NotFoundHandler())
+			server.Close()
+			return strings.TrimPrefix(server.URL, "http://")
+		}(),
+	} {
+		if _, err := s.Probe(context.Background(), other); err == nil {
+			t.Errorf("%s: expected probe to fail", name)
+		}
+	}
+}
+
+func TestScanHosts(t *testing.T) {
+	s := newTestScanner(3)
+
+	first := newAdapter(t, 0)
+	second := newAdapter(t, 1)
+	hosts := []string{
+		second,
+		newOtherServer(t, http.StatusOK, "hello"),
+		first,
+		newOtherServer(t, http.StatusNotFound, ""),
+		first, // listed twice
+	}
+
+	devices := s.ScanHosts(context.Background(), hosts)
+	if len(devices) != 2 {
+		t.Fatalf("Expected 2 devices, got %d: %+v", len(devices), devices)
+	}
+	if devices[0].Address != second || devices[0].MAC != "00:12:ab:01:cd:01" {
+		t.Errorf("Unexpected first device: %+v", devices[0])
+	}
+	if devices[1].Address != first || devices[1].MAC != "00:12:ab:00:cd:00" {
+		t.Errorf("Unexpected second device: %+v", devices[1])
+	}
+}
+
+func TestScanCIDR(t *testing.T) {
+	address := newAdapter(t, 0)
+	var port int
+	fmt.Sscanf(address[strings.LastIndex(address, ":")+1:], "%d", &port)
+
+	s := newTestScanner(4)
+	s.cfg.CIDRs = []string{"127.0.0.1/32"}
+	s.cfg.Port = port
+
+	devices, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(devices) != 1 || devices[0].Address != address {
+		t.Errorf("Expected the adapter at %s, got %+v", address, devices)
+	}
+}
+
+func TestRunSkipsKnownAddresses(t *testing.T) {
+	address := newAdapter(t, 0)
+	var port int
+	fmt.Sscanf(address[strings.LastIndex(address, ":")+1:], "%d", &port)
+
+	s := newTestScanner(2)
+	s.cfg.CIDRs = []string{"127.0.0.1/32"}
+	s.cfg.Port = port
+	s.cfg.Interval = 300
+
+	tests := []struct {
+		name     string
+		known    map[string]bool
+		expected int
+	}{
+		{"unknown adapter", map[string]bool{}, 1},
+		{"known adapter", map[string]bool{address: true}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var got []Device
+			s.Run(ctx, func(context.Context) map[string]bool { return tt.known }, func(devices []Device) {
+				got = devices
+				cancel()
+			})
+			if len(got) != tt.expected {
+				t.Errorf("Expected %d devices, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestScanCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s := newTestScanner(2)
+	if devices := s.ScanHosts(ctx, []string{newAdapter(t, 0), newAdapter(t, 1)}); len(devices) != 0 {
+		t.Errorf("Expected no devices from a cancelled scan, got %+v", devices)
+	}
+}
+
+func TestHosts(t *testing.T) {
+	tests := []struct {
+		cidr     string
+		expected []string
+	}{
+		{"192.168.98.0/30", []string{"192.168.98.1:80", "192.168.98.2:80"}},
+		{"192.168.98.7/30", []string{"192.168.98.5:80", "192.168.98.6:80"}},
+		{"192.168.98.50/32", []string{"192.168.98.50:80"}},
+		{"192.168.98.50/31", []string{"192.168.98.50:80", "192.168.98.51:80"}},
+		{"fd00::/127", []string{"[fd00::]:80", "[fd00::1]:80"}},
+	}
+
+	for _, tt := range tests {
+		got, err := Hosts(tt.cidr, 80)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.cidr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.cidr, tt.expected, got)
+		}
+	}
+
+	if got, _ := Hosts("192.168.98.0/24", 80); len(got) != 254 {
+		t.Errorf("Expected 254 hosts in a /24, got %d", len(got))
+	}
+	if _, err := Hosts("192.168.98.0", 80); err == nil {
+		t.Error("Expected error for an address without prefix length")
+	}
+}
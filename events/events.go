@@ -0,0 +1,273 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// Event log limits; the buffer size applies without an events section
+const (
+	defaultBufferSize = 1000
+	defaultLimit      = 100
+	webhookQueueSize  = 100
+	webhookTimeout    = 10 * time.Second
+)
+
+// Log keeps the most recent events in memory and writes every event to the
+// configured file and webhook
+type Log struct {
+	mu     sync.Mutex
+	buf    []collector.Event // ring buffer
+	next   int               // index of the next write
+	filled bool              // the buffer has wrapped
+
+	file    io.WriteCloser // nil without a file
+	webhook *webhook       // nil without a webhook
+}
+
+// NewLog creates a log keeping up to size events in memory, without outputs
+func NewLog(size int) *Log {
+	return &Log{buf: make([]collector.Event, size)}
+}
+
+// Open creates a log with the outputs in cfg, which may be nil
+func Open(cfg *config.EventsConfig) (*Log, error) {
+	if cfg == nil {
+		return NewLog(defaultBufferSize), nil
+	}
+
+	l := NewLog(cfg.BufferSize)
+	if cfg.File != "" {
+		f, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open event log: %w", err)
+		}
+		l.file = f
+	}
+	if cfg.WebhookURL != "" {
+		l.webhook = newWebhook(cfg.WebhookURL)
+	}
+	return l, nil
+}
+
+// Record adds an event to the log and its outputs. Failures of the outputs are
+// logged.
+func (l *Log) Record(e collector.Event) {
+	log.Printf("Event on device %s: %s", e.Device, e.Message)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf[l.next] = e
+	l.next = (l.next + 1) % len(l.buf)
+	if l.next == 0 {
+		l.filled = true
+	}
+
+	if l.file != nil {
+		line, err := json.Marshal(e)
+		if err == nil {
+			_, err = l.file.Write(append(line, '\n'))
+		}
+		if err != nil {
+			log.Printf("Error writing event log: %v", err)
+		}
+	}
+	if l.webhook != nil {
+		l.webhook.enqueue(e)
+	}
+}
+
+// Filter selects events; zero fields match everything
+type Filter struct {
+	Device string
+	Type   collector.EventType
+	Since  time.Time
+	Limit  int // most recent events returned, 0 for all
+}
+
+// Events returns the events in memory matching the filter, oldest first
+func (l *Log) Events(f Filter) []collector.Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ordered := l.buf[:l.next]
+	if l.filled {
+		ordered = append(append([]collector.Event(nil), l.buf[l.next:]...), l.buf[:l.next]...)
+	}
+
+	matched := []collector.Event{}
+	for _, e := range ordered {
+		if (f.Device == "" || e.Device == f.Device) && (f.Type == "" || e.Type == f.Type) && !e.Time.Before(f.Since) {
+			matched = append(matched, e)
+		}
+	}
+	if f.Limit > 0 && len(matched) > f.Limit {
+		matched = matched[len(matched)-f.Limit:]
+	}
+	return matched
+}
+
+// Close stops the webhook after sending queued events and closes the file.
+// Events recorded afterwards are kept in memory only.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	webhook, file := l.webhook, l.file
+	l.webhook, l.file = nil, nil
+	l.mu.Unlock()
+
+	if webhook != nil {
+		webhook.close()
+	}
+	if file != nil {
+		return file.Close()
+	}
+	return nil
+}
+
+// Handler serves GET /api/v1/events. Parameters:
+//
+//	device  only events of this device
+//	type    only events of this type, e.g. node_left
+//	since   RFC 3339 or Unix time
+//	limit   most recent events returned (default 100)
+func Handler(l *Log) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		f := Filter{
+			Device: query.Get("device"),
+			Type:   collector.EventType(query.Get("type")),
+			Limit:  defaultLimit,
+		}
+
+		if f.Type != "" && !knownType(f.Type) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown event type %q", f.Type))
+			return
+		}
+		if v := query.Get("since"); v != "" {
+			since, err := parseTime(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			f.Since = since
+		}
+		if v := query.Get("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 1 {
+				writeError(w, http.StatusBadRequest, "limit must be a positive number")
+				return
+			}
+			f.Limit = limit
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"events": l.Events(f)})
+	})
+}
+
+// knownType reports whether t is one of the event types
+func knownType(t collector.EventType) bool {
+	for _, known := range collector.EventTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTime parses an RFC 3339 time or Unix time in seconds
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	seconds, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("since must be an RFC 3339 or Unix time")
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// webhook POSTs events as JSON from a queue, so a slow receiver does not hold up
+// scrapes. Events are dropped when the queue is full.
+type webhook struct {
+	url    string
+	client *http.Client
+	queue  chan collector.Event
+	done   chan struct{}
+}
+
+// newWebhook starts sending to url
+func newWebhook(url string) *webhook {
+	h := &webhook{
+		url:    url,
+		client: &http.Client{Timeout: webhookTimeout},
+		queue:  make(chan collector.Event, webhookQueueSize),
+		done:   make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+// enqueue queues an event for sending
+func (h *webhook) enqueue(e collector.Event) {
+	select {
+	case h.queue <- e:
+	default:
+		log.Printf("Event webhook queue full, dropping %s event of device %s", e.Type, e.Device)
+	}
+}
+
+// run sends queued events until the queue is closed
+func (h *webhook) run() {
+	defer close(h.done)
+	for e := range h.queue {
+		if err := h.send(e); err != nil {
+			log.Printf("Error sending event to webhook: %v", err)
+		}
+	}
+}
+
+// send POSTs one event
+func (h *webhook) send(e collector.Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Post(h.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// close stops accepting events and waits for the queue to drain
+func (h *webhook) close() {
+	close(h.queue)
+	<-h.done
+}
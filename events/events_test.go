@@ -0,0 +1,172 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+var t0 = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// testEvent returns an event i minutes after t0
+func testEvent(i int, device string, eventType collector.EventType) collector.Event {
+	return collector.Event{Time: t0.Add(time.Duration(i) * time.Minute), Device: device, Type: eventType, Message: "test"}
+}
+
+func TestLogWraps(t *testing.T) {
+	l := NewLog(3)
+	for i := 0; i < 5; i++ {
+		l.Record(testEvent(i, "bridge-50", collector.EventNodeLeft))
+	}
+
+	events := l.Events(Filter{})
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+	for i, e := range events {
+		if want := t0.Add(time.Duration(i+2) * time.Minute); !e.Time.Equal(want) {
+			t.Errorf("Event %d: expected time %v, got %v", i, want, e.Time)
+		}
+	}
+}
+
+func TestLogFilter(t *testing.T) {
+	l := NewLog(10)
+	l.Record(testEvent(0, "bridge-50", collector.EventNodeLeft))
+	l.Record(testEvent(1, "bridge-51", collector.EventNodeLeft))
+	l.Record(testEvent(2, "bridge-50", collector.EventNCChanged))
+	l.Record(testEvent(3, "bridge-50", collector.EventNodeLeft))
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected []int // minutes after t0
+	}{
+		{name: "all", filter: Filter{}, expected: []int{0, 1, 2, 3}},
+		{name: "device", filter: Filter{Device: "bridge-50"}, expected: []int{0, 2, 3}},
+		{name: "type", filter: Filter{Type: collector.EventNodeLeft}, expected: []int{0, 1, 3}},
+		{name: "since", filter: Filter{Since: t0.Add(2 * time.Minute)}, expected: []int{2, 3}},
+		{name: "limit", filter: Filter{Device: "bridge-50", Limit: 2}, expected: []int{2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := l.Events(tt.filter)
+			if len(events) != len(tt.expected) {
+				t.Fatalf("Expected %d events, got %d", len(tt.expected), len(events))
+			}
+			for i, e := range events {
+				if want := t0.Add(time.Duration(tt.expected[i]) * time.Minute); !e.Time.Equal(want) {
+					t.Errorf("Event %d: expected time %v, got %v", i, want, e.Time)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	l := NewLog(10)
+	l.Record(testEvent(0, "bridge-50", collector.EventNodeLeft))
+	l.Record(testEvent(1, "bridge-50", collector.EventNodeJoined))
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedCount  int
+	}{
+		{name: "all", query: "", expectedStatus: http.StatusOK, expectedCount: 2},
+		{name: "type", query: "?type=node_joined", expectedStatus: http.StatusOK, expectedCount: 1},
+		{name: "since unix", query: "?since=1735732860", expectedStatus: http.StatusOK, expectedCount: 1},
+		{name: "since rfc3339", query: "?since=2025-01-01T12:00:30Z", expectedStatus: http.StatusOK, expectedCount: 1},
+		{name: "limit", query: "?limit=1", expectedStatus: http.StatusOK, expectedCount: 1},
+		{name: "unknown device", query: "?device=other", expectedStatus: http.StatusOK, expectedCount: 0},
+		{name: "unknown type", query: "?type=reboot", expectedStatus: http.StatusBadRequest},
+		{name: "invalid since", query: "?since=yesterday", expectedStatus: http.StatusBadRequest},
+		{name: "invalid limit", query: "?limit=0", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Handler(l).ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/events"+tt.query, nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Events []collector.Event `json:"events"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(body.Events) != tt.expectedCount {
+				t.Errorf("Expected %d events, got %d", tt.expectedCount, len(body.Events))
+			}
+		})
+	}
+}
+
+func TestOutputs(t *testing.T) {
+	var mu sync.Mutex
+	var received []collector.Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e collector.Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("Failed to decode webhook body: %v", err)
+		}
+		mu.Lock()
+		received = append(received, e)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	l, err := Open(&config.EventsConfig{File: path, WebhookURL: server.URL, BufferSize: 10})
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	l.Record(testEvent(0, "bridge-50", collector.EventNodeLeft))
+	l.Record(testEvent(1, "bridge-50", collector.EventNodeJoined))
+	if err := l.Close(); err != nil {
+		t.Fatalf("Failed to close log: %v", err)
+	}
+
+	mu.Lock()
+	if len(received) != 2 || received[1].Type != collector.EventNodeJoined {
+		t.Errorf("Unexpected webhook events: %+v", received)
+	}
+	mu.Unlock()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open event file: %v", err)
+	}
+	defer f.Close()
+
+	var lines []collector.Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e collector.Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("Invalid event line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, e)
+	}
+	if len(lines) != 2 || lines[0].Type != collector.EventNodeLeft {
+		t.Errorf("Unexpected event file contents: %+v", lines)
+	}
+}
@@ -0,0 +1,288 @@
+package history
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// Range returned when the request gives no start time
+const defaultQueryRange = 24 * time.Hour
+
+// Recorder polls the devices and stores a record of each
+type Recorder struct {
+	cfg       *config.HistoryConfig
+	store     *Store
+	gatherers func() []collector.SnapshotGatherer // called on every poll
+	timeout   time.Duration
+}
+
+// NewRecorder creates a recorder polling the devices returned by gatherers into the
+// store. gatherers is called on every poll, so devices added later are recorded too.
+func NewRecorder(cfg *config.HistoryConfig, store *Store, gatherers func() []collector.SnapshotGatherer, timeout time.Duration) *Recorder {
+	return &Recorder{
+		cfg:       cfg,
+		store:     store,
+		gatherers: gatherers,
+		timeout:   timeout,
+	}
+}
+
+// Run records every interval and prunes old records until ctx is cancelled
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.GetInterval())
+	defer ticker.Stop()
+
+	for {
+		r.RecordOnce(ctx)
+		if _, err := r.store.Prune(); err != nil {
+			log.Printf("Error pruning history: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RecordOnce polls every device and stores the results. Devices that cannot be
+// reached and polls that skipped the PHY rates are not recorded.
+func (r *Recorder) RecordOnce(ctx context.Context) {
+	for _, g := range r.gatherers() {
+		gatherCtx, cancel := context.WithTimeout(ctx, r.timeout)
+		snapshot, err := g.Gather(gatherCtx)
+		cancel()
+		if err != nil {
+			log.Printf("Error polling device %s for history: %v", g.DeviceName(), err)
+			continue
+		}
+		if snapshot.Partial {
+			log.Printf("Skipping history of device %s, the poll returned no PHY rates", g.DeviceName())
+			continue
+		}
+
+		if err := r.store.Add(g.DeviceName(), RecordFromSnapshot(snapshot)); err != nil {
+			log.Printf("Error storing history for device %s: %v", g.DeviceName(), err)
+		}
+	}
+}
+
+// Link is a directed link between two nodes
+type Link struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// LinkPoint is the rate of one link at one poll. Rates are absent when the link was
+// not measured, e.g. because a node had left the network.
+type LinkPoint struct {
+	Time  time.Time `json:"time"`
+	NPER  *int      `json:"nper,omitempty"`
+	VLPER *int      `json:"vlper,omitempty"`
+}
+
+// Handler serves GET /api/v1/devices/{name}/history. Parameters:
+//
+//	from, to  RFC 3339, Unix time, or relative to now such as -7d or -90m;
+//	          defaults are the last 24 hours
+//	link      a link such as 0-3; without it whole records are returned
+//	format    json (default) or csv
+func Handler(store *Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		query := r.URL.Query()
+
+		now := time.Now()
+		to := now
+		if v := query.Get("to"); v != "" {
+			t, err := parseTime(v, now)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid to: %v", err))
+				return
+			}
+			to = t
+		}
+		from := to.Add(-defaultQueryRange)
+		if v := query.Get("from"); v != "" {
+			t, err := parseTime(v, now)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid from: %v", err))
+				return
+			}
+			from = t
+		}
+		if from.After(to) {
+			writeError(w, http.StatusBadRequest, "from must not be after to")
+			return
+		}
+
+		var link *Link
+		if v := query.Get("link"); v != "" {
+			l, err := parseLink(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid link: %v", err))
+				return
+			}
+			link = l
+		}
+
+		format := query.Get("format")
+		if format == "" {
+			format = "json"
+		}
+		if format != "json" && format != "csv" {
+			writeError(w, http.StatusBadRequest, "format must be json or csv")
+			return
+		}
+
+		records, found, err := store.Query(name, from, to)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("no history for device %q", name))
+			return
+		}
+
+		switch {
+		case format == "csv" && link != nil:
+			writeLinkCSV(w, LinkPoints(records, *link))
+		case format == "csv":
+			writeRecordsCSV(w, records)
+		case link != nil:
+			writeJSON(w, map[string]interface{}{"device": name, "link": link, "points": LinkPoints(records, *link)})
+		default:
+			writeJSON(w, map[string]interface{}{"device": name, "records": records})
+		}
+	})
+}
+
+// LinkPoints extracts the rates of one link from records
+func LinkPoints(records []Record, link Link) []LinkPoint {
+	points := make([]LinkPoint, 0, len(records))
+	for _, r := range records {
+		p := LinkPoint{Time: r.Time}
+		if rate, ok := r.NPER[link.From][link.To]; ok {
+			p.NPER = &rate
+		}
+		if rate, ok := r.VLPER[link.From][link.To]; ok {
+			p.VLPER = &rate
+		}
+		points = append(points, p)
+	}
+	return points
+}
+
+// parseTime parses an RFC 3339 time or Unix time in seconds, like the Prometheus API,
+// or a negative duration relative to now. Durations may use d for days.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if strings.HasPrefix(s, "-") && !strings.ContainsAny(s, ".") {
+		if days, ok := strings.CutSuffix(s, "d"); ok {
+			if n, err := strconv.Atoi(days); err == nil {
+				return now.AddDate(0, 0, n), nil
+			}
+		} else if d, err := time.ParseDuration(s); err == nil {
+			return now.Add(d), nil
+		}
+	}
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return time.Time{}, fmt.Errorf("%q is not an RFC 3339 or Unix time", s)
+	}
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*1e9)), nil
+}
+
+// parseLink parses a link such as "0-3"
+func parseLink(s string) (*Link, error) {
+	fromStr, toStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("%q is not of the form from-to", s)
+	}
+	from, err1 := strconv.Atoi(fromStr)
+	to, err2 := strconv.Atoi(toStr)
+	if err1 != nil || err2 != nil || from < 0 || to < 0 || from >= collector.MAX_NUM_NODES || to >= collector.MAX_NUM_NODES {
+		return nil, fmt.Errorf("%q must be two node IDs from 0 to %d", s, collector.MAX_NUM_NODES-1)
+	}
+	return &Link{From: from, To: to}, nil
+}
+
+// writeLinkCSV writes the points of one link as CSV, leaving missing rates empty
+func writeLinkCSV(w http.ResponseWriter, points []LinkPoint) {
+	w.Header().Set("Content-Type", "text/csv")
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "nper_mbps", "vlper_mbps"})
+	for _, p := range points {
+		cw.Write([]string{p.Time.UTC().Format(time.RFC3339), formatRate(p.NPER), formatRate(p.VLPER)})
+	}
+	cw.Flush()
+}
+
+// writeRecordsCSV writes one row per link and poll
+func writeRecordsCSV(w http.ResponseWriter, records []Record) {
+	w.Header().Set("Content-Type", "text/csv")
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "from_node", "to_node", "nper_mbps", "vlper_mbps"})
+	for _, r := range records {
+		timestamp := r.Time.UTC().Format(time.RFC3339)
+		for _, from := range sortedKeys(r.NPER) {
+			for _, to := range sortedKeys(r.NPER[from]) {
+				nper := r.NPER[from][to]
+				var vlper *int
+				if rate, ok := r.VLPER[from][to]; ok {
+					vlper = &rate
+				}
+				cw.Write([]string{timestamp, strconv.Itoa(from), strconv.Itoa(to), formatRate(&nper), formatRate(vlper)})
+			}
+		}
+	}
+	cw.Flush()
+}
+
+// formatRate formats an optional rate for CSV
+func formatRate(rate *int) string {
+	if rate == nil {
+		return ""
+	}
+	return strconv.Itoa(*rate)
+}
+
+// sortedKeys returns the keys of a map in ascending order
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,207 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/client"
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// fakeGatherer returns a fixed snapshot, or err if set
+type fakeGatherer struct {
+	name string
+	err  error
+}
+
+func (g *fakeGatherer) DeviceName() string { return g.name }
+
+func (g *fakeGatherer) Gather(ctx context.Context) (*collector.DeviceSnapshot, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	rates := collector.NewPHYRateMatrix()
+	rates.NPER[0] = map[int]int{1: 3000}
+	rates.NPER[1] = map[int]int{0: 3100}
+	return &collector.DeviceSnapshot{
+		Device:       g.name,
+		Time:         baseTime,
+		LocalInfo:    &client.LocalInfo{NCNodeID: 1},
+		NodeVersions: map[int]int{0: 0x25, 1: 0x20},
+		ActiveNodes:  []int{0, 1},
+		PHYRates:     rates,
+	}, nil
+}
+
+func TestRecordOnce(t *testing.T) {
+	store := newTestStore(t, 24*time.Hour)
+	gatherers := []collector.SnapshotGatherer{
+		&fakeGatherer{name: "bridge-50"},
+		&fakeGatherer{name: "bridge-53", err: errors.New("connection refused")},
+	}
+	recorder := NewRecorder(&config.HistoryConfig{Interval: 60}, store, func() []collector.SnapshotGatherer { return gatherers }, time.Second)
+
+	recorder.RecordOnce(context.Background())
+
+	records, found, err := store.Query("bridge-50", baseTime, baseTime)
+	if err != nil || !found || len(records) != 1 {
+		t.Fatalf("Expected one record for bridge-50, got %d (found=%v, err=%v)", len(records), found, err)
+	}
+	r := records[0]
+	if r.NCNodeID != 1 || r.Nodes[1] != 0x20 || r.NPER[1][0] != 3100 {
+		t.Errorf("Unexpected record: %+v", r)
+	}
+
+	if _, found, _ := store.Query("bridge-53", baseTime, baseTime); found {
+		t.Error("Expected no record for an unreachable device")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	store := newTestStore(t, 24*time.Hour)
+	for i := 0; i < 3; i++ {
+		r := testRecord(baseTime.Add(time.Duration(i)*time.Minute), 3000+i)
+		if i == 1 {
+			// Node 1 left the network
+			r = Record{Time: r.Time, Nodes: map[int]int{0: 0x25}, NPER: map[int]map[int]int{}, VLPER: map[int]map[int]int{}, GCD: map[int]int{}}
+		}
+		store.Add("bridge-50", r)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/v1/devices/{name}/history", Handler(store))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/devices/bridge-50/history?"+query, nil)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	rangeQuery := "from=2025-01-01T11:00:00Z&to=1735736400"
+
+	t.Run("link as JSON", func(t *testing.T) {
+		rec := get(rangeQuery + "&link=0-1")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Device string      `json:"device"`
+			Link   Link        `json:"link"`
+			Points []LinkPoint `json:"points"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Invalid response: %v", err)
+		}
+		if resp.Device != "bridge-50" || resp.Link != (Link{From: 0, To: 1}) || len(resp.Points) != 3 {
+			t.Fatalf("Unexpected response: %+v", resp)
+		}
+		if *resp.Points[0].NPER != 3000 || *resp.Points[0].VLPER != 2800 {
+			t.Errorf("Unexpected first point: %+v", resp.Points[0])
+		}
+		if resp.Points[1].NPER != nil {
+			t.Errorf("Expected no rate while node 1 was gone, got %d", *resp.Points[1].NPER)
+		}
+	})
+
+	t.Run("link as CSV", func(t *testing.T) {
+		rec := get(rangeQuery + "&link=0-1&format=csv")
+		expected := "time,nper_mbps,vlper_mbps\n" +
+			"2025-01-01T12:00:00Z,3000,2800\n" +
+			"2025-01-01T12:01:00Z,,\n" +
+			"2025-01-01T12:02:00Z,3002,2802\n"
+		if rec.Body.String() != expected {
+			t.Errorf("Expected:\n%s\ngot:\n%s", expected, rec.Body.String())
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "text/csv" {
+			t.Errorf("Expected text/csv, got %s", ct)
+		}
+	})
+
+	t.Run("records as CSV", func(t *testing.T) {
+		rec := get(rangeQuery + "&format=csv")
+		lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+		if len(lines) != 5 || lines[1] != "2025-01-01T12:00:00Z,0,1,3000,2800" || lines[2] != "2025-01-01T12:00:00Z,1,0,3100,2900" {
+			t.Errorf("Unexpected CSV:\n%s", rec.Body.String())
+		}
+	})
+
+	t.Run("records as JSON", func(t *testing.T) {
+		rec := get(rangeQuery)
+		var resp struct {
+			Records []Record `json:"records"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Invalid response: %v", err)
+		}
+		if len(resp.Records) != 3 || resp.Records[2].NPER[1][0] != 3102 {
+			t.Errorf("Unexpected records: %+v", resp.Records)
+		}
+	})
+
+	t.Run("relative range", func(t *testing.T) {
+		rec := get("from=-7d&link=0-1")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	errorTests := []struct {
+		name     string
+		path     string
+		expected int
+	}{
+		{"unknown device", "/api/v1/devices/nope/history", http.StatusNotFound},
+		{"invalid link", "/api/v1/devices/bridge-50/history?link=0-16", http.StatusBadRequest},
+		{"link without dash", "/api/v1/devices/bridge-50/history?link=3", http.StatusBadRequest},
+		{"invalid time", "/api/v1/devices/bridge-50/history?from=yesterday", http.StatusBadRequest},
+		{"from after to", "/api/v1/devices/bridge-50/history?from=1735736400&to=1735732800", http.StatusBadRequest},
+		{"invalid format", "/api/v1/devices/bridge-50/history?format=xml", http.StatusBadRequest},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+			if rec.Code != tt.expected {
+				t.Errorf("Expected %d, got %d: %s", tt.expected, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2025, 1, 8, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		input    string
+		expected time.Time
+	}{
+		{"2025-01-01T12:00:00Z", time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{"1735732800", time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{"1735732800.5", time.Date(2025, 1, 1, 12, 0, 0, 500000000, time.UTC)},
+		{"-7d", time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{"-90m", time.Date(2025, 1, 8, 10, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseTime(tt.input, now)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if !got.Equal(tt.expected) {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+
+	for _, input := range []string{"yesterday", "-xd", "7d", "NaN"} {
+		if _, err := parseTime(input, now); err == nil {
+			t.Errorf("%s: expected error", input)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/collector"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Record is the state of a device's MoCA network at one poll
+type Record struct {
+	Time     time.Time           `json:"time"`
+	NCNodeID int                 `json:"nc_node_id"`
+	Nodes    map[int]int         `json:"nodes"` // [nodeID] = MoCA version
+	NPER     map[int]map[int]int `json:"nper"`  // [fromNode][toNode] = rate in Mbps
+	VLPER    map[int]map[int]int `json:"vlper"` // [fromNode][toNode] = rate in Mbps
+	GCD      map[int]int         `json:"gcd"`   // [node] = rate in Mbps
+}
+
+// RecordFromSnapshot converts a device snapshot into a record
+func RecordFromSnapshot(s *collector.DeviceSnapshot) Record {
+	return Record{
+		Time:     s.Time,
+		NCNodeID: s.LocalInfo.NCNodeID,
+		Nodes:    s.NodeVersions,
+		NPER:     s.PHYRates.NPER,
+		VLPER:    s.PHYRates.VLPER,
+		GCD:      s.PHYRates.GCD,
+	}
+}
+
+// Store keeps records in a bbolt file, one bucket per device keyed by timestamp
+type Store struct {
+	db        *bolt.DB
+	retention time.Duration
+
+	now func() time.Time
+}
+
+// Open opens or creates the store at path. Records older than retention are removed
+// by Prune.
+func Open(path string, retention time.Duration) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history store: %w", err)
+	}
+	return &Store{db: db, retention: retention, now: time.Now}, nil
+}
+
+// timeKey encodes a time as a key that sorts chronologically
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+// Add stores a record for a device
+func (s *Store) Add(device string, r Record) error {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(device))
+		if err != nil {
+			return err
+		}
+		return b.Put(timeKey(r.Time), value)
+	})
+}
+
+// Query returns the records of a device in [from, to], oldest first. The boolean
+// reports whether the store holds any records for the device.
+func (s *Store) Query(device string, from, to time.Time) ([]Record, bool, error) {
+	records := []Record{}
+	found := false
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(device))
+		if b == nil {
+			return nil
+		}
+		found = true
+
+		end := timeKey(to)
+		c := b.Cursor()
+		for k, v := c.Seek(timeKey(from)); k != nil && bytes.Compare(k, end) <= 0; k, v = c.Next() {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("corrupt record in history store: %w", err)
+			}
+			records = append(records, r)
+		}
+		return nil
+	})
+
+	return records, found, err
+}
+
+// Prune removes records older than the retention period and returns how many were
+// removed
+func (s *Store) Prune() (int, error) {
+	cutoff := timeKey(s.now().Add(-s.retention))
+	removed := 0
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			c := b.Cursor()
+			for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = c.First() {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				removed++
+			}
+			return nil
+		})
+	})
+
+	return removed, err
+}
+
+// Close closes the store file
+func (s *Store) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,91 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestStore opens a store in a temporary directory
+func newTestStore(t *testing.T, retention time.Duration) *Store {
+	t.Helper()
+
+	store, err := Open(filepath.Join(t.TempDir(), "history.db"), retention)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// testRecord returns a record of a two-node network with the given rate on 0->1
+func testRecord(at time.Time, rate int) Record {
+	return Record{
+		Time:     at,
+		NCNodeID: 0,
+		Nodes:    map[int]int{0: 0x25, 1: 0x25},
+		NPER:     map[int]map[int]int{0: {1: rate}, 1: {0: rate + 100}},
+		VLPER:    map[int]map[int]int{0: {1: rate - 200}, 1: {0: rate - 100}},
+		GCD:      map[int]int{0: 1800, 1: 1800},
+	}
+}
+
+var baseTime = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestStoreQuery(t *testing.T) {
+	store := newTestStore(t, 24*time.Hour)
+
+	// Added out of order
+	for _, minutes := range []int{2, 0, 1, 3} {
+		if err := store.Add("bridge-50", testRecord(baseTime.Add(time.Duration(minutes)*time.Minute), 3000+minutes)); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	store.Add("bridge-53", testRecord(baseTime, 1000))
+
+	records, found, err := store.Query("bridge-50", baseTime.Add(time.Minute), baseTime.Add(2*time.Minute))
+	if err != nil || !found {
+		t.Fatalf("Query failed: found=%v err=%v", found, err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records in range, got %d", len(records))
+	}
+	if !records[0].Time.Equal(baseTime.Add(time.Minute)) || records[1].NPER[0][1] != 3002 {
+		t.Errorf("Unexpected records: %+v", records)
+	}
+	if records[0].Nodes[1] != 0x25 || records[0].GCD[1] != 1800 {
+		t.Errorf("Record did not round-trip: %+v", records[0])
+	}
+
+	records, found, _ = store.Query("bridge-50", baseTime.Add(time.Hour), baseTime.Add(2*time.Hour))
+	if !found || len(records) != 0 {
+		t.Errorf("Expected no records outside the range, got %d", len(records))
+	}
+
+	if _, found, _ := store.Query("nope", baseTime, baseTime.Add(time.Hour)); found {
+		t.Error("Expected unknown device not to be found")
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	store := newTestStore(t, 24*time.Hour)
+	store.now = func() time.Time { return baseTime }
+
+	for _, age := range []time.Duration{48 * time.Hour, 25 * time.Hour, 23 * time.Hour, time.Hour} {
+		store.Add("bridge-50", testRecord(baseTime.Add(-age), 3000))
+		store.Add("bridge-53", testRecord(baseTime.Add(-age), 3000))
+	}
+
+	removed, err := store.Prune()
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if removed != 4 {
+		t.Errorf("Expected 4 records removed, got %d", removed)
+	}
+
+	records, _, _ := store.Query("bridge-50", baseTime.Add(-72*time.Hour), baseTime)
+	if len(records) != 2 || !records[0].Time.Equal(baseTime.Add(-23*time.Hour)) {
+		t.Errorf("Expected the 2 records within retention, got %+v", records)
+	}
+}
@@ -0,0 +1,197 @@
+package influx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// Measurement is the InfluxDB measurement written for PHY rates
+const Measurement = "gocoax_phy"
+
+// tagEscaper escapes tag keys and values in line protocol
+var tagEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+
+// measurementEscaper escapes measurement names in line protocol
+var measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+
+// Encode writes a device snapshot as InfluxDB line protocol, one line per link:
+//
+//	gocoax_phy,device=bridge-50,from=0,to=1,moca_version=2.5 nper=2983i,vlper=2700i 1700000000000000000
+//
+// The self-to-self line of each node also carries the gcd field.
+func Encode(w io.Writer, s *collector.DeviceSnapshot) error {
+	bw := bufio.NewWriter(w)
+	timestamp := strconv.FormatInt(s.Time.UnixNano(), 10)
+
+	for _, from := range sortedKeys(s.PHYRates.NPER) {
+		mocaVersion := collector.FormatMocaVersion(s.NodeVersions[from])
+
+		for _, to := range sortedKeys(s.PHYRates.NPER[from]) {
+			fmt.Fprintf(bw, "%s,device=%s,from=%d,to=%d,moca_version=%s nper=%di,vlper=%di",
+				measurementEscaper.Replace(Measurement),
+				tagEscaper.Replace(s.Device),
+				from, to,
+				tagEscaper.Replace(mocaVersion),
+				s.PHYRates.NPER[from][to],
+				s.PHYRates.VLPER[from][to],
+			)
+			if gcd, ok := s.PHYRates.GCD[from]; ok && from == to {
+				fmt.Fprintf(bw, ",gcd=%di", gcd)
+			}
+			fmt.Fprintf(bw, " %s\n", timestamp)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// sortedKeys returns the keys of a node map in ascending order
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// gatherAll gathers snapshots from all devices in parallel, each within its own
+// timeout so that a slow device does not hold up the rest, and encodes them in device
+// order. Devices that fail are logged and left out.
+func gatherAll(ctx context.Context, gatherers []collector.SnapshotGatherer, timeout time.Duration, w io.Writer) error {
+	snapshots := make([]*collector.DeviceSnapshot, len(gatherers))
+	var wg sync.WaitGroup
+	for i, g := range gatherers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gatherCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			snapshot, err := g.Gather(gatherCtx)
+			if err != nil {
+				log.Printf("Error gathering snapshot for device %s: %v", g.DeviceName(), err)
+				return
+			}
+			snapshots[i] = snapshot
+		}()
+	}
+	wg.Wait()
+
+	for _, snapshot := range snapshots {
+		if snapshot == nil {
+			continue
+		}
+		if err := Encode(w, snapshot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves line protocol for the devices returned by gatherers, for Telegraf's
+// http input plugin. gatherers is called on every request.
+func Handler(gatherers func() []collector.SnapshotGatherer, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		if err := gatherAll(r.Context(), gatherers(), timeout, &buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(buf.Bytes())
+	}
+}
+
+// Writer periodically writes device snapshots to the InfluxDB v2 write API
+type Writer struct {
+	cfg        *config.InfluxDBConfig
+	gatherers  func() []collector.SnapshotGatherer // called on every write
+	timeout    time.Duration
+	httpClient *http.Client
+}
+
+// NewWriter creates a writer for the devices returned by gatherers, which is called
+// on every write so devices added later are written too
+func NewWriter(cfg *config.InfluxDBConfig, gatherers func() []collector.SnapshotGatherer, timeout time.Duration) *Writer {
+	return &Writer{
+		cfg:       cfg,
+		gatherers: gatherers,
+		timeout:   timeout,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Run writes every interval until the context is cancelled
+func (w *Writer) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.GetInterval())
+	defer ticker.Stop()
+
+	for {
+		if err := w.WriteOnce(ctx); err != nil {
+			log.Printf("Error writing to InfluxDB: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// WriteOnce gathers all devices and writes them in a single request
+func (w *Writer) WriteOnce(ctx context.Context) error {
+	var buf bytes.Buffer
+	if err := gatherAll(ctx, w.gatherers(), w.timeout, &buf); err != nil {
+		return err
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	query := url.Values{}
+	query.Set("org", w.cfg.Org)
+	query.Set("bucket", w.cfg.Bucket)
+	query.Set("precision", "ns")
+	writeURL := strings.TrimSuffix(w.cfg.URL, "/") + "/api/v2/write?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", writeURL, &buf)
+	if err != nil {
+		return fmt.Errorf("failed to create write request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.cfg.Token != "" {
+		req.Header.Set("Authorization", "Token "+w.cfg.Token)
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("write request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package influx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// testGatherer returns a fixed snapshot or error
+type testGatherer struct {
+	name     string
+	snapshot *collector.DeviceSnapshot
+	err      error
+}
+
+func (g *testGatherer) DeviceName() string { return g.name }
+
+func (g *testGatherer) Gather(ctx context.Context) (*collector.DeviceSnapshot, error) {
+	return g.snapshot, g.err
+}
+
+// newTestSnapshot returns a two-node snapshot for the given device
+func newTestSnapshot(device string) *collector.DeviceSnapshot {
+	rates := collector.NewPHYRateMatrix()
+	rates.NPER[0] = map[int]int{0: 0, 1: 2983}
+	rates.VLPER[0] = map[int]int{0: 0, 1: 2700}
+	rates.NPER[1] = map[int]int{0: 2950, 1: 0}
+	rates.VLPER[1] = map[int]int{0: 2650, 1: 0}
+	rates.GCD[0] = 1200
+
+	return &collector.DeviceSnapshot{
+		Device:       device,
+		Time:         time.Unix(1700000000, 0),
+		NodeVersions: map[int]int{0: 0x25, 1: 0x20},
+		ActiveNodes:  []int{0, 1},
+		PHYRates:     rates,
+	}
+}
+
+func TestEncode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, newTestSnapshot("bridge-50")); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"gocoax_phy,device=bridge-50,from=0,to=0,moca_version=2.5 nper=0i,vlper=0i,gcd=1200i 1700000000000000000",
+		"gocoax_phy,device=bridge-50,from=0,to=1,moca_version=2.5 nper=2983i,vlper=2700i 1700000000000000000",
+		"gocoax_phy,device=bridge-50,from=1,to=0,moca_version=2.0 nper=2950i,vlper=2650i 1700000000000000000",
+		"gocoax_phy,device=bridge-50,from=1,to=1,moca_version=2.0 nper=0i,vlper=0i 1700000000000000000",
+	}, "\n") + "\n"
+
+	if buf.String() != expected {
+		t.Errorf("Unexpected line protocol:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestEncodeEscapesTags(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, newTestSnapshot("living room,tv=1")); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	line := strings.SplitN(buf.String(), "\n", 2)[0]
+	if !strings.HasPrefix(line, `gocoax_phy,device=living\ room\,tv\=1,from=0,`) {
+		t.Errorf("Device tag not escaped: %s", line)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	gatherers := []collector.SnapshotGatherer{
+		&testGatherer{name: "bridge-50", snapshot: newTestSnapshot("bridge-50")},
+		&testGatherer{name: "bridge-53", err: errors.New("connection refused")},
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(func() []collector.SnapshotGatherer { return gatherers }, time.Second)(rec, httptest.NewRequest("GET", "/influx", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected text/plain content type, got %q", ct)
+	}
+
+	body := rec.Body.String()
+	if got := strings.Count(body, "\n"); got != 4 {
+		t.Errorf("Expected 4 lines, got %d:\n%s", got, body)
+	}
+	if strings.Contains(body, "bridge-53") {
+		t.Error("Failed device should be left out")
+	}
+}
+
+// slowGatherer blocks until its context is done
+type slowGatherer struct{ name string }
+
+func (g *slowGatherer) DeviceName() string { return g.name }
+
+func (g *slowGatherer) Gather(ctx context.Context) (*collector.DeviceSnapshot, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestHandlerTimeoutPerDevice(t *testing.T) {
+	gatherers := []collector.SnapshotGatherer{
+		&slowGatherer{name: "bridge-50"},
+		&testGatherer{name: "bridge-53", snapshot: newTestSnapshot("bridge-53")},
+	}
+
+	// The slow first device times out without starving the second
+	rec := httptest.NewRecorder()
+	Handler(func() []collector.SnapshotGatherer { return gatherers }, 50*time.Millisecond)(rec, httptest.NewRequest("GET", "/influx", nil))
+
+	body := rec.Body.String()
+	if !strings.Contains(body, "bridge-53") {
+		t.Errorf("Expected bridge-53 in output, got:\n%s", body)
+	}
+	if strings.Contains(body, "bridge-50") {
+		t.Error("Timed out device should be left out")
+	}
+}
+
+func TestWriteOnce(t *testing.T) {
+	var gotPath, gotAuth string
+	var gotQuery map[string][]string
+	var gotBody []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotQuery = r.URL.Query()
+		gotAuth = r.Header.Get("Authorization")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := &config.InfluxDBConfig{
+		URL:      server.URL + "/",
+		Org:      "home",
+		Bucket:   "moca",
+		Token:    "secret",
+		Interval: 30,
+	}
+	gatherers := []collector.SnapshotGatherer{
+		&testGatherer{name: "bridge-50", snapshot: newTestSnapshot("bridge-50")},
+	}
+
+	if err := NewWriter(cfg, func() []collector.SnapshotGatherer { return gatherers }, time.Second).WriteOnce(context.Background()); err != nil {
+		t.Fatalf("WriteOnce failed: %v", err)
+	}
+
+	if gotPath != "/api/v2/write" {
+		t.Errorf("Expected path /api/v2/write, got %s", gotPath)
+	}
+	for key, expected := range map[string]string{"org": "home", "bucket": "moca", "precision": "ns"} {
+		if got := gotQuery[key]; len(got) != 1 || got[0] != expected {
+			t.Errorf("Expected query %s=%s, got %v", key, expected, got)
+		}
+	}
+	if gotAuth != "Token secret" {
+		t.Errorf("Expected token authorization, got %q", gotAuth)
+	}
+	if !strings.Contains(string(gotBody), "from=0,to=1,moca_version=2.5 nper=2983i,vlper=2700i") {
+		t.Errorf("Unexpected body:\n%s", gotBody)
+	}
+}
+
+func TestWriteOnceError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"code":"unauthorized"}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	cfg := &config.InfluxDBConfig{URL: server.URL, Org: "home", Bucket: "moca", Interval: 30}
+	gatherers := []collector.SnapshotGatherer{
+		&testGatherer{name: "bridge-50", snapshot: newTestSnapshot("bridge-50")},
+	}
+
+	err := NewWriter(cfg, func() []collector.SnapshotGatherer { return gatherers }, time.Second).WriteOnce(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected 401 error, got %v", err)
+	}
+}
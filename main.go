@@ -5,14 +5,27 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/louispool/gocoax-exporter/admin"
+	"github.com/louispool/gocoax-exporter/alert"
 	"github.com/louispool/gocoax-exporter/collector"
 	"github.com/louispool/gocoax-exporter/config"
+	"github.com/louispool/gocoax-exporter/discovery"
+	"github.com/louispool/gocoax-exporter/events"
+	"github.com/louispool/gocoax-exporter/history"
+	"github.com/louispool/gocoax-exporter/influx"
+	"github.com/louispool/gocoax-exporter/mqtt"
+	"github.com/louispool/gocoax-exporter/otlp"
+	"github.com/louispool/gocoax-exporter/push"
+	"github.com/louispool/gocoax-exporter/sd"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -22,9 +35,22 @@ const version = "0.1.0"
 var (
 	configFile = flag.String("config", "config.yaml", "Path to configuration file")
 	showVer    = flag.Bool("version", false, "Show version and exit")
+	once       = flag.Bool("once", false, "Collect from all devices once, write the metrics to -output and exit")
+	output     = flag.String("output", "-", "With -once, file to write the metrics to, or - for standard output")
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "discover":
+			os.Exit(runDiscover(os.Args[2:], os.Stdout, os.Stderr))
+		case "matrix":
+			os.Exit(runMatrix(os.Args[2:], os.Stdout, os.Stderr))
+		case "query":
+			os.Exit(runQuery(os.Args[2:], os.Stdout, os.Stderr))
+		}
+	}
+
 	flag.Parse()
 
 	if *showVer {
@@ -41,6 +67,11 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// One collection for the node_exporter textfile collector, cron or a systemd timer
+	if *once {
+		os.Exit(runOnce(cfg, *output, os.Stdout))
+	}
+
 	log.Printf("Configuration loaded: %d device(s), listen on %s", len(cfg.Devices), cfg.ListenAddress)
 
 	// Create Prometheus registry
@@ -53,19 +84,177 @@ func main() {
 	}
 	defer multiCollector.Close()
 
+	// Log network changes detected between scrapes
+	eventLog, err := events.Open(cfg.Events)
+	if err != nil {
+		log.Fatalf("Failed to open event log: %v", err)
+	}
+	defer eventLog.Close()
+	multiCollector.OnEvent(eventLog.Record)
+
+	// Set up management actions if the admin API or auto-reboot is configured
+	var manager *admin.Manager
+	if cfg.Admin != nil || cfg.AutoReboot != nil {
+		auditPath := ""
+		if cfg.Admin != nil {
+			auditPath = cfg.Admin.AuditLog
+		}
+		auditLog, err := admin.OpenAuditLog(auditPath)
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		defer auditLog.Close()
+
+		// Devices are looked up in the registry on every use, so discovered devices can
+		// be managed too
+		devices := func() []admin.Device {
+			collectors := multiCollector.Collectors()
+			devices := make([]admin.Device, 0, len(collectors))
+			for _, c := range collectors {
+				devices = append(devices, c)
+			}
+			return devices
+		}
+		manager = admin.NewManager(devices, auditLog, cfg.AutoReboot, cfg.GetTimeout())
+		for _, e := range cfg.CustomMetrics {
+			manager.AllowRawEndpoints(e.Endpoint)
+		}
+		for i := range cfg.Profiles {
+			profile, err := collector.ProfileFromConfig(&cfg.Profiles[i])
+			if err != nil {
+				log.Fatalf("Invalid profile: %v", err)
+			}
+			manager.AllowRawEndpoints(profile.Endpoints()...)
+		}
+
+		if cfg.AutoReboot != nil {
+			multiCollector.OnGather(manager.ObserveGather)
+			log.Printf("Auto-reboot enabled after %d consecutive failed queries, at most every %s",
+				cfg.AutoReboot.FailureThreshold, cfg.AutoReboot.GetMinInterval())
+		}
+	}
+
 	// Register collectors with Prometheus
 	if err := multiCollector.Register(registry); err != nil {
 		log.Fatalf("Failed to register collectors: %v", err)
 	}
 
+	// Start push mode if configured
+	pushCtx, stopPush := context.WithCancel(context.Background())
+	defer stopPush()
+	if cfg.Push != nil {
+		pusher := push.NewPusher(cfg.Push, registry)
+		go pusher.Run(pushCtx)
+		log.Printf("Push mode enabled: pushing every %s", cfg.Push.GetInterval())
+	}
+
+	// Start discovery if configured; found devices are added to the registry
+	if cfg.Discovery != nil {
+		scanner := discovery.NewScanner(cfg.Discovery, cfg.GetTimeout())
+		go scanner.Run(pushCtx, multiCollector.KnownAddresses, func(devices []discovery.Device) {
+			addresses := make([]string, len(devices))
+			for i, d := range devices {
+				addresses[i] = d.Address
+			}
+			multiCollector.RefreshDiscovered(pushCtx, addresses)
+		})
+		log.Printf("Discovery enabled: scanning %s every %s", strings.Join(cfg.Discovery.CIDRs, ", "), cfg.Discovery.GetInterval())
+	}
+
+	// Keep the file_sd file up to date if configured
+	if cfg.ServiceDiscovery != nil {
+		fileWriter := sd.NewFileWriter(cfg.ServiceDiscovery, multiCollector, cfg.ListenAddress)
+		go fileWriter.Run(pushCtx)
+		log.Printf("Writing file_sd targets to %s every %s", cfg.ServiceDiscovery.File, cfg.ServiceDiscovery.GetInterval())
+	}
+
+	// Record PHY rate history if configured
+	var historyStore *history.Store
+	if cfg.History != nil {
+		historyStore, err = history.Open(cfg.History.Path, cfg.History.GetRetention())
+		if err != nil {
+			log.Fatalf("Failed to open history store: %v", err)
+		}
+		defer historyStore.Close()
+
+		recorder := history.NewRecorder(cfg.History, historyStore, multiCollector.Gatherers, cfg.GetTimeout())
+		go recorder.Run(pushCtx)
+		log.Printf("Recording history to %s every %s, keeping %d days", cfg.History.Path, cfg.History.GetInterval(), cfg.History.RetentionDays)
+	}
+
+	// Send alerts to webhooks if configured
+	if cfg.Alerting != nil {
+		notifier := alert.NewNotifier(cfg.Alerting, multiCollector.Gatherers, cfg.GetTimeout())
+		go notifier.Run(pushCtx)
+		log.Printf("Alerting enabled: %d rule(s) evaluated every %s", len(cfg.Alerting.Rules), cfg.Alerting.GetInterval())
+	}
+
+	// Start OpenTelemetry export if configured
+	var otlpExporter *otlp.Exporter
+	if cfg.OTLP != nil {
+		targets := func() []otlp.Target {
+			collectors := multiCollector.Collectors()
+			targets := make([]otlp.Target, 0, len(collectors))
+			for _, c := range collectors {
+				targets = append(targets, otlp.Target{Name: c.DeviceName(), Address: c.Address(), Collector: c})
+			}
+			return targets
+		}
+
+		otlpExporter, err = otlp.NewExporter(context.Background(), cfg.OTLP, version, targets)
+		if err != nil {
+			log.Fatalf("Failed to start OTLP export: %v", err)
+		}
+		go otlpExporter.Run(pushCtx)
+	}
+
+	// Start InfluxDB writes if configured
+	if cfg.InfluxDB != nil {
+		writer := influx.NewWriter(cfg.InfluxDB, multiCollector.Gatherers, cfg.GetTimeout())
+		go writer.Run(pushCtx)
+		log.Printf("Writing to InfluxDB at %s every %s", cfg.InfluxDB.URL, cfg.InfluxDB.GetInterval())
+	}
+
+	// Start MQTT publishing if configured
+	var mqttDone chan struct{}
+	if cfg.MQTT != nil {
+		publisher := mqtt.NewPublisher(cfg.MQTT, multiCollector.Gatherers, cfg.GetTimeout())
+		mqttDone = make(chan struct{})
+		go func() {
+			publisher.Run(pushCtx)
+			close(mqttDone)
+		}()
+		log.Printf("Publishing to MQTT broker %s every %s", cfg.MQTT.Broker, cfg.MQTT.GetInterval())
+	}
+
 	// Setup HTTP handlers
 	mux := http.NewServeMux()
 
 	// Metrics endpoint
-	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{
-		ErrorLog:      log.Default(),
-		ErrorHandling: promhttp.ContinueOnError,
-	}))
+	if cfg.OTLP == nil || !cfg.OTLP.DisableMetricsEndpoint {
+		mux.Handle("/metrics", metricsHandler(multiCollector, cfg.GetScrapeTimeoutOffset()))
+	}
+
+	// Single-device scrapes and http_sd targets pointing at them
+	mux.Handle(sd.ProbePath, probeHandler(multiCollector, cfg.GetScrapeTimeoutOffset()))
+	mux.Handle("/sd", sd.Handler(multiCollector))
+
+	// InfluxDB line protocol endpoint for Telegraf
+	mux.Handle("/influx", influx.Handler(multiCollector.Gatherers, cfg.GetTimeout()))
+
+	// Events detected between scrapes
+	mux.Handle("GET /api/v1/events", events.Handler(eventLog))
+
+	// PHY rate history, only when recorded
+	if historyStore != nil {
+		mux.Handle("GET /api/v1/devices/{name}/history", history.Handler(historyStore))
+	}
+
+	// Admin API, only when configured
+	if cfg.Admin != nil {
+		manager.Register(mux, cfg.Admin)
+		log.Printf("Admin API enabled at /api/v1/devices/{name}/reboot and /debug/devices/{name}/raw")
+	}
 
 	// Health endpoint
 	mux.HandleFunc("/health", healthHandler)
@@ -73,13 +262,15 @@ func main() {
 	// Index page
 	mux.HandleFunc("/", indexHandler(cfg, multiCollector))
 
-	// Create HTTP server
+	// Create HTTP server; requests are cancelled with the background work on shutdown,
+	// so scrapes in progress stop querying the devices
 	server := &http.Server{
 		Addr:         cfg.ListenAddress,
 		Handler:      mux,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		BaseContext:  func(net.Listener) context.Context { return pushCtx },
 	}
 
 	// Start server in a goroutine
@@ -97,6 +288,12 @@ func main() {
 	<-sigChan
 
 	log.Println("Shutdown signal received, stopping...")
+	stopPush()
+
+	// Let the MQTT publisher mark devices offline before exiting
+	if mqttDone != nil {
+		<-mqttDone
+	}
 
 	// Graceful shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -106,6 +303,12 @@ func main() {
 		log.Printf("Error during shutdown: %v", err)
 	}
 
+	if otlpExporter != nil {
+		if err := otlpExporter.Shutdown(ctx); err != nil {
+			log.Printf("Error flushing OTLP export: %v", err)
+		}
+	}
+
 	log.Println("Exporter stopped")
 }
 
@@ -115,9 +318,55 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK\n"))
 }
 
+// metricsHandler scrapes all devices within the scrape timeout sent by Prometheus,
+// less offset
+func metricsHandler(registry *collector.MultiDeviceRegistry, offset time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serveScrape(w, r, registry, offset)
+	}
+}
+
+// probeHandler scrapes the single device named by the target parameter
+func probeHandler(registry *collector.MultiDeviceRegistry, offset time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			http.Error(w, "target parameter is missing", http.StatusBadRequest)
+			return
+		}
+		c, ok := registry.Collector(target)
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown device %q", target), http.StatusNotFound)
+			return
+		}
+
+		serveScrape(w, r, c, offset)
+	}
+}
+
+// serveScrape serves the metrics of c from a registry for this request, collected with
+// the request's context so the devices are no longer queried once Prometheus gives up
+func serveScrape(w http.ResponseWriter, r *http.Request, c collector.ContextCollector, offset time.Duration) {
+	ctx, cancel := collector.ScrapeContext(r, offset)
+	defer cancel()
+
+	scrapeRegistry := prometheus.NewRegistry()
+	if err := scrapeRegistry.Register(collector.WithContext(ctx, c)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	promhttp.HandlerFor(scrapeRegistry, promhttp.HandlerOpts{
+		ErrorLog:      log.Default(),
+		ErrorHandling: promhttp.ContinueOnError,
+	}).ServeHTTP(w, r)
+}
+
 // indexHandler creates a handler for the index page
 func indexHandler(cfg *config.Config, registry *collector.MultiDeviceRegistry) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// The registry's devices include those found by discovery
+		devices := registry.Targets()
+
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		fmt.Fprintf(w, `<!DOCTYPE html>
 <html>
@@ -168,14 +417,20 @@ func indexHandler(cfg *config.Config, registry *collector.MultiDeviceRegistry) h
     </div>
 
     <div class="devices">
-        <h2>Configured Devices</h2>
-`, version, len(cfg.Devices), registry.GetCollectorCount())
+        <h2>Devices</h2>
+`, version, len(devices), registry.GetCollectorCount())
 
-		for i, device := range cfg.Devices {
+		for i, device := range devices {
+			probe := fmt.Sprintf(` - <a href="/probe?target=%s">probe</a>`, url.QueryEscape(device.Name))
+			history := ""
+			if cfg.History != nil {
+				history = fmt.Sprintf(` - history: <a href="/api/v1/devices/%[1]s/history?from=-7d">last 7 days</a> (<a href="/api/v1/devices/%[1]s/history?from=-7d&amp;format=csv">CSV</a>)`,
+					url.PathEscape(device.Name))
+			}
 			fmt.Fprintf(w, `        <div class="device">
-            <strong>%d.</strong> %s (%s)
+            <strong>%d.</strong> %s (%s)%s%s
         </div>
-`, i+1, device.Name, device.Address)
+`, i+1, device.Name, device.Address, probe, history)
 		}
 
 		fmt.Fprintf(w, `    </div>
@@ -184,6 +439,10 @@ func indexHandler(cfg *config.Config, registry *collector.MultiDeviceRegistry) h
         <h2>Endpoints</h2>
         <ul>
             <li><a href="/metrics">/metrics</a> - Prometheus metrics</li>
+            <li><a href="/influx">/influx</a> - InfluxDB line protocol</li>
+            <li>/probe?target=&lt;device&gt; - Prometheus metrics of one device</li>
+            <li><a href="/sd">/sd</a> - Prometheus HTTP service discovery targets</li>
+            <li><a href="/api/v1/events">/api/v1/events</a> - Nodes joining and leaving, NC changes and PHY rate steps</li>
             <li><a href="/health">/health</a> - Health check</li>
         </ul>
     </div>
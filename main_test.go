@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// fixtureDir holds the device fixtures shared with the collector tests
+var fixtureDir = filepath.Join("collector", "testdata", "fixtures")
+
+// newTestDevice starts an httptest server that replays a collector fixture like a
+// goCoax adapter and returns its address. An empty name gives an adapter that answers
+// no API calls.
+func newTestDevice(t *testing.T, name string) string {
+	t.Helper()
+
+	var fixture struct {
+		Responses map[string][]string `json:"responses"` // [<endpoint> <request data>] = words
+	}
+	if name != "" {
+		raw, err := os.ReadFile(filepath.Join(fixtureDir, name, "fixture.json"))
+		if err != nil {
+			t.Fatalf("Failed to read fixture: %v", err)
+		}
+		if err := json.Unmarshal(raw, &fixture); err != nil {
+			t.Fatalf("Failed to parse fixture: %v", err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/phyRates.html", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/ms/0/", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var data bytes.Buffer
+		if err := json.Compact(&data, req.Data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		key := fmt.Sprintf("%s %s", r.URL.Path, data.String())
+		words, ok := fixture.Responses[key]
+		if !ok {
+			http.Error(w, "no fixture response for "+key, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string][]string{"data": words})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// newDeadAddress returns the address of a server that has been stopped
+func newDeadAddress(t *testing.T) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestIndexListsDiscoveredDevices(t *testing.T) {
+	configured, found := newTestDevice(t, "single-node"), newTestDevice(t, "single-node")
+	cfg := &config.Config{
+		ScrapeTimeout: 2,
+		Devices:       []config.Device{{Name: "bridge-50", Address: configured, Username: "admin", Password: "gocoax"}},
+		Discovery:     &config.DiscoveryConfig{CIDRs: []string{"127.0.0.1/32"}},
+	}
+	registry, err := collector.NewMultiDeviceRegistry(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	t.Cleanup(func() { registry.Close() })
+	if err := registry.RegisterDiscovered(context.Background(), found); err != nil {
+		t.Fatalf("Failed to register discovered device: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	indexHandler(cfg, registry)(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	body := rec.Body.String()
+	discovered := collector.DiscoveredDeviceName(found)
+	for _, want := range []string{
+		"<strong>Monitoring:</strong> 2 device(s)",
+		"bridge-50 (" + configured + `) - <a href="/probe?target=bridge-50">probe</a>`,
+		discovered + " (" + found + `) - <a href="/probe?target=` + url.QueryEscape(discovered) + `">probe</a>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in the index page, got:\n%s", want, body)
+		}
+	}
+}
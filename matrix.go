@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/client"
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// Clears the terminal between refreshes of the table
+const clearScreen = "\033[H\033[2J"
+
+// matrixNode is a node of the network in the matrix output
+type matrixNode struct {
+	Node        int    `json:"node"`
+	MocaVersion string `json:"moca_version"`
+	NC          bool   `json:"nc,omitempty"`
+	GCD         int    `json:"gcd_mbps,omitempty"`
+}
+
+// matrixOutput is the JSON form of a device's PHY rate matrix
+type matrixOutput struct {
+	Address        string              `json:"address"`
+	Time           time.Time           `json:"time"`
+	MocaNetVersion string              `json:"moca_network_version"`
+	NCNodeID       int                 `json:"nc_node_id"`
+	Nodes          []matrixNode        `json:"nodes"`
+	NPER           map[int]map[int]int `json:"nper"`  // [fromNode][toNode] = rate in Mbps
+	VLPER          map[int]map[int]int `json:"vlper"` // [fromNode][toNode] = rate in Mbps
+}
+
+// runMatrix implements the matrix command, which prints the PHY rate matrix of one
+// device as the collector calculates it
+func runMatrix(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("matrix", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	address := fs.String("address", "", "Adapter address, host or host:port")
+	var username string
+	fs.StringVar(&username, "username", "admin", "Adapter username")
+	fs.StringVar(&username, "user", "admin", "Alias for -username")
+	password := fs.String("password", "gocoax", "Adapter password")
+	auth := fs.String("auth", config.AuthBasic, "Login method: basic, form, challenge or auto")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout for reading the matrix")
+	output := fs.String("output", "table", "Output format: table, json or csv")
+	watch := fs.Duration("watch", 0, "Refresh at this interval, e.g. 5s, until interrupted")
+	verbose := fs.Bool("verbose", false, "Print the requests to the adapter to stderr")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *address == "" {
+		fmt.Fprintf(stderr, "matrix: address is required\n")
+		return 2
+	}
+	if _, _, err := net.SplitHostPort(*address); err != nil {
+		*address = net.JoinHostPort(*address, "80")
+	}
+	if *output != "table" && *output != "json" && *output != "csv" {
+		fmt.Fprintf(stderr, "matrix: output must be table, json or csv\n")
+		return 2
+	}
+	if *watch < 0 {
+		fmt.Fprintf(stderr, "matrix: watch must be a positive interval\n")
+		return 2
+	}
+	if !validAuthMethod(*auth) {
+		fmt.Fprintf(stderr, "matrix: auth must be basic, form, challenge or auto\n")
+		return 2
+	}
+
+	// The client's debug output is discarded unless -verbose is set
+	if *verbose {
+		client.DebugOutput = stderr
+	}
+
+	c, err := collector.New(context.Background(), *address, *address, collector.WithCredentials(username, *password),
+		collector.WithAuthenticator(collector.AuthenticatorFromConfig(&config.AuthConfig{Method: *auth})), collector.WithTimeout(*timeout))
+	if err != nil {
+		fmt.Fprintf(stderr, "matrix: %v\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	csvWriter := csv.NewWriter(stdout)
+	for first := true; ; first = false {
+		gatherCtx, cancel := context.WithTimeout(ctx, *timeout)
+		snapshot, err := c.Gather(gatherCtx)
+		cancel()
+
+		switch {
+		case ctx.Err() != nil:
+			return 0
+		case err != nil && *watch == 0:
+			fmt.Fprintf(stderr, "matrix: %v\n", err)
+			return 1
+		case err != nil:
+			fmt.Fprintf(stderr, "matrix: %v\n", err)
+		case *output == "json":
+			enc := json.NewEncoder(stdout)
+			if *watch == 0 {
+				enc.SetIndent("", "  ")
+			}
+			enc.Encode(newMatrixOutput(*address, snapshot))
+		case *output == "csv":
+			writeMatrixCSV(csvWriter, snapshot, first)
+		default:
+			if *watch > 0 {
+				fmt.Fprint(stdout, clearScreen)
+			}
+			writeMatrixTable(stdout, *address, snapshot)
+		}
+
+		if *watch == 0 {
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-time.After(*watch):
+		}
+	}
+}
+
+// newMatrixOutput converts a snapshot to its JSON form
+func newMatrixOutput(address string, s *collector.DeviceSnapshot) matrixOutput {
+	out := matrixOutput{
+		Address:        address,
+		Time:           s.Time,
+		MocaNetVersion: collector.FormatMocaVersion(s.LocalInfo.MocaNetVersion),
+		NCNodeID:       s.LocalInfo.NCNodeID,
+		Nodes:          []matrixNode{},
+		NPER:           s.PHYRates.NPER,
+		VLPER:          s.PHYRates.VLPER,
+	}
+	for _, node := range s.ActiveNodes {
+		out.Nodes = append(out.Nodes, matrixNode{
+			Node:        node,
+			MocaVersion: collector.FormatMocaVersion(s.NodeVersions[node]),
+			NC:          node == s.LocalInfo.NCNodeID,
+			GCD:         s.PHYRates.GCD[node],
+		})
+	}
+	return out
+}
+
+// writeMatrixCSV writes one row per link, with the header on the first refresh
+func writeMatrixCSV(cw *csv.Writer, s *collector.DeviceSnapshot, header bool) {
+	if header {
+		cw.Write([]string{"time", "from_node", "to_node", "nper_mbps", "vlper_mbps"})
+	}
+	timestamp := s.Time.UTC().Format(time.RFC3339)
+	for _, from := range s.ActiveNodes {
+		for _, to := range s.ActiveNodes {
+			nper, ok := s.PHYRates.NPER[from][to]
+			if !ok {
+				continue
+			}
+			vlper := ""
+			if rate, ok := s.PHYRates.VLPER[from][to]; ok {
+				vlper = strconv.Itoa(rate)
+			}
+			cw.Write([]string{timestamp, strconv.Itoa(from), strconv.Itoa(to), strconv.Itoa(nper), vlper})
+		}
+	}
+	cw.Flush()
+}
+
+// writeMatrixTable writes the nodes followed by the NPER and VLPER matrices, marking
+// the network coordinator with an asterisk:
+//
+//	NODE  MOCA  GCD
+//	0     2.5   3600
+//	1*    2.0   3200
+//
+//	NPER (Mbps)
+//	FROM\TO  0     1*
+//	0        -     2983
+//	1*       3100  -
+func writeMatrixTable(w io.Writer, address string, s *collector.DeviceSnapshot) {
+	nc := s.LocalInfo.NCNodeID
+	label := func(node int) string {
+		if node == nc {
+			return strconv.Itoa(node) + "*"
+		}
+		return strconv.Itoa(node)
+	}
+
+	fmt.Fprintf(w, "%s at %s, MoCA network %s, NC node %d\n\n", address, s.Time.Format(time.RFC3339),
+		collector.FormatMocaVersion(s.LocalInfo.MocaNetVersion), nc)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tMOCA\tGCD")
+	for _, node := range s.ActiveNodes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", label(node), collector.FormatMocaVersion(s.NodeVersions[node]), formatMatrixRate(s.PHYRates.GCD[node]))
+	}
+	tw.Flush()
+
+	for _, m := range []struct {
+		name  string
+		rates map[int]map[int]int
+	}{{"NPER", s.PHYRates.NPER}, {"VLPER", s.PHYRates.VLPER}} {
+		fmt.Fprintf(w, "\n%s (Mbps)\n", m.name)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprint(tw, "FROM\\TO")
+		for _, to := range s.ActiveNodes {
+			fmt.Fprintf(tw, "\t%s", label(to))
+		}
+		fmt.Fprintln(tw)
+		for _, from := range s.ActiveNodes {
+			fmt.Fprint(tw, label(from))
+			for _, to := range s.ActiveNodes {
+				fmt.Fprintf(tw, "\t%s", formatMatrixRate(m.rates[from][to]))
+			}
+			fmt.Fprintln(tw)
+		}
+		tw.Flush()
+	}
+}
+
+// formatMatrixRate formats a rate for the table, with a dash for no rate
+func formatMatrixRate(rate int) string {
+	if rate <= 0 {
+		return "-"
+	}
+	return strconv.Itoa(rate)
+}
+
+// validAuthMethod reports whether method is a login method of the -auth flag
+func validAuthMethod(method string) bool {
+	switch method {
+	case config.AuthBasic, config.AuthForm, config.AuthChallenge, config.AuthAuto:
+		return true
+	}
+	return false
+}
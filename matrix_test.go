@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// loadMatrixGolden reads the PHY rates the collector tests expect for a fixture
+func loadMatrixGolden(t *testing.T, name string) (nper, vlper map[int]map[int]int) {
+	t.Helper()
+
+	raw, err := os.ReadFile(filepath.Join(fixtureDir, name, "matrix.golden.json"))
+	if err != nil {
+		t.Fatalf("Failed to read golden matrix: %v", err)
+	}
+	var golden struct {
+		NPER  map[int]map[int]int `json:"NPER"`
+		VLPER map[int]map[int]int `json:"VLPER"`
+	}
+	if err := json.Unmarshal(raw, &golden); err != nil {
+		t.Fatalf("Failed to parse golden matrix: %v", err)
+	}
+	return golden.NPER, golden.VLPER
+}
+
+func TestMatrixTable(t *testing.T) {
+	address := newTestDevice(t, "moca25-only")
+
+	var stdout, stderr bytes.Buffer
+	if code := runMatrix([]string{"-address", address}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+
+	// Each matrix has a header and a row per node, with the coordinator (node 0) starred
+	nper, vlper := loadMatrixGolden(t, "moca25-only")
+	out := stdout.String()
+	for _, m := range []struct {
+		name  string
+		rates map[int]map[int]int
+	}{{"NPER", nper}, {"VLPER", vlper}} {
+		_, table, ok := strings.Cut(out, "\n"+m.name+" (Mbps)\n")
+		if !ok {
+			t.Fatalf("Expected a %s matrix, got:\n%s", m.name, out)
+		}
+		rows := strings.Split(table, "\n")
+		if got := strings.Fields(rows[0]); strings.Join(got, " ") != `FROM\TO 0* 1 2` {
+			t.Errorf("Unexpected %s header %q", m.name, rows[0])
+		}
+		for from := 0; from < 3; from++ {
+			label := strconv.Itoa(from)
+			if from == 0 {
+				label += "*"
+			}
+			want := []string{label}
+			for to := 0; to < 3; to++ {
+				want = append(want, formatMatrixRate(m.rates[from][to]))
+			}
+			if got := strings.Fields(rows[from+1]); strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("%s row %d: expected %v, got %v", m.name, from, want, got)
+			}
+		}
+	}
+	if !strings.HasPrefix(out, address+" at ") || !strings.Contains(out, "NC node 0") {
+		t.Errorf("Unexpected title in:\n%s", out)
+	}
+}
+
+func TestMatrixCSV(t *testing.T) {
+	address := newTestDevice(t, "moca25-only")
+
+	var stdout, stderr bytes.Buffer
+	if code := runMatrix([]string{"-address", address, "-output", "csv"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+
+	records, err := csv.NewReader(&stdout).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(records) != 10 {
+		t.Fatalf("Expected a header and 9 links, got %d records", len(records))
+	}
+	if got := strings.Join(records[0], ","); got != "time,from_node,to_node,nper_mbps,vlper_mbps" {
+		t.Errorf("Unexpected header %q", got)
+	}
+
+	nper, vlper := loadMatrixGolden(t, "moca25-only")
+	for _, r := range records[1:] {
+		from, _ := strconv.Atoi(r[1])
+		to, _ := strconv.Atoi(r[2])
+		if r[3] != strconv.Itoa(nper[from][to]) || r[4] != strconv.Itoa(vlper[from][to]) {
+			t.Errorf("Link %d->%d: expected %d/%d, got %s/%s", from, to, nper[from][to], vlper[from][to], r[3], r[4])
+		}
+	}
+}
+
+func TestMatrixJSON(t *testing.T) {
+	address := newTestDevice(t, "moca25-only")
+
+	var stdout, stderr bytes.Buffer
+	if code := runMatrix([]string{"-address", address, "-output", "json"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+
+	var out matrixOutput
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if out.Address != address || out.NCNodeID != 0 || len(out.Nodes) != 3 || !out.Nodes[0].NC {
+		t.Errorf("Unexpected matrix: %+v", out)
+	}
+
+	nper, vlper := loadMatrixGolden(t, "moca25-only")
+	for from, rates := range nper {
+		for to, rate := range rates {
+			if out.NPER[from][to] != rate || out.VLPER[from][to] != vlper[from][to] {
+				t.Errorf("Link %d->%d: expected %d/%d, got %d/%d", from, to, rate, vlper[from][to], out.NPER[from][to], out.VLPER[from][to])
+			}
+		}
+	}
+}
+
+func TestMatrixErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected int
+		stderr   string
+	}{
+		{name: "no address", args: nil, expected: 2, stderr: "address is required"},
+		{name: "unknown output", args: []string{"-address", "adapter", "-output", "xml"}, expected: 2, stderr: "output must be"},
+		{name: "negative watch", args: []string{"-address", "adapter", "-watch", "-5s"}, expected: 2, stderr: "watch must be"},
+		{name: "unknown auth", args: []string{"-address", "adapter", "-auth", "digest"}, expected: 2, stderr: "auth must be"},
+		{name: "unknown flag", args: []string{"-color"}, expected: 2, stderr: "flag provided but not defined"},
+		{name: "unreachable", args: []string{"-address", newDeadAddress(t), "-timeout", "2s"}, expected: 1, stderr: "matrix: "},
+		{name: "no API", args: []string{"-address", newTestDevice(t, ""), "-timeout", "2s"}, expected: 1, stderr: "matrix: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := runMatrix(tt.args, &stdout, &stderr); code != tt.expected {
+				t.Errorf("Expected exit code %d, got %d", tt.expected, code)
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("Expected %q in stderr, got %q", tt.stderr, stderr.String())
+			}
+			if stdout.Len() != 0 {
+				t.Errorf("Expected nothing on stdout, got %q", stdout.String())
+			}
+		})
+	}
+}
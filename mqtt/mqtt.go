@@ -0,0 +1,418 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// Payloads of the availability topics, as expected by Home Assistant
+const (
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+)
+
+// Publisher periodically publishes device state to an MQTT broker. State topics are
+// retained so subscribers such as Home Assistant see the last values after a restart.
+//
+// Topics, below <topic_prefix>:
+//
+//	status                               exporter online/offline (last will)
+//	<device>/availability                online/offline, follows gocoax_up
+//	<device>/up                          1 or 0
+//	<device>/nc_node                     node ID of the network coordinator
+//	<device>/node_count                  number of active nodes
+//	<device>/phy/<from>/<to>/nper        NPER PHY rate in Mbps
+//	<device>/phy/<from>/<to>/vlper       VLPER PHY rate in Mbps
+//
+// The link topics of a node that leaves the network are cleared, along with their
+// discovery config.
+type Publisher struct {
+	cfg       *config.MQTTConfig
+	gatherers func() []collector.SnapshotGatherer // called on every publish
+	timeout   time.Duration
+	client    paho.Client
+
+	// announced holds the discovery topics already published; they are retained
+	announced map[string]bool
+
+	// links holds the links of each device published last time, to clear the retained
+	// topics of links that are gone
+	links map[string]map[link]bool
+}
+
+// link is a link from one node to another
+type link struct {
+	from, to int
+}
+
+// message is a state value to publish
+type message struct {
+	topic   string
+	payload string
+}
+
+// NewPublisher creates a publisher for the devices returned by gatherers, which is
+// called on every publish so devices added later are published too
+func NewPublisher(cfg *config.MQTTConfig, gatherers func() []collector.SnapshotGatherer, timeout time.Duration) *Publisher {
+	p := &Publisher{
+		cfg:       cfg,
+		gatherers: gatherers,
+		timeout:   timeout,
+		announced: make(map[string]bool),
+		links:     make(map[string]map[link]bool),
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetWill(p.statusTopic(), payloadOffline, cfg.QoS, true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10 * time.Second).
+		SetOnConnectHandler(func(paho.Client) {
+			log.Printf("Connected to MQTT broker %s", cfg.Broker)
+		}).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Printf("Lost connection to MQTT broker %s: %v", cfg.Broker, err)
+		})
+	p.client = paho.NewClient(opts)
+
+	return p
+}
+
+// Run connects to the broker and publishes every interval until the context is
+// cancelled. On shutdown all devices and the exporter are marked offline.
+func (p *Publisher) Run(ctx context.Context) {
+	if err := p.Connect(ctx); err != nil {
+		log.Printf("Error connecting to MQTT broker: %v", err)
+		return
+	}
+	defer p.client.Disconnect(250)
+
+	ticker := time.NewTicker(p.cfg.GetInterval())
+	defer ticker.Stop()
+
+	for {
+		if err := p.PublishOnce(ctx); err != nil {
+			log.Printf("Error publishing to MQTT: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			if err := p.publishOffline(); err != nil {
+				log.Printf("Error publishing offline state to MQTT: %v", err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Connect connects to the broker, retrying until it succeeds or the context is
+// cancelled, and marks the exporter online
+func (p *Publisher) Connect(ctx context.Context) error {
+	token := p.client.Connect()
+	select {
+	case <-token.Done():
+		if err := token.Error(); err != nil {
+			return err
+		}
+	case <-ctx.Done():
+		p.client.Disconnect(0)
+		return ctx.Err()
+	}
+
+	return p.publish(p.statusTopic(), payloadOnline)
+}
+
+// PublishOnce gathers all devices and publishes their state, announcing new sensors
+// to Home Assistant first
+func (p *Publisher) PublishOnce(ctx context.Context) error {
+	var errs []error
+	for _, g := range p.gatherers() {
+		snapshot, err := p.gather(ctx, g)
+		if err != nil {
+			log.Printf("Error gathering snapshot for device %s: %v", g.DeviceName(), err)
+		}
+		if err := p.publishDevice(g.DeviceName(), snapshot); err != nil {
+			errs = append(errs, fmt.Errorf("device %s: %w", g.DeviceName(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// gather gathers one device's snapshot, each device with its own timeout so that a
+// slow device does not use up the time of the devices after it
+func (p *Publisher) gather(ctx context.Context, g collector.SnapshotGatherer) (*collector.DeviceSnapshot, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return g.Gather(ctx)
+}
+
+// publishDevice publishes one device's state; a nil snapshot marks the device down
+func (p *Publisher) publishDevice(device string, snapshot *collector.DeviceSnapshot) error {
+	if !p.cfg.DisableDiscovery {
+		if err := p.announce(device, snapshot); err != nil {
+			return err
+		}
+	}
+
+	base := p.deviceTopic(device)
+	if snapshot == nil {
+		if err := p.publish(base+"/up", "0"); err != nil {
+			return err
+		}
+		return p.publish(base+"/availability", payloadOffline)
+	}
+
+	values := []message{
+		{base + "/up", "1"},
+		{base + "/nc_node", strconv.Itoa(snapshot.LocalInfo.NCNodeID)},
+		{base + "/node_count", strconv.Itoa(len(snapshot.ActiveNodes))},
+	}
+	// A partial snapshot has no rates; the links keep their last values
+	if !snapshot.Partial {
+		forEachLink(snapshot, func(from, to int) {
+			link := fmt.Sprintf("%s/phy/%d/%d", base, from, to)
+			values = append(values,
+				message{link + "/nper", strconv.Itoa(snapshot.PHYRates.NPER[from][to])},
+				message{link + "/vlper", strconv.Itoa(snapshot.PHYRates.VLPER[from][to])},
+			)
+		})
+	}
+
+	for _, v := range values {
+		if err := p.publish(v.topic, v.payload); err != nil {
+			return err
+		}
+	}
+	if !snapshot.Partial {
+		if err := p.clearLinks(device, snapshot); err != nil {
+			return err
+		}
+	}
+
+	// Availability last, so Home Assistant reads fresh values when sensors come back
+	return p.publish(base+"/availability", payloadOnline)
+}
+
+// clearLinks publishes empty retained payloads to the state and discovery topics of
+// the links published last time that are gone from the snapshot, which removes them
+// from the broker and Home Assistant
+func (p *Publisher) clearLinks(device string, snapshot *collector.DeviceSnapshot) error {
+	current := make(map[link]bool)
+	forEachLink(snapshot, func(from, to int) {
+		current[link{from, to}] = true
+	})
+
+	base := p.deviceTopic(device)
+	for l := range p.links[device] {
+		if current[l] {
+			continue
+		}
+		for _, rate := range []string{"nper", "vlper"} {
+			if err := p.publish(fmt.Sprintf("%s/phy/%d/%d/%s", base, l.from, l.to, rate), ""); err != nil {
+				return err
+			}
+			if p.cfg.DisableDiscovery {
+				continue
+			}
+			topic := p.linkConfigTopic(device, l, rate)
+			if err := p.publish(topic, ""); err != nil {
+				return err
+			}
+			delete(p.announced, topic)
+		}
+	}
+
+	p.links[device] = current
+	return nil
+}
+
+// publishOffline marks all devices and the exporter offline
+func (p *Publisher) publishOffline() error {
+	var errs []error
+	for _, g := range p.gatherers() {
+		if err := p.publish(p.deviceTopic(g.DeviceName())+"/availability", payloadOffline); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := p.publish(p.statusTopic(), payloadOffline); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// publish sends a retained message and waits for it to be handed to the broker
+func (p *Publisher) publish(topic, payload string) error {
+	token := p.client.Publish(topic, p.cfg.QoS, true, payload)
+	if !token.WaitTimeout(p.timeout) {
+		return fmt.Errorf("publish to %s timed out", topic)
+	}
+	return token.Error()
+}
+
+// statusTopic is the exporter's own availability topic
+func (p *Publisher) statusTopic() string {
+	return p.cfg.TopicPrefix + "/status"
+}
+
+// deviceTopic is the base topic for a device
+func (p *Publisher) deviceTopic(device string) string {
+	return p.cfg.TopicPrefix + "/" + objectID(device)
+}
+
+// forEachLink calls fn for every link between two different nodes in ascending order
+func forEachLink(snapshot *collector.DeviceSnapshot, fn func(from, to int)) {
+	for _, from := range snapshot.ActiveNodes {
+		for _, to := range snapshot.ActiveNodes {
+			if from == to {
+				continue
+			}
+			if _, ok := snapshot.PHYRates.NPER[from][to]; ok {
+				fn(from, to)
+			}
+		}
+	}
+}
+
+// linkConfigPath is the discovery path of a link sensor, below the discovery prefix
+func linkConfigPath(id string, l link, rate string) string {
+	return fmt.Sprintf("sensor/gocoax_%s/phy_%d_%d_%s", id, l.from, l.to, rate)
+}
+
+// linkConfigTopic is the discovery config topic of a link sensor
+func (p *Publisher) linkConfigTopic(device string, l link, rate string) string {
+	return p.cfg.DiscoveryPrefix + "/" + linkConfigPath(objectID(device), l, rate) + "/config"
+}
+
+// invalidIDChars matches characters not allowed in topic levels and discovery IDs
+var invalidIDChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// objectID turns a device name into a string safe for topic levels and Home
+// Assistant object IDs
+func objectID(device string) string {
+	return invalidIDChars.ReplaceAllString(strings.ToLower(device), "_")
+}
+
+// discoveryDevice groups sensors under one device in Home Assistant
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// availability is one entry of a discovery payload's availability list
+type availability struct {
+	Topic string `json:"topic"`
+}
+
+// discoveryConfig is a Home Assistant MQTT discovery payload
+type discoveryConfig struct {
+	Name              string          `json:"name"`
+	UniqueID          string          `json:"unique_id"`
+	StateTopic        string          `json:"state_topic"`
+	DeviceClass       string          `json:"device_class,omitempty"`
+	StateClass        string          `json:"state_class,omitempty"`
+	UnitOfMeasurement string          `json:"unit_of_measurement,omitempty"`
+	PayloadOn         string          `json:"payload_on,omitempty"`
+	PayloadOff        string          `json:"payload_off,omitempty"`
+	Availability      []availability  `json:"availability"`
+	AvailabilityMode  string          `json:"availability_mode,omitempty"`
+	Device            discoveryDevice `json:"device"`
+}
+
+// announce publishes discovery config for sensors not yet announced. Link sensors
+// are added as nodes join the network.
+func (p *Publisher) announce(device string, snapshot *collector.DeviceSnapshot) error {
+	id := objectID(device)
+	base := p.deviceTopic(device)
+	haDevice := discoveryDevice{
+		Identifiers:  []string{"gocoax_" + id},
+		Name:         device,
+		Manufacturer: "goCoax",
+		Model:        "MoCA adapter",
+	}
+
+	// The up sensor stays available while the device is down; the other sensors
+	// become unavailable with the device
+	exporterOnly := []availability{{Topic: p.statusTopic()}}
+	withDevice := []availability{{Topic: p.statusTopic()}, {Topic: base + "/availability"}}
+
+	configs := map[string]discoveryConfig{
+		"binary_sensor/gocoax_" + id + "/up": {
+			Name:         "Up",
+			StateTopic:   base + "/up",
+			DeviceClass:  "connectivity",
+			PayloadOn:    "1",
+			PayloadOff:   "0",
+			Availability: exporterOnly,
+		},
+		"sensor/gocoax_" + id + "/nc_node": {
+			Name:             "NC node",
+			StateTopic:       base + "/nc_node",
+			Availability:     withDevice,
+			AvailabilityMode: "all",
+		},
+		"sensor/gocoax_" + id + "/node_count": {
+			Name:             "Node count",
+			StateTopic:       base + "/node_count",
+			StateClass:       "measurement",
+			Availability:     withDevice,
+			AvailabilityMode: "all",
+		},
+	}
+
+	if snapshot != nil {
+		forEachLink(snapshot, func(from, to int) {
+			for _, rate := range []string{"nper", "vlper"} {
+				configs[linkConfigPath(id, link{from, to}, rate)] = discoveryConfig{
+					Name:              fmt.Sprintf("PHY rate %d to %d %s", from, to, strings.ToUpper(rate)),
+					StateTopic:        fmt.Sprintf("%s/phy/%d/%d/%s", base, from, to, rate),
+					DeviceClass:       "data_rate",
+					StateClass:        "measurement",
+					UnitOfMeasurement: "Mbit/s",
+					Availability:      withDevice,
+					AvailabilityMode:  "all",
+				}
+			}
+		})
+	}
+
+	for path, cfg := range configs {
+		topic := p.cfg.DiscoveryPrefix + "/" + path + "/config"
+		if p.announced[topic] {
+			continue
+		}
+
+		object := path[strings.LastIndex(path, "/")+1:]
+		cfg.UniqueID = "gocoax_" + id + "_" + object
+		cfg.Device = haDevice
+
+		payload, err := json.Marshal(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to encode discovery config: %w", err)
+		}
+		if err := p.publish(topic, string(payload)); err != nil {
+			return err
+		}
+		p.announced[topic] = true
+	}
+
+	return nil
+}
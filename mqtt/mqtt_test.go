@@ -0,0 +1,524 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/client"
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// testBroker is a minimal MQTT 3.1.1 broker that accepts any client and records the
+// last message and retain flag per topic. It supports QoS 0 and 1, which is all the
+// publisher uses.
+type testBroker struct {
+	listener net.Listener
+
+	mu        sync.Mutex
+	willTopic string
+	messages  map[string]string
+	retained  map[string]bool
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	b := &testBroker{
+		listener: listener,
+		messages: make(map[string]string),
+		retained: make(map[string]bool),
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+
+	return b
+}
+
+// URL returns the broker address for the client options
+func (b *testBroker) URL() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+// message returns the last payload published to a topic
+func (b *testBroker) message(topic string) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	payload, ok := b.messages[topic]
+	return payload, ok
+}
+
+// isRetained reports whether the last message on a topic had the retain flag set
+func (b *testBroker) isRetained(topic string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.retained[topic]
+}
+
+// will returns the will topic of the last connection
+func (b *testBroker) will() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.willTopic
+}
+
+// topics returns all topics with the given prefix
+func (b *testBroker) topics(prefix string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var topics []string
+	for topic := range b.messages {
+		if strings.HasPrefix(topic, prefix) {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+func (b *testBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		header, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case 1: // CONNECT
+			b.mu.Lock()
+			b.willTopic = parseWillTopic(body)
+			b.mu.Unlock()
+			conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		case 3: // PUBLISH
+			qos := (header >> 1) & 0x03
+			topicLen := int(binary.BigEndian.Uint16(body))
+			topic := string(body[2 : 2+topicLen])
+			rest := body[2+topicLen:]
+			if qos > 0 {
+				conn.Write([]byte{0x40, 0x02, rest[0], rest[1]})
+				rest = rest[2:]
+			}
+
+			b.mu.Lock()
+			b.messages[topic] = string(rest)
+			b.retained[topic] = header&0x01 == 1
+			b.mu.Unlock()
+		case 12: // PINGREQ
+			conn.Write([]byte{0xD0, 0x00})
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+// readPacket reads one MQTT control packet
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, multiplier := 0, 1
+	for {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(digit&0x7F) * multiplier
+		if digit&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// parseWillTopic extracts the will topic from a CONNECT packet body
+func parseWillTopic(body []byte) string {
+	readString := func(b []byte) (string, []byte) {
+		n := int(binary.BigEndian.Uint16(b))
+		return string(b[2 : 2+n]), b[2+n:]
+	}
+
+	_, rest := readString(body) // protocol name
+	flags := rest[1]
+	rest = rest[4:]            // level, flags, keep alive
+	_, rest = readString(rest) // client ID
+	if flags&0x04 == 0 {
+		return ""
+	}
+	topic, _ := readString(rest)
+	return topic
+}
+
+// testGatherer returns a fixed snapshot or error
+type testGatherer struct {
+	name     string
+	snapshot *collector.DeviceSnapshot
+	err      error
+}
+
+func (g *testGatherer) DeviceName() string { return g.name }
+
+func (g *testGatherer) Gather(ctx context.Context) (*collector.DeviceSnapshot, error) {
+	return g.snapshot, g.err
+}
+
+// slowGatherer answers after a delay, or fails if its context is done first
+type slowGatherer struct {
+	testGatherer
+	delay time.Duration
+}
+
+func (g *slowGatherer) Gather(ctx context.Context) (*collector.DeviceSnapshot, error) {
+	select {
+	case <-time.After(g.delay):
+		return g.snapshot, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// newTestSnapshot returns a two-node snapshot with node 1 as NC
+func newTestSnapshot(device string) *collector.DeviceSnapshot {
+	rates := collector.NewPHYRateMatrix()
+	rates.NPER[0] = map[int]int{0: 0, 1: 2983}
+	rates.VLPER[0] = map[int]int{0: 0, 1: 2700}
+	rates.NPER[1] = map[int]int{0: 2950, 1: 0}
+	rates.VLPER[1] = map[int]int{0: 2650, 1: 0}
+
+	return &collector.DeviceSnapshot{
+		Device:       device,
+		Time:         time.Now(),
+		LocalInfo:    &client.LocalInfo{MyNodeID: 0, NCNodeID: 1},
+		NodeVersions: map[int]int{0: 0x25, 1: 0x25},
+		ActiveNodes:  []int{0, 1},
+		PHYRates:     rates,
+	}
+}
+
+func newTestConfig(broker *testBroker) *config.MQTTConfig {
+	return &config.MQTTConfig{
+		Broker:          broker.URL(),
+		ClientID:        "gocoax-test",
+		TopicPrefix:     "gocoax",
+		DiscoveryPrefix: "homeassistant",
+		QoS:             1,
+		Interval:        3600,
+	}
+}
+
+func TestPublishOnce(t *testing.T) {
+	broker := newTestBroker(t)
+	gatherers := []collector.SnapshotGatherer{
+		&testGatherer{name: "Living Room", snapshot: newTestSnapshot("Living Room")},
+		&testGatherer{name: "bridge-53", err: errors.New("connection refused")},
+	}
+
+	p := NewPublisher(newTestConfig(broker), func() []collector.SnapshotGatherer { return gatherers }, 5*time.Second)
+	if err := p.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer p.client.Disconnect(250)
+
+	if err := p.PublishOnce(context.Background()); err != nil {
+		t.Fatalf("PublishOnce failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"gocoax/status":                    "online",
+		"gocoax/living_room/availability":  "online",
+		"gocoax/living_room/up":            "1",
+		"gocoax/living_room/nc_node":       "1",
+		"gocoax/living_room/node_count":    "2",
+		"gocoax/living_room/phy/0/1/nper":  "2983",
+		"gocoax/living_room/phy/0/1/vlper": "2700",
+		"gocoax/living_room/phy/1/0/nper":  "2950",
+		"gocoax/living_room/phy/1/0/vlper": "2650",
+		"gocoax/bridge-53/availability":    "offline",
+		"gocoax/bridge-53/up":              "0",
+	}
+	for topic, payload := range expected {
+		got, ok := broker.message(topic)
+		if !ok {
+			t.Errorf("Nothing published to %s", topic)
+			continue
+		}
+		if got != payload {
+			t.Errorf("%s: expected %q, got %q", topic, payload, got)
+		}
+		if !broker.isRetained(topic) {
+			t.Errorf("%s: expected retained message", topic)
+		}
+	}
+
+	if _, ok := broker.message("gocoax/living_room/phy/0/0/nper"); ok {
+		t.Error("Self-to-self links should not be published")
+	}
+	if will := broker.will(); will != "gocoax/status" {
+		t.Errorf("Expected will on gocoax/status, got %q", will)
+	}
+
+	// Discovery config for a link sensor
+	raw, ok := broker.message("homeassistant/sensor/gocoax_living_room/phy_0_1_nper/config")
+	if !ok {
+		t.Fatalf("No discovery config for link sensor, got %v", broker.topics("homeassistant/"))
+	}
+	var cfg discoveryConfig
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		t.Fatalf("Invalid discovery config: %v", err)
+	}
+	if cfg.StateTopic != "gocoax/living_room/phy/0/1/nper" {
+		t.Errorf("Unexpected state topic %q", cfg.StateTopic)
+	}
+	if cfg.UnitOfMeasurement != "Mbit/s" || cfg.DeviceClass != "data_rate" {
+		t.Errorf("Unexpected unit %q / device class %q", cfg.UnitOfMeasurement, cfg.DeviceClass)
+	}
+	if cfg.UniqueID != "gocoax_living_room_phy_0_1_nper" {
+		t.Errorf("Unexpected unique ID %q", cfg.UniqueID)
+	}
+	if cfg.Device.Name != "Living Room" || len(cfg.Device.Identifiers) != 1 {
+		t.Errorf("Unexpected device %+v", cfg.Device)
+	}
+	if len(cfg.Availability) != 2 || cfg.Availability[1].Topic != "gocoax/living_room/availability" {
+		t.Errorf("Link sensor availability should follow the device, got %+v", cfg.Availability)
+	}
+
+	// A device that is down still gets its up sensor
+	if _, ok := broker.message("homeassistant/binary_sensor/gocoax_bridge-53/up/config"); !ok {
+		t.Error("No discovery config for up sensor of down device")
+	}
+}
+
+func TestPublishTimeoutPerDevice(t *testing.T) {
+	broker := newTestBroker(t)
+
+	// Together the devices take longer than the timeout, each alone does not
+	var gatherers []collector.SnapshotGatherer
+	for _, name := range []string{"bridge-50", "bridge-53", "bridge-56"} {
+		gatherers = append(gatherers, &slowGatherer{
+			testGatherer: testGatherer{name: name, snapshot: newTestSnapshot(name)},
+			delay:        100 * time.Millisecond,
+		})
+	}
+
+	p := NewPublisher(newTestConfig(broker), func() []collector.SnapshotGatherer { return gatherers }, 250*time.Millisecond)
+	if err := p.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer p.client.Disconnect(250)
+
+	if err := p.PublishOnce(context.Background()); err != nil {
+		t.Fatalf("PublishOnce failed: %v", err)
+	}
+	for _, g := range gatherers {
+		topic := "gocoax/" + g.DeviceName() + "/availability"
+		if payload, _ := broker.message(topic); payload != "online" {
+			t.Errorf("%s: expected online, got %q", topic, payload)
+		}
+	}
+}
+
+func TestPublishClearsLinksOfLeftNode(t *testing.T) {
+	broker := newTestBroker(t)
+
+	// Node 2 is on the network at first
+	joined := newTestSnapshot("bridge-50")
+	joined.ActiveNodes = []int{0, 1, 2}
+	joined.PHYRates.NPER[0][2], joined.PHYRates.VLPER[0][2] = 2800, 2500
+	joined.PHYRates.NPER[2] = map[int]int{0: 2810, 1: 2820, 2: 0}
+	joined.PHYRates.VLPER[2] = map[int]int{0: 2510, 1: 2520, 2: 0}
+	g := &testGatherer{name: "bridge-50", snapshot: joined}
+
+	p := NewPublisher(newTestConfig(broker), func() []collector.SnapshotGatherer { return []collector.SnapshotGatherer{g} }, 5*time.Second)
+	if err := p.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer p.client.Disconnect(250)
+
+	if err := p.PublishOnce(context.Background()); err != nil {
+		t.Fatalf("PublishOnce failed: %v", err)
+	}
+	const (
+		stateTopic  = "gocoax/bridge-50/phy/2/0/nper"
+		configTopic = "homeassistant/sensor/gocoax_bridge-50/phy_2_0_nper/config"
+	)
+	if payload, _ := broker.message(configTopic); payload == "" {
+		t.Fatalf("No discovery config for link of node 2")
+	}
+
+	// Node 2 leaves; its link topics are cleared and the others kept
+	g.snapshot = newTestSnapshot("bridge-50")
+	if err := p.PublishOnce(context.Background()); err != nil {
+		t.Fatalf("PublishOnce failed: %v", err)
+	}
+	for _, topic := range []string{stateTopic, configTopic, "gocoax/bridge-50/phy/0/2/vlper"} {
+		if payload, ok := broker.message(topic); !ok || payload != "" || !broker.isRetained(topic) {
+			t.Errorf("%s: expected an empty retained message, got %q", topic, payload)
+		}
+	}
+	if payload, _ := broker.message("gocoax/bridge-50/phy/0/1/nper"); payload != "2983" {
+		t.Errorf("Link of remaining nodes should be kept, got %q", payload)
+	}
+
+	// Node 2 rejoins and is announced again
+	g.snapshot = joined
+	if err := p.PublishOnce(context.Background()); err != nil {
+		t.Fatalf("PublishOnce failed: %v", err)
+	}
+	if payload, _ := broker.message(configTopic); payload == "" {
+		t.Error("Expected link of rejoined node to be announced again")
+	}
+	if payload, _ := broker.message(stateTopic); payload != "2810" {
+		t.Errorf("Expected state of rejoined node, got %q", payload)
+	}
+}
+
+func TestPublishKeepsLinksOfPartialSnapshot(t *testing.T) {
+	broker := newTestBroker(t)
+	g := &testGatherer{name: "bridge-50", snapshot: newTestSnapshot("bridge-50")}
+
+	p := NewPublisher(newTestConfig(broker), func() []collector.SnapshotGatherer { return []collector.SnapshotGatherer{g} }, 5*time.Second)
+	if err := p.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer p.client.Disconnect(250)
+
+	if err := p.PublishOnce(context.Background()); err != nil {
+		t.Fatalf("PublishOnce failed: %v", err)
+	}
+
+	// The PHY rates were skipped; the links are neither updated nor cleared
+	partial := newTestSnapshot("bridge-50")
+	partial.Partial = true
+	partial.PHYRates = collector.NewPHYRateMatrix()
+	g.snapshot = partial
+	if err := p.PublishOnce(context.Background()); err != nil {
+		t.Fatalf("PublishOnce failed: %v", err)
+	}
+	if payload, _ := broker.message("gocoax/bridge-50/phy/0/1/nper"); payload != "2983" {
+		t.Errorf("Expected the last rate to be kept, got %q", payload)
+	}
+	if payload, _ := broker.message("homeassistant/sensor/gocoax_bridge-50/phy_0_1_nper/config"); payload == "" {
+		t.Error("Expected the link sensor to stay announced")
+	}
+	if payload, _ := broker.message("gocoax/bridge-50/node_count"); payload != "2" {
+		t.Errorf("Expected the node count of the partial snapshot, got %q", payload)
+	}
+
+	// The next full snapshot still clears links that are gone
+	full := newTestSnapshot("bridge-50")
+	delete(full.PHYRates.NPER[0], 1)
+	g.snapshot = full
+	if err := p.PublishOnce(context.Background()); err != nil {
+		t.Fatalf("PublishOnce failed: %v", err)
+	}
+	if payload, ok := broker.message("gocoax/bridge-50/phy/0/1/nper"); !ok || payload != "" {
+		t.Errorf("Expected the link gone from a full snapshot to be cleared, got %q", payload)
+	}
+}
+
+func TestPublishWithoutDiscovery(t *testing.T) {
+	broker := newTestBroker(t)
+	gatherers := []collector.SnapshotGatherer{
+		&testGatherer{name: "bridge-50", snapshot: newTestSnapshot("bridge-50")},
+	}
+
+	cfg := newTestConfig(broker)
+	cfg.DisableDiscovery = true
+	p := NewPublisher(cfg, func() []collector.SnapshotGatherer { return gatherers }, 5*time.Second)
+	if err := p.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer p.client.Disconnect(250)
+
+	if err := p.PublishOnce(context.Background()); err != nil {
+		t.Fatalf("PublishOnce failed: %v", err)
+	}
+
+	if topics := broker.topics("homeassistant/"); len(topics) != 0 {
+		t.Errorf("Expected no discovery topics, got %v", topics)
+	}
+	if _, ok := broker.message("gocoax/bridge-50/up"); !ok {
+		t.Error("State not published")
+	}
+}
+
+func TestRunMarksOfflineOnShutdown(t *testing.T) {
+	broker := newTestBroker(t)
+	gatherers := []collector.SnapshotGatherer{
+		&testGatherer{name: "bridge-50", snapshot: newTestSnapshot("bridge-50")},
+	}
+	p := NewPublisher(newTestConfig(broker), func() []collector.SnapshotGatherer { return gatherers }, 5*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if payload, _ := broker.message("gocoax/bridge-50/availability"); payload == "online" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+
+	for _, topic := range []string{"gocoax/bridge-50/availability", "gocoax/status"} {
+		if payload, _ := broker.message(topic); payload != "offline" {
+			t.Errorf("%s: expected offline after shutdown, got %q", topic, payload)
+		}
+	}
+}
+
+func TestObjectID(t *testing.T) {
+	tests := map[string]string{
+		"bridge-50":        "bridge-50",
+		"Living Room":      "living_room",
+		"basement/tv+#":    "basement_tv__",
+		"office_adapter_1": "office_adapter_1",
+	}
+	for name, expected := range tests {
+		if got := objectID(name); got != expected {
+			t.Errorf("objectID(%q) = %q, expected %q", name, got, expected)
+		}
+	}
+}
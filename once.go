@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/louispool/gocoax-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// runOnce collects from all configured devices once and writes the metrics in the
+// text format to output, a file or - for stdout. A file is replaced atomically, so the
+// node_exporter textfile collector never reads it half written. It returns 1 if any
+// device could not be scraped, after writing the metrics of the others. Discovery is
+// not used, so a configuration without devices fails.
+func runOnce(cfg *config.Config, output string, stdout io.Writer) int {
+	if len(cfg.Devices) == 0 {
+		log.Printf("No devices configured; discovery is not used with -once")
+		return 1
+	}
+
+	multiCollector, err := collector.NewMultiDeviceRegistry(cfg)
+	if err != nil {
+		log.Printf("Failed to create collectors: %v", err)
+		return 1
+	}
+	defer multiCollector.Close()
+
+	// Devices count as scraped when their scrape succeeds with the PHY rates; ones that
+	// could not be reached when their collector was created have no collector and fail
+	// too
+	var scraped atomic.Int32
+	for _, c := range multiCollector.Collectors() {
+		c.OnScrape(func(err error) {
+			if err == nil {
+				scraped.Add(1)
+			}
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(collector.WithContext(ctx, multiCollector)); err != nil {
+		log.Printf("Failed to register collectors: %v", err)
+		return 1
+	}
+	families, gatherErr := registry.Gather()
+	if gatherErr != nil {
+		log.Printf("Error gathering metrics: %v", gatherErr)
+	}
+
+	if output == "-" {
+		err = writeMetrics(stdout, families)
+	} else {
+		err = writeMetricsFile(output, families)
+	}
+	if err != nil {
+		log.Printf("Failed to write metrics: %v", err)
+		return 1
+	}
+
+	if failed := len(cfg.Devices) - int(scraped.Load()); failed > 0 {
+		log.Printf("%d device(s) could not be scraped", failed)
+		return 1
+	}
+	if gatherErr != nil {
+		return 1
+	}
+	return 0
+}
+
+// writeMetricsFile writes metrics to a temporary file next to path and renames it over
+// path
+func writeMetricsFile(path string, families []*dto.MetricFamily) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := writeMetrics(tmp, families); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeMetrics writes metrics in the Prometheus text format
+func writeMetrics(w io.Writer, families []*dto.MetricFamily) error {
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(w, family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
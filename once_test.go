@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// newOnceConfig returns a configuration with a device at each address
+func newOnceConfig(addresses map[string]string) *config.Config {
+	cfg := &config.Config{ScrapeTimeout: 2}
+	for name, address := range addresses {
+		cfg.Devices = append(cfg.Devices, config.Device{Name: name, Address: address, Username: "admin", Password: "gocoax"})
+	}
+	return cfg
+}
+
+func TestRunOnceWritesFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gocoax.prom")
+	if err := os.WriteFile(path, []byte("stale\n"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cfg := newOnceConfig(map[string]string{"bridge-50": newTestDevice(t, "single-node")})
+	var stdout bytes.Buffer
+	if code := runOnce(cfg, path, &stdout); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read metrics: %v", err)
+	}
+	if !strings.Contains(string(got), `gocoax_up{device="bridge-50"} 1`) || strings.Contains(string(got), "stale") {
+		t.Errorf("Expected the file to be replaced with the metrics, got:\n%s", got)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Expected nothing on stdout, got %q", stdout.String())
+	}
+
+	// The temporary file is renamed over the file, leaving nothing else behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the metrics file, got %v", entries)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat metrics: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0644 {
+		t.Errorf("Expected mode 0644, got %o", perm)
+	}
+}
+
+func TestRunOnceWriteFails(t *testing.T) {
+	cfg := newOnceConfig(map[string]string{"bridge-50": newTestDevice(t, "single-node")})
+	path := filepath.Join(t.TempDir(), "missing", "gocoax.prom")
+
+	if code := runOnce(cfg, path, &bytes.Buffer{}); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+}
+
+func TestRunOnceStdout(t *testing.T) {
+	cfg := newOnceConfig(map[string]string{"bridge-50": newTestDevice(t, "moca25-only")})
+
+	var stdout bytes.Buffer
+	if code := runOnce(cfg, "-", &stdout); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	for _, want := range []string{`gocoax_up{device="bridge-50"} 1`, "# TYPE gocoax_phy_rate_nper_mbps gauge"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("Expected %q on stdout, got:\n%s", want, stdout.String())
+		}
+	}
+}
+
+func TestRunOnceExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      func(t *testing.T) *config.Config
+		expected int
+		metrics  []string // expected in the output
+	}{
+		{
+			name: "all scraped",
+			cfg: func(t *testing.T) *config.Config {
+				return newOnceConfig(map[string]string{"a": newTestDevice(t, "single-node"), "b": newTestDevice(t, "moca25-only")})
+			},
+			expected: 0,
+			metrics:  []string{`gocoax_up{device="a"} 1`, `gocoax_up{device="b"} 1`},
+		},
+		{
+			name: "all unreachable",
+			cfg: func(t *testing.T) *config.Config {
+				return newOnceConfig(map[string]string{"a": newDeadAddress(t), "b": newDeadAddress(t)})
+			},
+			expected: 1,
+		},
+		{
+			name: "all scrapes fail",
+			cfg: func(t *testing.T) *config.Config {
+				return newOnceConfig(map[string]string{"a": newTestDevice(t, ""), "b": newTestDevice(t, "")})
+			},
+			expected: 1,
+			metrics:  []string{`gocoax_up{device="a"} 0`, `gocoax_up{device="b"} 0`},
+		},
+		{
+			name: "one unreachable",
+			cfg: func(t *testing.T) *config.Config {
+				return newOnceConfig(map[string]string{"a": newTestDevice(t, "single-node"), "b": newDeadAddress(t)})
+			},
+			expected: 1,
+			metrics:  []string{`gocoax_up{device="a"} 1`},
+		},
+		{
+			name: "one scrape fails",
+			cfg: func(t *testing.T) *config.Config {
+				return newOnceConfig(map[string]string{"a": newTestDevice(t, "single-node"), "b": newTestDevice(t, "")})
+			},
+			expected: 1,
+			metrics:  []string{`gocoax_up{device="a"} 1`, `gocoax_up{device="b"} 0`},
+		},
+		{
+			name: "discovery only",
+			cfg: func(t *testing.T) *config.Config {
+				return &config.Config{ScrapeTimeout: 2, Discovery: &config.DiscoveryConfig{CIDRs: []string{"127.0.0.1/32"}}}
+			},
+			expected: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			if code := runOnce(tt.cfg(t), "-", &stdout); code != tt.expected {
+				t.Errorf("Expected exit code %d, got %d", tt.expected, code)
+			}
+			for _, want := range tt.metrics {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("Expected %q in the output, got:\n%s", want, stdout.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package otlp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// Resource attribute keys identifying the device a set of metrics belongs to
+const (
+	AttrDeviceName    = attribute.Key("device.name")
+	AttrDeviceAddress = attribute.Key("device.address")
+)
+
+// Target is a device whose collector should be exported over OTLP. Targets are
+// compared to find devices that moved, so Collector must be comparable, e.g. a pointer.
+type Target struct {
+	Name      string
+	Address   string
+	Collector prometheus.Collector
+}
+
+// Exporter periodically exports device metrics to an OpenTelemetry collector. Each
+// device gets its own meter provider so its name and address become resource attributes.
+type Exporter struct {
+	cfg            *config.OTLPConfig
+	serviceVersion string
+	targets        func() []Target // called on every Run interval
+
+	mu        sync.Mutex
+	providers map[string]*deviceProvider // [device name]
+}
+
+// deviceProvider is the meter provider exporting one target
+type deviceProvider struct {
+	target   Target
+	provider *sdkmetric.MeterProvider
+}
+
+// NewExporter creates an OTLP exporter for the devices returned by targets. Run calls
+// targets again every interval, so devices added later, such as discovered adapters,
+// are exported too.
+func NewExporter(ctx context.Context, cfg *config.OTLPConfig, serviceVersion string, targets func() []Target) (*Exporter, error) {
+	e := &Exporter{
+		cfg:            cfg,
+		serviceVersion: serviceVersion,
+		targets:        targets,
+		providers:      make(map[string]*deviceProvider),
+	}
+	if err := e.update(ctx); err != nil {
+		e.Shutdown(ctx)
+		return nil, err
+	}
+	return e, nil
+}
+
+// Run picks up new devices every interval until ctx is cancelled
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.cfg.GetInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := e.update(ctx); err != nil {
+			log.Printf("Error updating OTLP export: %v", err)
+		}
+	}
+}
+
+// update starts exporting the targets not exported yet, and restarts the export of
+// targets whose address or collector changed, as when a discovered device moves
+func (e *Exporter) update(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var errs []error
+	for _, target := range e.targets() {
+		if p, ok := e.providers[target.Name]; ok {
+			if p.target == target {
+				continue
+			}
+			if err := p.provider.Shutdown(ctx); err != nil {
+				log.Printf("Error stopping OTLP export of device %s: %v", target.Name, err)
+			}
+			delete(e.providers, target.Name)
+		}
+
+		provider, err := e.newProvider(ctx, target)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		e.providers[target.Name] = &deviceProvider{target: target, provider: provider}
+		log.Printf("Exporting device %s over OTLP/%s to %s", target.Name, e.cfg.Protocol, e.cfg.URL)
+	}
+	return errors.Join(errs...)
+}
+
+// newProvider creates the meter provider exporting a target
+func (e *Exporter) newProvider(ctx context.Context, target Target) (*sdkmetric.MeterProvider, error) {
+	metricExporter, err := newMetricExporter(ctx, e.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter for device %s: %w", target.Name, err)
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(target.Collector); err != nil {
+		return nil, fmt.Errorf("failed to register collector for device %s: %w", target.Name, err)
+	}
+
+	res := resource.NewWithAttributes("",
+		attribute.String("service.name", "gocoax-exporter"),
+		attribute.String("service.version", e.serviceVersion),
+		AttrDeviceName.String(target.Name),
+		AttrDeviceAddress.String(target.Address),
+	)
+
+	reader := sdkmetric.NewPeriodicReader(metricExporter,
+		sdkmetric.WithInterval(e.cfg.GetInterval()),
+		sdkmetric.WithProducer(newGathererProducer(registry, e.serviceVersion)),
+	)
+
+	return sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(reader),
+	), nil
+}
+
+// newMetricExporter creates an OTLP metric exporter for the configured protocol
+func newMetricExporter(ctx context.Context, cfg *config.OTLPConfig) (sdkmetric.Exporter, error) {
+	switch cfg.Protocol {
+	case "grpc":
+		return otlpmetricgrpc.New(ctx,
+			otlpmetricgrpc.WithEndpointURL(cfg.URL),
+			otlpmetricgrpc.WithHeaders(cfg.Headers),
+		)
+	case "http":
+		return otlpmetrichttp.New(ctx,
+			otlpmetrichttp.WithEndpointURL(cfg.URL),
+			otlpmetrichttp.WithHeaders(cfg.Headers),
+		)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q", cfg.Protocol)
+	}
+}
+
+// Shutdown flushes pending metrics and stops all exports
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var errs []error
+	for name, p := range e.providers {
+		if err := p.provider.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+		delete(e.providers, name)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,196 @@
+package otlp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/louispool/gocoax-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// testCollector emits metrics shaped like GoCoaxCollector's
+type testCollector struct {
+	rate   *prometheus.GaugeVec
+	errors *prometheus.CounterVec
+}
+
+func newTestCollector(device string) *testCollector {
+	c := &testCollector{
+		rate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gocoax_phy_rate_nper_mbps",
+			Help: "Normal Packet Error Rate PHY rate in Mbps between nodes",
+		}, []string{"device", "from_node", "to_node"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gocoax_scrape_errors_total",
+			Help: "Total number of scrape errors",
+		}, []string{"device"}),
+	}
+
+	c.rate.WithLabelValues(device, "0", "1").Set(2983)
+	c.errors.WithLabelValues(device).Add(2)
+
+	return c
+}
+
+func (c *testCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.rate.Describe(ch)
+	c.errors.Describe(ch)
+}
+
+func (c *testCollector) Collect(ch chan<- prometheus.Metric) {
+	c.rate.Collect(ch)
+	c.errors.Collect(ch)
+}
+
+func TestExportOverHTTP(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*colmetricpb.ExportMetricsServiceRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := &colmetricpb.ExportMetricsServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(nil)
+	}))
+	defer server.Close()
+
+	cfg := &config.OTLPConfig{Protocol: "http", URL: server.URL + "/v1/metrics", Interval: 3600}
+	targets := []Target{
+		{Name: "bridge-50", Address: "192.168.98.50:80", Collector: newTestCollector("bridge-50")},
+	}
+
+	exporter, err := NewExporter(context.Background(), cfg, "test", func() []Target { return targets })
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+
+	// Shutdown flushes a final export
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) == 0 {
+		t.Fatal("Expected at least one export request")
+	}
+
+	rms := requests[0].GetResourceMetrics()
+	if len(rms) != 1 {
+		t.Fatalf("Expected 1 resource, got %d", len(rms))
+	}
+
+	attrs := make(map[string]string)
+	for _, kv := range rms[0].GetResource().GetAttributes() {
+		attrs[kv.GetKey()] = kv.GetValue().GetStringValue()
+	}
+	if attrs["device.name"] != "bridge-50" {
+		t.Errorf("Expected device.name bridge-50, got %q", attrs["device.name"])
+	}
+	if attrs["device.address"] != "192.168.98.50:80" {
+		t.Errorf("Expected device.address 192.168.98.50:80, got %q", attrs["device.address"])
+	}
+
+	metrics := make(map[string]*metricpb.Metric)
+	for _, sm := range rms[0].GetScopeMetrics() {
+		for _, m := range sm.GetMetrics() {
+			metrics[m.GetName()] = m
+		}
+	}
+
+	rate, ok := metrics["gocoax_phy_rate_nper_mbps"]
+	if !ok {
+		t.Fatalf("PHY rate metric not exported, got %v", metrics)
+	}
+	if rate.GetUnit() != "Mbit/s" {
+		t.Errorf("Expected unit Mbit/s, got %q", rate.GetUnit())
+	}
+	points := rate.GetGauge().GetDataPoints()
+	if len(points) != 1 || points[0].GetAsDouble() != 2983 {
+		t.Fatalf("Expected one gauge point of 2983, got %v", points)
+	}
+	for _, kv := range points[0].GetAttributes() {
+		if kv.GetKey() == "device" {
+			t.Error("device label should be a resource attribute, not a data point attribute")
+		}
+	}
+
+	errs, ok := metrics["gocoax_scrape_errors_total"]
+	if !ok {
+		t.Fatal("Scrape errors metric not exported")
+	}
+	sum := errs.GetSum()
+	if sum == nil || !sum.GetIsMonotonic() ||
+		sum.GetAggregationTemporality() != metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+		t.Errorf("Expected a cumulative monotonic sum, got %v", errs.GetData())
+	}
+}
+
+func TestUnitFor(t *testing.T) {
+	tests := map[string]string{
+		"gocoax_phy_rate_nper_mbps":      "Mbit/s",
+		"gocoax_scrape_duration_seconds": "s",
+		"gocoax_up":                      "",
+	}
+	for name, expected := range tests {
+		if got := unitFor(name); got != expected {
+			t.Errorf("unitFor(%s) = %q, expected %q", name, got, expected)
+		}
+	}
+}
+
+func TestExporterPicksUpNewTargets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	defer server.Close()
+
+	cfg := &config.OTLPConfig{Protocol: "http", URL: server.URL + "/v1/metrics", Interval: 3600}
+	targets := []Target{
+		{Name: "bridge-50", Address: "192.168.98.50:80", Collector: newTestCollector("bridge-50")},
+	}
+	exporter, err := NewExporter(context.Background(), cfg, "test", func() []Target { return targets })
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+	defer exporter.Shutdown(context.Background())
+	first := exporter.providers["bridge-50"]
+
+	// A device is discovered and another moves to a new address
+	targets = append(targets, Target{Name: "gocoax-0012ab00cd01", Address: "192.168.98.61:80", Collector: newTestCollector("gocoax-0012ab00cd01")})
+	if err := exporter.update(context.Background()); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if len(exporter.providers) != 2 || exporter.providers["bridge-50"] != first {
+		t.Errorf("Expected the new device to be added next to the first, got %v", exporter.providers)
+	}
+
+	targets[1].Address = "192.168.98.62:80"
+	moved := exporter.providers["gocoax-0012ab00cd01"]
+	if err := exporter.update(context.Background()); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if p := exporter.providers["gocoax-0012ab00cd01"]; p == moved || p.target.Address != "192.168.98.62:80" {
+		t.Errorf("Expected the moved device to be exported from its new address, got %+v", p.target)
+	}
+}
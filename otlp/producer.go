@@ -0,0 +1,118 @@
+package otlp
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// scopeName is the instrumentation scope reported with exported metrics
+const scopeName = "github.com/louispool/gocoax-exporter/collector"
+
+// deviceLabel is moved from metric attributes to the resource
+const deviceLabel = "device"
+
+// gathererProducer converts a Prometheus gatherer's metric families into OpenTelemetry
+// metric data, so names, help text and types match the Prometheus descriptors
+type gathererProducer struct {
+	gatherer  prometheus.Gatherer
+	scope     instrumentation.Scope
+	startTime time.Time
+}
+
+// newGathererProducer creates a producer for the given gatherer
+func newGathererProducer(gatherer prometheus.Gatherer, version string) *gathererProducer {
+	return &gathererProducer{
+		gatherer:  gatherer,
+		scope:     instrumentation.Scope{Name: scopeName, Version: version},
+		startTime: time.Now(),
+	}
+}
+
+// Produce implements sdkmetric.Producer
+func (p *gathererProducer) Produce(ctx context.Context) ([]metricdata.ScopeMetrics, error) {
+	families, err := p.gatherer.Gather()
+	if len(families) == 0 {
+		return nil, err
+	}
+
+	now := time.Now()
+	metrics := make([]metricdata.Metrics, 0, len(families))
+
+	for _, mf := range families {
+		m := metricdata.Metrics{
+			Name:        mf.GetName(),
+			Description: mf.GetHelp(),
+			Unit:        unitFor(mf.GetName()),
+		}
+
+		switch mf.GetType() {
+		case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+			gauge := metricdata.Gauge[float64]{}
+			for _, metric := range mf.GetMetric() {
+				value := metric.GetGauge().GetValue()
+				if mf.GetType() == dto.MetricType_UNTYPED {
+					value = metric.GetUntyped().GetValue()
+				}
+				gauge.DataPoints = append(gauge.DataPoints, metricdata.DataPoint[float64]{
+					Attributes: attributesFor(metric),
+					Time:       now,
+					Value:      value,
+				})
+			}
+			m.Data = gauge
+		case dto.MetricType_COUNTER:
+			sum := metricdata.Sum[float64]{
+				Temporality: metricdata.CumulativeTemporality,
+				IsMonotonic: true,
+			}
+			for _, metric := range mf.GetMetric() {
+				sum.DataPoints = append(sum.DataPoints, metricdata.DataPoint[float64]{
+					Attributes: attributesFor(metric),
+					StartTime:  p.startTime,
+					Time:       now,
+					Value:      metric.GetCounter().GetValue(),
+				})
+			}
+			m.Data = sum
+		default:
+			// The collector only emits gauges and counters
+			continue
+		}
+
+		metrics = append(metrics, m)
+	}
+
+	return []metricdata.ScopeMetrics{{Scope: p.scope, Metrics: metrics}}, err
+}
+
+// attributesFor converts Prometheus labels to attributes, leaving out the device label
+// which is carried by the resource
+func attributesFor(metric *dto.Metric) attribute.Set {
+	kvs := make([]attribute.KeyValue, 0, len(metric.GetLabel()))
+	for _, lp := range metric.GetLabel() {
+		if lp.GetName() == deviceLabel {
+			continue
+		}
+		kvs = append(kvs, attribute.String(lp.GetName(), lp.GetValue()))
+	}
+	return attribute.NewSet(kvs...)
+}
+
+// unitFor derives the UCUM unit from the Prometheus metric name suffix
+func unitFor(name string) string {
+	switch {
+	case strings.HasSuffix(name, "_mbps"):
+		return "Mbit/s"
+	case strings.HasSuffix(name, "_seconds"):
+		return "s"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,254 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	promPush "github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// deviceLabel is the label used to group metrics per device on the Pushgateway
+const deviceLabel = "device"
+
+// Pusher periodically gathers metrics and pushes them to a Pushgateway and/or a
+// Prometheus remote-write endpoint
+type Pusher struct {
+	cfg        *config.PushConfig
+	gatherer   prometheus.Gatherer
+	httpClient *http.Client
+	queue      chan *batch
+}
+
+// batch is one gathered set of metric families waiting to be pushed
+type batch struct {
+	families  []*dto.MetricFamily
+	timestamp time.Time
+}
+
+// statusError is returned when a push target responds with a non-2xx status
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d: %s", e.code, e.body)
+}
+
+// NewPusher creates a pusher for the given gatherer, normally the registry built in main
+func NewPusher(cfg *config.PushConfig, gatherer prometheus.Gatherer) *Pusher {
+	return &Pusher{
+		cfg:      cfg,
+		gatherer: gatherer,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		queue: make(chan *batch, cfg.QueueSize),
+	}
+}
+
+// Run gathers and pushes metrics every interval until the context is cancelled
+func (p *Pusher) Run(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.sendLoop(ctx)
+	}()
+
+	ticker := time.NewTicker(p.cfg.GetInterval())
+	defer ticker.Stop()
+
+	for {
+		p.gatherOnce()
+
+		select {
+		case <-ctx.Done():
+			<-done
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// gatherOnce gathers the registry and queues the result for pushing
+func (p *Pusher) gatherOnce() {
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		// Gather returns partial results alongside collection errors
+		log.Printf("Warning: errors gathering metrics for push: %v", err)
+	}
+	if len(families) == 0 {
+		return
+	}
+
+	p.enqueue(&batch{families: families, timestamp: time.Now()})
+}
+
+// enqueue adds a batch to the queue, dropping the oldest batch if the queue is full
+func (p *Pusher) enqueue(b *batch) {
+	for {
+		select {
+		case p.queue <- b:
+			return
+		default:
+		}
+
+		select {
+		case old := <-p.queue:
+			log.Printf("Warning: push queue full, dropping metrics gathered at %s", old.timestamp.Format(time.RFC3339))
+		default:
+		}
+	}
+}
+
+// sendLoop pushes queued batches in order until the context is cancelled
+func (p *Pusher) sendLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case b := <-p.queue:
+			p.send(ctx, b)
+		}
+	}
+}
+
+// send pushes one batch to every configured target
+func (p *Pusher) send(ctx context.Context, b *batch) {
+	if p.cfg.Pushgateway != nil {
+		for device, families := range splitByDevice(b.families) {
+			err := p.withRetry(ctx, func() error {
+				return p.pushGateway(ctx, device, families)
+			})
+			if err != nil {
+				log.Printf("Error pushing metrics for device %q to Pushgateway: %v", device, err)
+			}
+		}
+	}
+
+	if p.cfg.RemoteWrite != nil {
+		err := p.withRetry(ctx, func() error {
+			return p.remoteWrite(ctx, b)
+		})
+		if err != nil {
+			log.Printf("Error sending metrics to remote-write endpoint: %v", err)
+		}
+	}
+}
+
+// withRetry calls fn up to MaxRetries times with exponential backoff
+func (p *Pusher) withRetry(ctx context.Context, fn func() error) error {
+	var lastErr error
+
+	for attempt := 0; attempt < p.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			// Exponential backoff: 500ms, 1s, 2s, ...
+			backoff := time.Duration(500*(1<<uint(attempt-1))) * time.Millisecond
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		lastErr = err
+
+		if !retryablePushError(err) {
+			break
+		}
+	}
+
+	return fmt.Errorf("push failed after %d attempts: %w", p.cfg.MaxRetries, lastErr)
+}
+
+// retryablePushError reports whether a push should be retried. Client errors other
+// than 429 will not succeed on retry, as with Prometheus remote-write.
+func retryablePushError(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code >= 500 || statusErr.code == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// pushGateway replaces the metrics of one device group on the Pushgateway
+func (p *Pusher) pushGateway(ctx context.Context, device string, families []*dto.MetricFamily) error {
+	gw := p.cfg.Pushgateway
+
+	pusher := promPush.New(gw.URL, gw.Job).
+		Client(p.httpClient).
+		Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			return families, nil
+		}))
+	if device != "" {
+		pusher = pusher.Grouping(deviceLabel, device)
+	}
+	if gw.Username != "" {
+		pusher = pusher.BasicAuth(gw.Username, gw.Password)
+	}
+
+	return pusher.PushContext(ctx)
+}
+
+// splitByDevice groups metric families by their device label, removing the label so
+// the Pushgateway can add it back as a grouping key. Metrics without a device label
+// are grouped under "".
+func splitByDevice(families []*dto.MetricFamily) map[string][]*dto.MetricFamily {
+	groups := make(map[string]map[string]*dto.MetricFamily)
+
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			device := ""
+			labels := make([]*dto.LabelPair, 0, len(m.GetLabel()))
+			for _, lp := range m.GetLabel() {
+				if lp.GetName() == deviceLabel {
+					device = lp.GetValue()
+					continue
+				}
+				labels = append(labels, lp)
+			}
+
+			if groups[device] == nil {
+				groups[device] = make(map[string]*dto.MetricFamily)
+			}
+			group, ok := groups[device][mf.GetName()]
+			if !ok {
+				group = &dto.MetricFamily{Name: mf.Name, Help: mf.Help, Type: mf.Type}
+				groups[device][mf.GetName()] = group
+			}
+
+			metric := proto.Clone(m).(*dto.Metric)
+			metric.Label = labels
+			group.Metric = append(group.Metric, metric)
+		}
+	}
+
+	result := make(map[string][]*dto.MetricFamily, len(groups))
+	for device, byName := range groups {
+		names := make([]string, 0, len(byName))
+		for name := range byName {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			result[device] = append(result[device], byName[name])
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,340 @@
+package push
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/louispool/gocoax-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// newTestRegistry returns a registry with gauges for two devices
+func newTestRegistry(t *testing.T) *prometheus.Registry {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	up := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gocoax_up",
+		Help: "Device is reachable and responding (1=up, 0=down)",
+	}, []string{"device"})
+	rate := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gocoax_phy_rate_nper_mbps",
+		Help: "Normal Packet Error Rate PHY rate in Mbps between nodes",
+	}, []string{"device", "from_node", "to_node"})
+	registry.MustRegister(up, rate)
+
+	up.WithLabelValues("bridge-50").Set(1)
+	up.WithLabelValues("bridge-53").Set(0)
+	rate.WithLabelValues("bridge-50", "0", "1").Set(2983)
+
+	return registry
+}
+
+// receivedRequest is a request captured by a stand-in receiver
+type receivedRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// newReceiver starts a stand-in HTTP receiver that records requests and answers with
+// the given status codes in turn (then 200)
+func newReceiver(t *testing.T, statuses ...int) (*httptest.Server, func() []receivedRequest) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var received []receivedRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		received = append(received, receivedRequest{r.Method, r.URL.Path, r.Header.Clone(), body})
+		status := http.StatusOK
+		if len(received) <= len(statuses) {
+			status = statuses[len(received)-1]
+		}
+		mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []receivedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]receivedRequest(nil), received...)
+	}
+}
+
+func TestPushgatewayGroupsByDevice(t *testing.T) {
+	server, received := newReceiver(t)
+
+	cfg := &config.PushConfig{
+		Interval:    1,
+		QueueSize:   1,
+		MaxRetries:  1,
+		Pushgateway: &config.PushgatewayConfig{URL: server.URL, Job: "gocoax"},
+	}
+	p := NewPusher(cfg, newTestRegistry(t))
+
+	p.gatherOnce()
+	p.send(context.Background(), <-p.queue)
+
+	requests := received()
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 pushes (one per device), got %d", len(requests))
+	}
+
+	bodies := make(map[string]string)
+	for _, r := range requests {
+		if r.method != http.MethodPut {
+			t.Errorf("Expected PUT, got %s", r.method)
+		}
+		bodies[r.path] = string(r.body)
+	}
+
+	body, ok := bodies["/metrics/job/gocoax/device/bridge-50"]
+	if !ok {
+		t.Fatalf("No push for bridge-50 grouping key, got paths %v", bodies)
+	}
+	if _, ok := bodies["/metrics/job/gocoax/device/bridge-53"]; !ok {
+		t.Fatalf("No push for bridge-53 grouping key, got paths %v", bodies)
+	}
+
+	// The pushed body is protobuf-delimited; label values appear verbatim
+	if !strings.Contains(body, "gocoax_phy_rate_nper_mbps") {
+		t.Errorf("Expected bridge-50 push to contain PHY rate metric")
+	}
+	if strings.Contains(body, "bridge-53") {
+		t.Errorf("bridge-50 push contains metrics for bridge-53")
+	}
+}
+
+func TestRemoteWrite(t *testing.T) {
+	server, received := newReceiver(t)
+
+	cfg := &config.PushConfig{
+		Interval:    1,
+		QueueSize:   1,
+		MaxRetries:  1,
+		RemoteWrite: &config.RemoteWriteConfig{URL: server.URL + "/api/v1/write"},
+	}
+	p := NewPusher(cfg, newTestRegistry(t))
+
+	p.gatherOnce()
+	p.send(context.Background(), <-p.queue)
+
+	requests := received()
+	if len(requests) != 1 {
+		t.Fatalf("Expected 1 remote-write request, got %d", len(requests))
+	}
+	r := requests[0]
+
+	if got := r.header.Get("Content-Encoding"); got != "snappy" {
+		t.Errorf("Expected snappy encoding, got %q", got)
+	}
+	if got := r.header.Get("Content-Type"); got != "application/x-protobuf" {
+		t.Errorf("Expected protobuf content type, got %q", got)
+	}
+
+	raw, err := snappy.Decode(nil, r.body)
+	if err != nil {
+		t.Fatalf("Failed to decode snappy body: %v", err)
+	}
+
+	series := decodeWriteRequest(t, raw)
+	if len(series) != 3 {
+		t.Fatalf("Expected 3 series, got %d", len(series))
+	}
+
+	found := false
+	for _, s := range series {
+		if s.labels[0] != (label{"__name__", "gocoax_phy_rate_nper_mbps"}) {
+			continue
+		}
+		found = true
+		want := []label{
+			{"__name__", "gocoax_phy_rate_nper_mbps"},
+			{"device", "bridge-50"},
+			{"from_node", "0"},
+			{"to_node", "1"},
+		}
+		if len(s.labels) != len(want) {
+			t.Fatalf("Expected labels %v, got %v", want, s.labels)
+		}
+		for i := range want {
+			if s.labels[i] != want[i] {
+				t.Errorf("Label %d: expected %v, got %v", i, want[i], s.labels[i])
+			}
+		}
+		if s.value != 2983 {
+			t.Errorf("Expected value 2983, got %v", s.value)
+		}
+		if s.timestamp == 0 {
+			t.Error("Expected sample timestamp to be set")
+		}
+	}
+	if !found {
+		t.Error("PHY rate series not found in remote-write request")
+	}
+}
+
+func TestRemoteWriteRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		expectedReqs int
+	}{
+		{"retries server errors", []int{500, 503}, 3},
+		{"retries rate limiting", []int{429}, 2},
+		{"does not retry client errors", []int{400}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, received := newReceiver(t, tt.statuses...)
+
+			cfg := &config.PushConfig{
+				Interval:    1,
+				QueueSize:   1,
+				MaxRetries:  3,
+				RemoteWrite: &config.RemoteWriteConfig{URL: server.URL},
+			}
+			p := NewPusher(cfg, newTestRegistry(t))
+
+			p.gatherOnce()
+			p.send(context.Background(), <-p.queue)
+
+			if got := len(received()); got != tt.expectedReqs {
+				t.Errorf("Expected %d requests, got %d", tt.expectedReqs, got)
+			}
+		})
+	}
+}
+
+func TestQueueDropsOldest(t *testing.T) {
+	cfg := &config.PushConfig{QueueSize: 2}
+	p := NewPusher(cfg, prometheus.NewRegistry())
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		p.enqueue(&batch{timestamp: base.Add(time.Duration(i) * time.Minute)})
+	}
+
+	if len(p.queue) != 2 {
+		t.Fatalf("Expected queue length 2, got %d", len(p.queue))
+	}
+	if b := <-p.queue; !b.timestamp.Equal(base.Add(2 * time.Minute)) {
+		t.Errorf("Expected oldest kept batch from minute 2, got %s", b.timestamp)
+	}
+	if b := <-p.queue; !b.timestamp.Equal(base.Add(3 * time.Minute)) {
+		t.Errorf("Expected newest batch from minute 3, got %s", b.timestamp)
+	}
+}
+
+func TestRunPushesUntilCancelled(t *testing.T) {
+	server, received := newReceiver(t)
+
+	cfg := &config.PushConfig{
+		Interval:    1,
+		QueueSize:   2,
+		MaxRetries:  1,
+		RemoteWrite: &config.RemoteWriteConfig{URL: server.URL},
+	}
+	p := NewPusher(cfg, newTestRegistry(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(received()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+
+	if len(received()) == 0 {
+		t.Error("Expected at least one push")
+	}
+}
+
+// decodeWriteRequest decodes a WriteRequest protobuf back into series
+func decodeWriteRequest(t *testing.T, b []byte) []timeSeries {
+	t.Helper()
+
+	var series []timeSeries
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 || num != 1 || typ != protowire.BytesType {
+			t.Fatalf("Unexpected WriteRequest field %d (type %d)", num, typ)
+		}
+		b = b[n:]
+		tsBytes, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			t.Fatal("Truncated TimeSeries")
+		}
+		b = b[n:]
+
+		var s timeSeries
+		for len(tsBytes) > 0 {
+			num, _, n := protowire.ConsumeTag(tsBytes)
+			tsBytes = tsBytes[n:]
+			field, n := protowire.ConsumeBytes(tsBytes)
+			tsBytes = tsBytes[n:]
+
+			switch num {
+			case 1:
+				var l label
+				for len(field) > 0 {
+					num, _, n := protowire.ConsumeTag(field)
+					field = field[n:]
+					v, n := protowire.ConsumeString(field)
+					field = field[n:]
+					if num == 1 {
+						l.name = v
+					} else {
+						l.value = v
+					}
+				}
+				s.labels = append(s.labels, l)
+			case 2:
+				for len(field) > 0 {
+					num, _, n := protowire.ConsumeTag(field)
+					field = field[n:]
+					if num == 1 {
+						v, n := protowire.ConsumeFixed64(field)
+						field = field[n:]
+						s.value = math.Float64frombits(v)
+					} else {
+						v, n := protowire.ConsumeVarint(field)
+						field = field[n:]
+						s.timestamp = int64(v)
+					}
+				}
+			}
+		}
+		series = append(series, s)
+	}
+
+	return series
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/client"
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// queryField is a bit field annotated in the query output: (word & mask) >> shift
+type queryField struct {
+	Name  string `json:"name"`
+	Word  int    `json:"word"`
+	Mask  uint32 `json:"mask"`
+	Shift int    `json:"shift"`
+	Value uint32 `json:"value"`
+}
+
+// queryOutput is the JSON form of a query
+type queryOutput struct {
+	Device   string        `json:"device"`
+	Endpoint string        `json:"endpoint"`
+	Data     []int         `json:"data"`
+	Words    []client.Word `json:"words"`
+	Fields   []queryField  `json:"fields,omitempty"`
+}
+
+// runQuery implements the query command, which makes one call to the device API and
+// prints the words of the response, for working out what further calls hold
+func runQuery(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configFile := fs.String("config", "config.yaml", "Configuration file to find -device in")
+	device := fs.String("device", "", "Name of a configured device")
+	address := fs.String("address", "", "Adapter address, host or host:port, instead of -device")
+	var username string
+	fs.StringVar(&username, "username", client.DefaultUsername, "Adapter username, with -address")
+	fs.StringVar(&username, "user", client.DefaultUsername, "Alias for -username")
+	password := fs.String("password", client.DefaultPassword, "Adapter password, with -address")
+	authMethod := fs.String("auth", config.AuthBasic, "Login method with -address: basic, form, challenge or auto")
+	endpoint := fs.String("endpoint", "", "API call, e.g. /ms/0/0x16")
+	dataFlag := fs.String("data", "", "Request data, comma-separated, e.g. 3 or 0x7,2")
+	var fields []queryField
+	fs.Func("field", "Bit field to annotate, name=word:mask[:shift], e.g. version=11:0xF0:4; repeatable", func(s string) error {
+		field, err := parseQueryField(s)
+		if err == nil {
+			fields = append(fields, field)
+		}
+		return err
+	})
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout for the call")
+	output := fs.String("output", "table", "Output format: table or json")
+	verbose := fs.Bool("verbose", false, "Print the requests to the adapter to stderr")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if (*device == "") == (*address == "") {
+		fmt.Fprintf(stderr, "query: either device or address is required\n")
+		return 2
+	}
+	if !client.IsReadEndpoint(*endpoint) {
+		fmt.Fprintf(stderr, "query: endpoint must be a /ms/0/0x<id> call, which reads data\n")
+		return 2
+	}
+	data, err := client.ParseData(*dataFlag)
+	if err != nil {
+		fmt.Fprintf(stderr, "query: %v\n", err)
+		return 2
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(stderr, "query: output must be table or json\n")
+		return 2
+	}
+	if !validAuthMethod(*authMethod) {
+		fmt.Fprintf(stderr, "query: auth must be basic, form, challenge or auto\n")
+		return 2
+	}
+
+	name, auth, profile := *address, &config.AuthConfig{Method: *authMethod}, client.GoCoaxProfile
+	if *device != "" {
+		cfg, err := config.Load(*configFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "query: %v\n", err)
+			return 1
+		}
+		d, ok := findDevice(cfg, *device)
+		if !ok {
+			fmt.Fprintf(stderr, "query: device %q is not in %s\n", *device, *configFile)
+			return 1
+		}
+		name, *address, username, *password, auth = d.Name, d.Address, d.Username, d.Password, d.Auth
+		if profile, err = collector.ProfileFromConfig(cfg.GetProfile(d.Profile)); err != nil {
+			fmt.Fprintf(stderr, "query: %v\n", err)
+			return 1
+		}
+	}
+	opts := []client.Option{client.WithCredentials(username, *password), client.WithProfile(profile), client.WithTimeout(*timeout)}
+	if auth != nil {
+		opts = append(opts, client.WithAuthenticator(collector.AuthenticatorFromConfig(auth)))
+	}
+	if _, _, err := net.SplitHostPort(*address); err != nil {
+		*address = net.JoinHostPort(*address, "80")
+	}
+
+	// The client's debug output is discarded unless -verbose is set
+	if *verbose {
+		client.DebugOutput = stderr
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	c, err := client.New(ctx, *address, opts...)
+	if err != nil {
+		fmt.Fprintf(stderr, "query: %v\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	words, err := c.GetWords(ctx, *endpoint, data)
+	if err != nil {
+		fmt.Fprintf(stderr, "query: %v\n", err)
+		return 1
+	}
+
+	for i := range fields {
+		if fields[i].Word >= len(words) {
+			fmt.Fprintf(stderr, "query: field %s: the response has %d words\n", fields[i].Name, len(words))
+			return 1
+		}
+		fields[i].Value = (words[fields[i].Word] & fields[i].Mask) >> fields[i].Shift
+	}
+
+	out := queryOutput{Device: name, Endpoint: *endpoint, Data: data, Words: client.DescribeWords(words), Fields: fields}
+	if *output == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(out)
+		return 0
+	}
+	writeQueryTable(stdout, out)
+	return 0
+}
+
+// findDevice returns the configured device with the given name
+func findDevice(cfg *config.Config, name string) (config.Device, bool) {
+	for _, d := range cfg.Devices {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return config.Device{}, false
+}
+
+// parseQueryField parses a -field flag, name=word:mask[:shift]
+func parseQueryField(s string) (queryField, error) {
+	name, spec, ok := strings.Cut(s, "=")
+	parts := strings.Split(spec, ":")
+	if !ok || name == "" || len(parts) < 2 || len(parts) > 3 {
+		return queryField{}, fmt.Errorf("field must be name=word:mask[:shift]")
+	}
+
+	word, err := strconv.Atoi(parts[0])
+	if err != nil || word < 0 {
+		return queryField{}, fmt.Errorf("invalid word %q", parts[0])
+	}
+	mask, err := strconv.ParseUint(parts[1], 0, 32)
+	if err != nil {
+		return queryField{}, fmt.Errorf("invalid mask %q", parts[1])
+	}
+	shift := 0
+	if len(parts) == 3 {
+		shift, err = strconv.Atoi(parts[2])
+		if err != nil || shift < 0 || shift > 31 {
+			return queryField{}, fmt.Errorf("invalid shift %q", parts[2])
+		}
+	}
+	return queryField{Name: name, Word: word, Mask: uint32(mask), Shift: shift}, nil
+}
+
+// writeQueryTable writes the words of a response followed by the annotated fields:
+//
+//	bridge-50 /ms/0/0x16 [3]: 2 words
+//
+//	WORD  HEX         DECIMAL  BINARY
+//	0     0x00000003  3        00000000 00000000 00000000 00000011
+//	1     0x00000025  37       00000000 00000000 00000000 00100101
+//
+//	FIELD    WORD  MASK        SHIFT  VALUE
+//	version  1     0x000000f0  4      2
+func writeQueryTable(w io.Writer, out queryOutput) {
+	fmt.Fprintf(w, "%s %s %v: %d words\n\n", out.Device, out.Endpoint, out.Data, len(out.Words))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "WORD\tHEX\tDECIMAL\tBINARY")
+	for _, word := range out.Words {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\n", word.Index, word.Hex, word.Decimal, word.Binary)
+	}
+	tw.Flush()
+
+	if len(out.Fields) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tWORD\tMASK\tSHIFT\tVALUE")
+	for _, f := range out.Fields {
+		fmt.Fprintf(tw, "%s\t%d\t0x%08x\t%d\t%d\n", f.Name, f.Word, f.Mask, f.Shift, f.Value)
+	}
+	tw.Flush()
+}
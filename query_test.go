@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQueryTable(t *testing.T) {
+	address := newTestDevice(t, "moca25-only")
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-address", address, "-endpoint", "/ms/0/0x16", "-data", "0", "-field", "version=4:0xFF"}
+	if code := runQuery(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+
+	out := stdout.String()
+	for _, want := range []string{
+		address + " /ms/0/0x16 [0]: 12 words\n",
+		"0     0x0012ab00  1223424     00000000 00010010 10101011 00000000\n",
+		"version  4     0x000000ff  0      37\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in the output, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestQueryJSON(t *testing.T) {
+	address := newTestDevice(t, "moca25-only")
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-address", address, "-endpoint", "/ms/0/0x1D", "-data", "0x1, 2", "-field", "rate=10:0xFFFF0000:16", "-output", "json"}
+	if code := runQuery(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+
+	var out queryOutput
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if out.Device != address || out.Endpoint != "/ms/0/0x1D" || fmt.Sprint(out.Data) != "[1 2]" || len(out.Words) == 0 {
+		t.Errorf("Unexpected query: %+v", out)
+	}
+	if len(out.Fields) != 1 || out.Fields[0].Value != out.Words[10].Decimal>>16 {
+		t.Errorf("Unexpected fields %+v for word %+v", out.Fields, out.Words[10])
+	}
+}
+
+func TestQueryDevice(t *testing.T) {
+	address := newTestDevice(t, "moca25-only")
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	config := fmt.Sprintf("devices:\n  - name: bridge-50\n    address: %q\n    username: admin\n    password: gocoax\n", address)
+	if err := os.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-config", configFile, "-device", "bridge-50", "-endpoint", "/ms/0/0x15"}
+	if code := runQuery(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "bridge-50 /ms/0/0x15 []: ") {
+		t.Errorf("Expected the device's name in the output, got:\n%s", stdout.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	args = []string{"-config", configFile, "-device", "bridge-51", "-endpoint", "/ms/0/0x15"}
+	if code := runQuery(args, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), `device "bridge-51" is not in`) {
+		t.Errorf("Expected exit code 1 for an unknown device, got %d: %s", code, stderr.String())
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	address := newTestDevice(t, "moca25-only")
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected int
+		stderr   string
+	}{
+		{name: "no device", args: []string{"-endpoint", "/ms/0/0x15"}, expected: 2, stderr: "either device or address"},
+		{name: "device and address", args: []string{"-device", "a", "-address", address, "-endpoint", "/ms/0/0x15"}, expected: 2, stderr: "either device or address"},
+		{name: "no endpoint", args: []string{"-address", address}, expected: 2, stderr: "endpoint must be"},
+		{name: "write endpoint", args: []string{"-address", address, "-endpoint", "/ms/1/0xb00"}, expected: 2, stderr: "endpoint must be"},
+		{name: "invalid data", args: []string{"-address", address, "-endpoint", "/ms/0/0x16", "-data", "one"}, expected: 2, stderr: "query: "},
+		{name: "invalid field", args: []string{"-address", address, "-endpoint", "/ms/0/0x16", "-field", "version=4"}, expected: 2, stderr: "name=word:mask"},
+		{name: "invalid shift", args: []string{"-address", address, "-endpoint", "/ms/0/0x16", "-field", "v=4:0xF:32"}, expected: 2, stderr: "invalid shift"},
+		{name: "unknown output", args: []string{"-address", address, "-endpoint", "/ms/0/0x16", "-output", "csv"}, expected: 2, stderr: "output must be"},
+		{name: "unknown auth", args: []string{"-address", address, "-endpoint", "/ms/0/0x16", "-auth", "digest"}, expected: 2, stderr: "auth must be"},
+		{name: "missing config", args: []string{"-config", filepath.Join(t.TempDir(), "none.yaml"), "-device", "a", "-endpoint", "/ms/0/0x16"}, expected: 1, stderr: "query: "},
+		{name: "unreachable", args: []string{"-address", newDeadAddress(t), "-endpoint", "/ms/0/0x16", "-timeout", "2s"}, expected: 1, stderr: "query: "},
+		{name: "failed call", args: []string{"-address", address, "-endpoint", "/ms/0/0x16", "-data", "9"}, expected: 1, stderr: "query: "},
+		{name: "field past the words", args: []string{"-address", address, "-endpoint", "/ms/0/0x16", "-data", "0", "-field", "v=12:0xF"}, expected: 1, stderr: "the response has 12 words"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := runQuery(tt.args, &stdout, &stderr); code != tt.expected {
+				t.Errorf("Expected exit code %d, got %d: %s", tt.expected, code, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("Expected %q in stderr, got %q", tt.stderr, stderr.String())
+			}
+			if stdout.Len() != 0 {
+				t.Errorf("Expected nothing on stdout, got %q", stdout.String())
+			}
+		})
+	}
+}
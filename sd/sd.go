@@ -0,0 +1,156 @@
+package sd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// ProbePath is the exporter path that scrapes a single device
+const ProbePath = "/probe"
+
+// TargetSource lists the devices to advertise; MultiDeviceRegistry implements it
+type TargetSource interface {
+	Targets() []collector.DeviceTarget
+}
+
+// TargetGroup is a Prometheus target group as used by http_sd and file_sd
+type TargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// Groups returns one target group per device. Each points Prometheus at the probe
+// handler of the exporter at exporterAddress, with the device as the target
+// parameter and instance label, so no relabelling is needed:
+//
+//	{"targets": ["exporter:9090"], "labels": {"__metrics_path__": "/probe", "__param_target": "bridge-50", "instance": "bridge-50", ...}}
+//
+// The device's configured labels are added, along with its address as
+// __meta_gocoax_device_address for use in relabelling.
+func Groups(exporterAddress string, devices []collector.DeviceTarget) []TargetGroup {
+	groups := make([]TargetGroup, 0, len(devices))
+	for _, d := range devices {
+		labels := make(map[string]string, len(d.Labels)+4)
+		for k, v := range d.Labels {
+			labels[k] = v
+		}
+		labels["__metrics_path__"] = ProbePath
+		labels["__param_target"] = d.Name
+		labels["__meta_gocoax_device_address"] = d.Address
+		labels["instance"] = d.Name
+
+		groups = append(groups, TargetGroup{
+			Targets: []string{exporterAddress},
+			Labels:  labels,
+		})
+	}
+	return groups
+}
+
+// Handler serves the target groups for Prometheus http_sd_configs. The targets use
+// the host the request was sent to, which is how Prometheus reaches the exporter.
+func Handler(source TargetSource) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Groups(r.Host, source.Targets()))
+	})
+}
+
+// FileWriter keeps a Prometheus file_sd file up to date with the devices
+type FileWriter struct {
+	cfg             *config.ServiceDiscoveryConfig
+	source          TargetSource
+	exporterAddress string
+	last            []byte
+}
+
+// NewFileWriter creates a writer for the configured file. Without an exporter
+// address in the configuration the listen address is used, with the hostname if it
+// has no host.
+func NewFileWriter(cfg *config.ServiceDiscoveryConfig, source TargetSource, listenAddress string) *FileWriter {
+	return &FileWriter{
+		cfg:             cfg,
+		source:          source,
+		exporterAddress: exporterAddress(cfg.ExporterAddress, listenAddress),
+	}
+}
+
+// exporterAddress returns the address Prometheus should scrape the exporter on
+func exporterAddress(configured, listenAddress string) string {
+	if configured != "" {
+		return configured
+	}
+	host, port, err := net.SplitHostPort(listenAddress)
+	if err != nil || (host != "" && host != "0.0.0.0" && host != "::") {
+		return listenAddress
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		host = hostname
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// Run writes the file every interval until ctx is cancelled
+func (f *FileWriter) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.cfg.GetInterval())
+	defer ticker.Stop()
+
+	for {
+		if err := f.WriteOnce(); err != nil {
+			log.Printf("Error writing service discovery file: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// WriteOnce writes the current targets if they changed since the last write. The file
+// is replaced atomically so Prometheus never reads a partial file.
+func (f *FileWriter) WriteOnce() error {
+	data, err := json.MarshalIndent(Groups(f.exporterAddress, f.source.Targets()), "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if bytes.Equal(data, f.last) {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.cfg.File), ".gocoax-sd-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.cfg.File); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", f.cfg.File, err)
+	}
+
+	f.last = data
+	return nil
+}
@@ -0,0 +1,154 @@
+package sd
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/louispool/gocoax-exporter/collector"
+	"github.com/louispool/gocoax-exporter/config"
+)
+
+// staticSource serves a fixed list of targets
+type staticSource []collector.DeviceTarget
+
+func (s staticSource) Targets() []collector.DeviceTarget { return s }
+
+var testTargets = staticSource{
+	{Name: "bridge-50", Address: "192.168.98.50:80", Labels: map[string]string{"room": "office"}},
+	{Name: "gocoax-192-168-98-77", Address: "192.168.98.77:80"},
+}
+
+func TestGroups(t *testing.T) {
+	groups := Groups("exporter:9090", testTargets)
+
+	expected := []TargetGroup{
+		{
+			Targets: []string{"exporter:9090"},
+			Labels: map[string]string{
+				"__metrics_path__":             "/probe",
+				"__param_target":               "bridge-50",
+				"__meta_gocoax_device_address": "192.168.98.50:80",
+				"instance":                     "bridge-50",
+				"room":                         "office",
+			},
+		},
+		{
+			Targets: []string{"exporter:9090"},
+			Labels: map[string]string{
+				"__metrics_path__":             "/probe",
+				"__param_target":               "gocoax-192-168-98-77",
+				"__meta_gocoax_device_address": "192.168.98.77:80",
+				"instance":                     "gocoax-192-168-98-77",
+			},
+		},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, groups)
+	}
+
+	// Configured labels are not modified
+	if len(testTargets[0].Labels) != 1 {
+		t.Errorf("Groups modified the device labels: %v", testTargets[0].Labels)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://exporter.lan:9090/sd", nil)
+	rec := httptest.NewRecorder()
+	Handler(testTargets).ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected application/json, got %s", ct)
+	}
+
+	var groups []TargetGroup
+	if err := json.Unmarshal(rec.Body.Bytes(), &groups); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if len(groups) != 2 || groups[0].Targets[0] != "exporter.lan:9090" {
+		t.Errorf("Expected targets on the requested host, got %+v", groups)
+	}
+
+	// No devices is an empty list, not null
+	rec = httptest.NewRecorder()
+	Handler(staticSource{}).ServeHTTP(rec, req)
+	if body := rec.Body.String(); body != "[]\n" {
+		t.Errorf("Expected empty list, got %q", body)
+	}
+}
+
+func TestFileWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gocoax.json")
+	source := testTargets[:1]
+	w := NewFileWriter(&config.ServiceDiscoveryConfig{File: path, ExporterAddress: "exporter:9090"}, &source, ":9090")
+
+	if err := w.WriteOnce(); err != nil {
+		t.Fatalf("WriteOnce failed: %v", err)
+	}
+	var groups []TargetGroup
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if err := json.Unmarshal(raw, &groups); err != nil {
+		t.Fatalf("Invalid file: %v", err)
+	}
+	if len(groups) != 1 || groups[0].Targets[0] != "exporter:9090" {
+		t.Errorf("Unexpected groups: %+v", groups)
+	}
+
+	// Unchanged targets leave the file alone
+	info, _ := os.Stat(path)
+	os.Chtimes(path, info.ModTime().Add(-1e9), info.ModTime().Add(-1e9))
+	before, _ := os.Stat(path)
+	if err := w.WriteOnce(); err != nil {
+		t.Fatalf("WriteOnce failed: %v", err)
+	}
+	after, _ := os.Stat(path)
+	if !after.ModTime().Equal(before.ModTime()) {
+		t.Error("Expected unchanged targets not to rewrite the file")
+	}
+
+	// A new device is written
+	source = testTargets
+	if err := w.WriteOnce(); err != nil {
+		t.Fatalf("WriteOnce failed: %v", err)
+	}
+	raw, _ = os.ReadFile(path)
+	groups = nil
+	json.Unmarshal(raw, &groups)
+	if len(groups) != 2 {
+		t.Errorf("Expected 2 groups after a device was added, got %d", len(groups))
+	}
+
+	// No temporary files are left behind
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the targets file, found %d entries", len(entries))
+	}
+}
+
+func TestExporterAddress(t *testing.T) {
+	hostname, _ := os.Hostname()
+
+	tests := []struct {
+		configured string
+		listen     string
+		expected   string
+	}{
+		{"exporter:9090", ":9090", "exporter:9090"},
+		{"", "10.0.0.5:9090", "10.0.0.5:9090"},
+		{"", ":9090", hostname + ":9090"},
+		{"", "0.0.0.0:9100", hostname + ":9100"},
+	}
+
+	for _, tt := range tests {
+		if got := exporterAddress(tt.configured, tt.listen); got != tt.expected {
+			t.Errorf("exporterAddress(%q, %q) = %q, expected %q", tt.configured, tt.listen, got, tt.expected)
+		}
+	}
+}